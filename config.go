@@ -3,15 +3,19 @@ package main
 import (
 	"errors"
 	"net/url"
+	"strings"
+	"time"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 type mateConfig struct {
-	producer string
-	consumer string
-	debug    bool
-	syncOnly bool
+	producer                string
+	producerFailurePolicy   string
+	producerStartupFailures int
+	consumer                string
+	debug                   bool
+	syncOnly                bool
 
 	fakeDNSName       string
 	fakeMode          string
@@ -20,15 +24,84 @@ type mateConfig struct {
 	fakeFixedIP       string
 	fakeFixedHostname string
 
-	kubernetesServer         *url.URL
-	kubernetesFormat         string
-	kubernetesTrackNodePorts bool
-	kubernetesFilter         map[string]string
+	filePath         string
+	filePollInterval time.Duration
+
+	kubernetesServer            *url.URL
+	kubernetesFormat            string
+	kubernetesTrackNodePorts    bool
+	kubernetesTrackExternalName bool
+	kubernetesTrackExternalIPs  bool
+	kubernetesTrackClusterIP    bool
+	kubernetesTrackDNSEndpoints bool
+	kubernetesFilter            map[string]string
 
 	awsRecordGroupID string
+	awsDomains       []string
+	awsZoneIDs       []string
+	awsZoneType      string
+
+	googleProjects            []string
+	googleCredentialsFile     string
+	googleRecordGroupID       string
+	googleZones               []string
+	googleDomains             []string
+	googleZoneVisibility      string
+	googleZoneRefreshInterval time.Duration
+	googleChangeTimeout       time.Duration
+
+	rfc2136Server        string
+	rfc2136Zones         []string
+	rfc2136RecordGroupID string
+	rfc2136TSIGKeyName   string
+	rfc2136TSIGSecret    string
+	rfc2136TSIGAlgorithm string
+
+	powerDNSServer        string
+	powerDNSAPIKey        string
+	powerDNSServerID      string
+	powerDNSRecordGroupID string
+
+	cloudflareAPIURL        string
+	cloudflareAPIToken      string
+	cloudflareAPIEmail      string
+	cloudflareAPIKey        string
+	cloudflareRecordGroupID string
+
+	azureARMEndpoint    string
+	azureAuthorityURL   string
+	azureSubscriptionID string
+	azureResourceGroup  string
+	azureTenantID       string
+	azureClientID       string
+	azureClientSecret   string
+	azureRecordGroupID  string
+
+	etcdEndpoints     []string
+	etcdPrefix        string
+	etcdCertFile      string
+	etcdKeyFile       string
+	etcdCAFile        string
+	etcdRecordGroupID string
+
+	zonefileDir           string
+	zonefileOrigins       []string
+	zonefileCommand       string
+	zonefileRecordGroupID string
+
+	serverAddress       string
+	serverZones         []string
+	serverNameServers   []string
+	serverRecordGroupID string
 
-	googleProject       string
-	googleRecordGroupID string
+	webhookURL           string
+	webhookSecret        string
+	webhookTimeout       time.Duration
+	webhookRetries       int
+	webhookRecordGroupID string
+
+	pluginTimeout       time.Duration
+	pluginRecordGroupID string
 }
 
 func newConfig(version string) *mateConfig {
@@ -37,8 +110,10 @@ func newConfig(version string) *mateConfig {
 }
 
 func (cfg *mateConfig) parseFlags() {
-	kingpin.Flag("producer", "The endpoints producer to use.").Required().StringVar(&cfg.producer)
-	kingpin.Flag("consumer", "The endpoints consumer to use.").Required().StringVar(&cfg.consumer)
+	kingpin.Flag("producer", "The endpoints producer to use, several producers can be combined separated by comma.").Required().StringVar(&cfg.producer)
+	kingpin.Flag("producer-failure-policy", "How to handle a failing producer when combining several: fail-open uses its last known endpoints, fail-closed skips the synchronization.").Default("fail-open").EnumVar(&cfg.producerFailurePolicy, "fail-open", "fail-closed")
+	kingpin.Flag("producer-startup-failures", "With fail-open, how many synchronizations to skip for a failing producer that never returned endpoints before continuing without it.").Default("3").IntVar(&cfg.producerStartupFailures)
+	kingpin.Flag("consumer", "The endpoints consumer to use, several consumers can be combined separated by comma.").Required().StringVar(&cfg.consumer)
 	kingpin.Flag("debug", "Enable debug logging.").BoolVar(&cfg.debug)
 	kingpin.Flag("sync-only", "Disable event watcher").BoolVar(&cfg.syncOnly)
 
@@ -49,25 +124,135 @@ func (cfg *mateConfig) parseFlags() {
 	kingpin.Flag("fake-fixed-ip", "The full fake IP to use.").StringVar(&cfg.fakeFixedIP)
 	kingpin.Flag("fake-fixed-hostname", "The full fake host name to use.").StringVar(&cfg.fakeFixedHostname)
 
+	kingpin.Flag("file-path", "The YAML or JSON file to read endpoints from.").StringVar(&cfg.filePath)
+	kingpin.Flag("file-poll-interval", "How often to check the endpoints file for changes.").Default("5s").DurationVar(&cfg.filePollInterval)
+
 	kingpin.Flag("kubernetes-server", "The address of the Kubernetes API server.").URLVar(&cfg.kubernetesServer)
 	kingpin.Flag("kubernetes-format", "Format of DNS entries, e.g. {{.Name}}-{{.Namespace}}.example.com").StringVar(&cfg.kubernetesFormat)
 	kingpin.Flag("kubernetes-track-node-ports", "When true, generates DNS entries for type=NodePort services").BoolVar(&cfg.kubernetesTrackNodePorts)
+	kingpin.Flag("kubernetes-track-external-name", "When true, generates DNS entries for type=ExternalName services").BoolVar(&cfg.kubernetesTrackExternalName)
+	kingpin.Flag("kubernetes-track-external-ips", "When true, generates DNS entries for services with externalIPs").BoolVar(&cfg.kubernetesTrackExternalIPs)
+	kingpin.Flag("kubernetes-track-cluster-ip", "When true, generates DNS entries in private zones for the cluster IP of annotated type=ClusterIP services").BoolVar(&cfg.kubernetesTrackClusterIP)
+	kingpin.Flag("kubernetes-track-dns-endpoints", "When true, generates DNS entries for the records declared in DNSEndpoint resources").BoolVar(&cfg.kubernetesTrackDNSEndpoints)
 	kingpin.Flag("kubernetes-filter", "A set of annotations that must match in order to process the object.").StringMapVar(&cfg.kubernetesFilter)
 
 	kingpin.Flag("aws-record-group-id", "Identifier to filter mate created records ").StringVar(&cfg.awsRecordGroupID)
+	kingpin.Flag("aws-domain", "Only manage the hosted zones of this domain and its subdomains, can be given several times.").StringsVar(&cfg.awsDomains)
+	kingpin.Flag("aws-zone-id", "ID of a hosted zone to manage, can be given several times. All hosted zones of the account are managed by default.").StringsVar(&cfg.awsZoneIDs)
+	kingpin.Flag("aws-zone-type", "Only manage public or private hosted zones.").EnumVar(&cfg.awsZoneType, "public", "private")
+
+	kingpin.Flag("google-project", "ID of a project whose managed zones to manage, can be given several times.").StringsVar(&cfg.googleProjects)
+	kingpin.Flag("google-credentials-file", "A service account JSON key to authenticate with instead of the application default credentials.").StringVar(&cfg.googleCredentialsFile)
+	kingpin.Flag("google-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.googleRecordGroupID)
+	kingpin.Flag("google-zone", "Name of a managed zone to manage, can be given several times. All zones of the projects are managed by default.").StringsVar(&cfg.googleZones)
+	kingpin.Flag("google-domain", "Only manage the zones of this domain and its subdomains, can be given several times.").StringsVar(&cfg.googleDomains)
+	kingpin.Flag("google-zone-visibility", "Only manage public or private zones.").EnumVar(&cfg.googleZoneVisibility, "public", "private")
+	kingpin.Flag("google-zone-refresh-interval", "How often to list the managed zones again to pick up new ones.").Default("5m").DurationVar(&cfg.googleZoneRefreshInterval)
+	kingpin.Flag("google-change-timeout", "How long to wait for a submitted change to be done.").Default("2m").DurationVar(&cfg.googleChangeTimeout)
+
+	kingpin.Flag("rfc2136-server", "The host:port of the DNS server accepting dynamic updates.").StringVar(&cfg.rfc2136Server)
+	kingpin.Flag("rfc2136-zone", "A zone to manage on the DNS server, can be given several times.").StringsVar(&cfg.rfc2136Zones)
+	kingpin.Flag("rfc2136-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.rfc2136RecordGroupID)
+	kingpin.Flag("rfc2136-tsig-keyname", "The name of the TSIG key to sign transfers and updates with.").StringVar(&cfg.rfc2136TSIGKeyName)
+	kingpin.Flag("rfc2136-tsig-secret", "The base64 encoded secret of the TSIG key.").StringVar(&cfg.rfc2136TSIGSecret)
+	kingpin.Flag("rfc2136-tsig-algorithm", "The algorithm of the TSIG key.").Default("hmac-sha256").EnumVar(&cfg.rfc2136TSIGAlgorithm, "hmac-md5", "hmac-sha1", "hmac-sha256", "hmac-sha512")
+
+	kingpin.Flag("powerdns-server", "The URL of the PowerDNS HTTP API, e.g. http://localhost:8081.").StringVar(&cfg.powerDNSServer)
+	kingpin.Flag("powerdns-api-key", "The API key of the PowerDNS HTTP API.").StringVar(&cfg.powerDNSAPIKey)
+	kingpin.Flag("powerdns-server-id", "The ID of the PowerDNS server managing the zones.").Default("localhost").StringVar(&cfg.powerDNSServerID)
+	kingpin.Flag("powerdns-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.powerDNSRecordGroupID)
+
+	kingpin.Flag("cloudflare-api-url", "The base URL of the Cloudflare API.").Default("https://api.cloudflare.com/client/v4").StringVar(&cfg.cloudflareAPIURL)
+	kingpin.Flag("cloudflare-api-token", "The API token to access Cloudflare with.").StringVar(&cfg.cloudflareAPIToken)
+	kingpin.Flag("cloudflare-api-email", "The account email to access Cloudflare with, when not using an API token.").StringVar(&cfg.cloudflareAPIEmail)
+	kingpin.Flag("cloudflare-api-key", "The global API key to access Cloudflare with, when not using an API token.").StringVar(&cfg.cloudflareAPIKey)
+	kingpin.Flag("cloudflare-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.cloudflareRecordGroupID)
+
+	kingpin.Flag("azure-arm-endpoint", "The URL of the Azure Resource Manager API.").Default("https://management.azure.com").StringVar(&cfg.azureARMEndpoint)
+	kingpin.Flag("azure-authority-url", "The URL of Azure Active Directory to request tokens from.").Default("https://login.microsoftonline.com").StringVar(&cfg.azureAuthorityURL)
+	kingpin.Flag("azure-subscription-id", "The subscription containing the DNS zones.").StringVar(&cfg.azureSubscriptionID)
+	kingpin.Flag("azure-resource-group", "The resource group containing the DNS zones.").StringVar(&cfg.azureResourceGroup)
+	kingpin.Flag("azure-tenant-id", "The Azure Active Directory tenant of the service principal.").StringVar(&cfg.azureTenantID)
+	kingpin.Flag("azure-client-id", "The client ID of the service principal to access Azure with.").StringVar(&cfg.azureClientID)
+	kingpin.Flag("azure-client-secret", "The client secret of the service principal to access Azure with.").StringVar(&cfg.azureClientSecret)
+	kingpin.Flag("azure-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.azureRecordGroupID)
+
+	kingpin.Flag("etcd-endpoint", "A client URL of the etcd cluster, can be given several times.").StringsVar(&cfg.etcdEndpoints)
+	kingpin.Flag("etcd-prefix", "The path below which records are stored in the SkyDNS layout.").Default("/skydns").StringVar(&cfg.etcdPrefix)
+	kingpin.Flag("etcd-cert-file", "The client certificate to access etcd with.").StringVar(&cfg.etcdCertFile)
+	kingpin.Flag("etcd-key-file", "The key of the client certificate to access etcd with.").StringVar(&cfg.etcdKeyFile)
+	kingpin.Flag("etcd-ca-file", "The CA to verify the certificates of etcd with.").StringVar(&cfg.etcdCAFile)
+	kingpin.Flag("etcd-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.etcdRecordGroupID)
 
-	kingpin.Flag("google-project", "Project ID that manages the zone").StringVar(&cfg.googleProject)
-	kingpin.Flag("google-record-group-id", "Name of the zone to manage.").StringVar(&cfg.googleRecordGroupID)
+	kingpin.Flag("zonefile-dir", "The directory containing the zone files, named db.<origin>.").StringVar(&cfg.zonefileDir)
+	kingpin.Flag("zonefile-origin", "The origin of a zone file to manage, can be given several times.").StringsVar(&cfg.zonefileOrigins)
+	kingpin.Flag("zonefile-command", "A command to run after a zone file was written, e.g. rndc reload $MATE_ZONE.").StringVar(&cfg.zonefileCommand)
+	kingpin.Flag("zonefile-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.zonefileRecordGroupID)
+
+	kingpin.Flag("server-address", "The address to answer DNS queries on over UDP and TCP.").Default(":53").StringVar(&cfg.serverAddress)
+	kingpin.Flag("server-zone", "A zone to answer DNS queries for, can be given several times.").StringsVar(&cfg.serverZones)
+	kingpin.Flag("server-nameserver", "A name server announced in the NS records of the zones, can be given several times.").StringsVar(&cfg.serverNameServers)
+	kingpin.Flag("server-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.serverRecordGroupID)
+
+	kingpin.Flag("webhook-url", "The URL the endpoints are posted to as JSON.").StringVar(&cfg.webhookURL)
+	kingpin.Flag("webhook-secret", "The secret to sign the requests with, sent as HMAC-SHA256 in the X-Mate-Signature header.").StringVar(&cfg.webhookSecret)
+	kingpin.Flag("webhook-timeout", "The timeout of a single request to the webhook.").Default("10s").DurationVar(&cfg.webhookTimeout)
+	kingpin.Flag("webhook-retries", "How often to retry a failed request to the webhook.").Default("3").IntVar(&cfg.webhookRetries)
+	kingpin.Flag("webhook-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.webhookRecordGroupID)
+
+	kingpin.Flag("plugin-timeout", "The timeout of a single call to a consumer plugin given as --consumer=plugin:<addr>.").Default("30s").DurationVar(&cfg.pluginTimeout)
+	kingpin.Flag("plugin-record-group-id", "Identifier to filter mate created records").StringVar(&cfg.pluginRecordGroupID)
 
 	kingpin.Parse()
 }
 
 func (cfg *mateConfig) validate() error {
-	if cfg.consumer == "aws" && cfg.awsRecordGroupID == "" {
+	if cfg.hasConsumer("aws") && cfg.awsRecordGroupID == "" {
 		return errors.New("Missing aws record group id flag")
 	}
-	if cfg.consumer == "google" && cfg.googleRecordGroupID == "" {
+	if cfg.hasConsumer("google") && cfg.googleRecordGroupID == "" {
 		return errors.New("Missing google record group id flag")
 	}
+	if cfg.hasConsumer("google") && len(cfg.googleProjects) == 0 {
+		return errors.New("Missing google project flag")
+	}
+	if cfg.hasConsumer("rfc2136") && cfg.rfc2136RecordGroupID == "" {
+		return errors.New("Missing rfc2136 record group id flag")
+	}
+	if cfg.hasConsumer("powerdns") && cfg.powerDNSRecordGroupID == "" {
+		return errors.New("Missing powerdns record group id flag")
+	}
+	if cfg.hasConsumer("cloudflare") && cfg.cloudflareRecordGroupID == "" {
+		return errors.New("Missing cloudflare record group id flag")
+	}
+	if cfg.hasConsumer("azure") && cfg.azureRecordGroupID == "" {
+		return errors.New("Missing azure record group id flag")
+	}
+	if cfg.hasConsumer("etcd") && cfg.etcdRecordGroupID == "" {
+		return errors.New("Missing etcd record group id flag")
+	}
+	if cfg.hasConsumer("zonefile") && cfg.zonefileRecordGroupID == "" {
+		return errors.New("Missing zonefile record group id flag")
+	}
+	if cfg.hasConsumer("server") && cfg.serverRecordGroupID == "" {
+		return errors.New("Missing server record group id flag")
+	}
+	if cfg.hasConsumer("webhook") && cfg.webhookRecordGroupID == "" {
+		return errors.New("Missing webhook record group id flag")
+	}
+	if cfg.hasConsumer("plugin") && cfg.pluginRecordGroupID == "" {
+		return errors.New("Missing plugin record group id flag")
+	}
 	return nil
 }
+
+// hasConsumer returns whether the consumer is one of the configured ones,
+// consumers with an argument like plugin:<addr> are matched by their name
+func (cfg *mateConfig) hasConsumer(name string) bool {
+	for _, consumer := range strings.Split(cfg.consumer, ",") {
+		if consumer == name || strings.HasPrefix(consumer, name+":") {
+			return true
+		}
+	}
+	return false
+}
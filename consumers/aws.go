@@ -3,6 +3,7 @@ package consumers
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"strings"
 
@@ -20,27 +21,52 @@ type AWSClient interface {
 	ListRecordSets(zoneID string) ([]*route53.ResourceRecordSet, error)
 	ChangeRecordSets(upsert, del, create []*route53.ResourceRecordSet, zoneID string) error
 	GetCanonicalZoneIDs(lbDNS []string) (map[string]string, error) //get hosted zone ids for the LBs
-	GetHostedZones() (map[string]string, error)                    //get all route53 hosted zones for the account
+	GetHostedZones() ([]*awsclient.HostedZone, error)              //get all route53 hosted zones for the account
 }
 
 type awsConsumer struct {
-	groupID string
-	client  AWSClient
+	groupID  string
+	client   AWSClient
+	domains  []string
+	zoneIDs  []string
+	zoneType string
+}
+
+// AWSOptions configures the AWS consumer. All hosted zones of the account
+// are managed unless limited to the given domains, zone IDs or zone type
+// (public or private).
+type AWSOptions struct {
+	GroupID  string
+	Domains  []string
+	ZoneIDs  []string
+	ZoneType string
 }
 
 const (
 	evaluateTargetHealth = true
 	defaultTxtTTL        = int64(300)
 	defaultATTL          = int64(300)
+	defaultCNAMETTL      = int64(300)
 )
 
-// NewAWSRoute53Consumer reates a Consumer instance to sync and process DNS
+// NewAWSRoute53Consumer creates a Consumer instance to sync and process DNS
 // entries in AWS Route53.
-func NewAWSRoute53Consumer(awsRecordGroupID string) (Consumer, error) {
-	if awsRecordGroupID == "" {
+func NewAWSRoute53Consumer(cfg *AWSOptions) (Consumer, error) {
+	if cfg.GroupID == "" {
 		return nil, errors.New("please provide --aws-record-group-id")
 	}
-	return withClient(awsclient.New(awsclient.Options{}), awsRecordGroupID), nil
+
+	switch cfg.ZoneType {
+	case "", "public", "private":
+	default:
+		return nil, fmt.Errorf("invalid zone type %q, must be public or private", cfg.ZoneType)
+	}
+
+	consumer := withClient(awsclient.New(awsclient.Options{}), cfg.GroupID)
+	consumer.domains = cfg.Domains
+	consumer.zoneIDs = cfg.ZoneIDs
+	consumer.zoneType = cfg.ZoneType
+	return consumer, nil
 }
 
 func withClient(c AWSClient, groupID string) *awsConsumer {
@@ -50,50 +76,88 @@ func withClient(c AWSClient, groupID string) *awsConsumer {
 	}
 }
 
+//Sync changes the records of the selected hosted zones to the endpoints. Endpoints which can't be converted to
+//records are reported as errors after syncing the others, the existing records of their names are kept.
 func (a *awsConsumer) Sync(endpoints []*pkg.Endpoint) error {
-	kubeRecords, err := a.endpointsToRecords(endpoints)
+	var publicEndpoints, privateEndpoints []*pkg.Endpoint
+	for _, ep := range endpoints {
+		if ep.Private {
+			privateEndpoints = append(privateEndpoints, ep)
+		} else {
+			publicEndpoints = append(publicEndpoints, ep)
+		}
+	}
+
+	//public and private endpoints are converted separately so that records of the same name are neither merged nor
+	//placed into the zones of the other visibility
+	publicRecords, issues, err := a.endpointsToRecords(publicEndpoints)
+	if err != nil {
+		log.Errorf("failed to convert endpoints to RRS: %v. Aborting sync...", err)
+		return err
+	}
+	privateRecords, privateIssues, err := a.endpointsToRecords(privateEndpoints)
 	if err != nil {
 		log.Errorf("failed to convert endpoints to RRS: %v. Aborting sync...", err)
 		return err
 	}
+	for name, issue := range privateIssues {
+		issues[name] = issue
+	}
+	for _, issue := range issues {
+		log.Errorf("Skipping record: %v", issue)
+	}
 
-	hostedZonesMap, err := a.client.GetHostedZones()
+	hostedZones, err := a.client.GetHostedZones()
 	if err != nil {
 		return err
 	}
-	if len(hostedZonesMap) == 0 {
+	if len(hostedZones) == 0 {
 		log.Warnln("No hosted zones found in Route53. At least one hosted zone should be created to create DNS records...")
 		return nil
 	}
 
+	selectedZones := a.selectHostedZones(hostedZones)
+	hostedZonesMap, privateZonesMap := hostedZonesMaps(hostedZones)
+	selectedZonesMap, selectedPrivateZonesMap := hostedZonesMaps(selectedZones)
+
 	inputByZoneID := map[string][]*route53.ResourceRecordSet{}
-	for _, record := range kubeRecords {
-		zoneID := getZoneIDForEndpoint(hostedZonesMap, record) //this guarantees that the endpoint will not be created in multiple hosted zones
-		if zoneID == "" {
-			log.Warnf("Hosted zone for endpoint: %s was not found. Skipping record...", aws.StringValue(record.Name))
-			continue
+	addRecords := func(records []*route53.ResourceRecordSet, selectedMap, zonesMap map[string]string) {
+		for _, record := range records {
+			zoneID := getSelectedZoneID(selectedMap, zonesMap, record) //this guarantees that the endpoint will not be created in multiple hosted zones
+			if zoneID == "" {
+				continue
+			}
+			inputByZoneID[zoneID] = append(inputByZoneID[zoneID], record)
 		}
-		inputByZoneID[zoneID] = append(inputByZoneID[zoneID], record)
 	}
+	addRecords(publicRecords, selectedZonesMap, hostedZonesMap)
+	addRecords(privateRecords, selectedPrivateZonesMap, privateZonesMap)
 
 	var wg sync.WaitGroup
-	for zoneName, zoneID := range hostedZonesMap {
+	for _, zone := range selectedZones {
 		wg.Add(1)
 		go func(zoneName, zoneID string) {
 			defer wg.Done()
-			err := a.syncPerHostedZone(inputByZoneID[zoneID], zoneID)
+			err := a.syncPerHostedZone(inputByZoneID[zoneID], issues, zoneID)
 			if err != nil {
 				//should pass the err down the error channel
 				//for now just log
 				log.Errorf("Error changing records per zone: %s. Error: %v", zoneName, err)
 			}
-		}(zoneName, zoneID)
+		}(zone.Name, zone.ID)
 	}
 	wg.Wait()
-	return nil
+
+	errs := make([]error, 0, len(issues))
+	for _, name := range sortedIssueNames(issues) {
+		errs = append(errs, issues[name])
+	}
+	return combineErrors(errs)
 }
 
-func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet, zoneID string) error {
+//syncPerHostedZone changes the owned records of the zone to the kube records, records with issues are neither
+//changed nor deleted
+func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet, issues map[string]error, zoneID string) error {
 	existingRecords, err := a.client.ListRecordSets(zoneID)
 	if err != nil {
 		log.Errorf("failed to list records in zoneID: %s. Error: %v", zoneID, err)
@@ -102,7 +166,17 @@ func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet
 
 	recordInfoMap := a.recordInfo(existingRecords)
 
-	var upsert, del []*route53.ResourceRecordSet
+	existingByName := map[string]*route53.ResourceRecordSet{} // the A or CNAME record of a dns name
+	ownerByName := map[string]*route53.ResourceRecordSet{}    // the TXT record holding the group ID of a dns name
+	for _, record := range existingRecords {
+		if aws.StringValue(record.Type) == "TXT" {
+			ownerByName[recordOwnedName(record)] = record
+		} else {
+			existingByName[aws.StringValue(record.Name)] = record
+		}
+	}
+
+	var upsert, del, create []*route53.ResourceRecordSet
 	upsertedMap := make(map[string]bool) // keep track of records to be upserted
 	targetMap := map[string][]*string{}  // map dnsname -> list of targets
 	for _, kr := range kubeRecords {
@@ -129,6 +203,28 @@ func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet
 			continue
 		}
 
+		//a record can't be upserted with another type, Route53 requires to delete the Alias A or CNAME record and
+		//to create the new one in the same change batch
+		existingRecord := existingByName[aws.StringValue(kubeRecord.Name)]
+		if existingRecord != nil && aws.StringValue(existingRecord.Type) != aws.StringValue(kubeRecord.Type) {
+			del = append(del, existingRecord)
+			if owner := ownerByName[aws.StringValue(kubeRecord.Name)]; owner != nil {
+				del = append(del, owner)
+			}
+			create = append(create, kubeRecord, a.getAssignedTXTRecordObject(kubeRecord))
+			upsertedMap[aws.StringValue(kubeRecord.Name)] = true
+			continue
+		}
+
+		//records with values, i.e. IPs or a CNAME target, are replaced as soon as any of their values changed
+		if existingRecord != nil && existingRecord.AliasTarget == nil && kubeRecord.AliasTarget == nil {
+			if !sameRecordValues(existingRecord, kubeRecord) {
+				upsert = append(upsert, kubeRecord, a.getAssignedTXTRecordObject(kubeRecord))
+			}
+			upsertedMap[aws.StringValue(kubeRecord.Name)] = true
+			continue
+		}
+
 		//there exists a record in AWS Route53 with same DNS name and group id, but need to make sure that
 		//the alias load balancer is no longer used
 		kubeTargetsForDNS := targetMap[aws.StringValue(kubeRecord.Name)]
@@ -148,11 +244,15 @@ func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet
 
 	//find records to be removed
 	for _, existingRecord := range existingRecords {
-		recordInfo := recordInfoMap[aws.StringValue(existingRecord.Name)]
+		name := recordOwnedName(existingRecord) //the TXT record of a CNAME belongs to the CNAME
+		recordInfo := recordInfoMap[name]
+		if _, skipped := issues[name]; skipped {
+			continue
+		}
 		if recordInfo.GroupID == a.getGroupID() {
 			remove := true
 			for _, kubeRecord := range kubeRecords {
-				if pkg.SameDNSName(aws.StringValue(kubeRecord.Name), aws.StringValue(existingRecord.Name)) {
+				if pkg.SameDNSName(aws.StringValue(kubeRecord.Name), name) {
 					remove = false
 				}
 			}
@@ -162,10 +262,11 @@ func (a *awsConsumer) syncPerHostedZone(kubeRecords []*route53.ResourceRecordSet
 		}
 	}
 
-	if len(upsert) > 0 || len(del) > 0 {
+	if len(upsert) > 0 || len(del) > 0 || len(create) > 0 {
 		log.Debugln("Records to be upserted: ", upsert)
 		log.Debugln("Records to be deleted: ", del)
-		return a.client.ChangeRecordSets(upsert, del, nil, zoneID)
+		log.Debugln("Records to be created: ", create)
+		return a.client.ChangeRecordSets(upsert, del, create, zoneID)
 	}
 
 	log.Infoln("No changes submitted for zone: ", zoneID)
@@ -200,28 +301,57 @@ func (a *awsConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- erro
 }
 
 func (a *awsConsumer) Process(endpoint *pkg.Endpoint) error {
-	hostedZonesMap, err := a.client.GetHostedZones()
+	hostedZones, err := a.client.GetHostedZones()
 	if err != nil {
 		return err
 	}
 
-	ARecords, err := a.endpointsToRecords([]*pkg.Endpoint{endpoint})
+	hostedZonesMap, privateZonesMap := hostedZonesMaps(hostedZones)
+	selectedZonesMap, selectedPrivateZonesMap := hostedZonesMaps(a.selectHostedZones(hostedZones))
+	if endpoint.Private {
+		hostedZonesMap, selectedZonesMap = privateZonesMap, selectedPrivateZonesMap
+	}
+
+	ARecords, issues, err := a.endpointsToRecords([]*pkg.Endpoint{endpoint})
 	if err != nil {
 		log.Errorf("failed to convert endpoint to RRS: %v. Aborting process...", err)
 		return err
 	}
+	if issue, exists := issues[pkg.SanitizeDNSName(endpoint.DNSName)]; exists {
+		return issue
+	}
 	if len(ARecords) != 1 {
 		return fmt.Errorf("failed to process endpoint. A record could not be constructed for: %s:%s:%s", endpoint.DNSName, endpoint.Hostname, endpoint.IP)
 	}
 
 	create := []*route53.ResourceRecordSet{ARecords[0], a.getAssignedTXTRecordObject(ARecords[0])}
 
-	zoneID := getZoneIDForEndpoint(hostedZonesMap, ARecords[0])
+	zoneID := getSelectedZoneID(selectedZonesMap, hostedZonesMap, ARecords[0])
 	if zoneID == "" {
-		log.Warnf("Hosted zone for endpoint: %s was not found. Skipping record...", endpoint.DNSName)
 		return nil
 	}
 
+	//the addresses of an owned A record are merged with the new one, e.g. for services with several external IPs
+	if aws.StringValue(ARecords[0].Type) == "A" && ARecords[0].AliasTarget == nil {
+		existing, err := a.ownedARecord(zoneID, aws.StringValue(ARecords[0].Name))
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			merged := appendRecord([]*route53.ResourceRecordSet{{
+				Type:            existing.Type,
+				Name:            existing.Name,
+				TTL:             ARecords[0].TTL,
+				ResourceRecords: append([]*route53.ResourceRecord{}, existing.ResourceRecords...),
+			}}, ARecords[0])[0]
+			if sameRecordValues(existing, merged) && aws.Int64Value(existing.TTL) == aws.Int64Value(merged.TTL) {
+				log.Debugf("Record [name=%s] is up to date", endpoint.DNSName)
+				return nil
+			}
+			return a.client.ChangeRecordSets([]*route53.ResourceRecordSet{merged}, nil, nil, zoneID)
+		}
+	}
+
 	err = a.client.ChangeRecordSets(nil, nil, create, zoneID)
 	if err != nil && strings.Contains(err.Error(), "already exists") {
 		log.Warnf("Record [name=%s] could not be created, another record with same name already exists", endpoint.DNSName)
@@ -231,19 +361,154 @@ func (a *awsConsumer) Process(endpoint *pkg.Endpoint) error {
 	return err
 }
 
+//Records returns the endpoints of the records owned by the group in the selected hosted zones, alias records
+//point to the hostname of their target
+func (a *awsConsumer) Records() ([]*pkg.Endpoint, error) {
+	hostedZones, err := a.client.GetHostedZones()
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*pkg.Endpoint
+	for _, zone := range a.selectHostedZones(hostedZones) {
+		records, err := a.client.ListRecordSets(zone.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list records in zone %s: %v", zone.Name, err)
+		}
+
+		groupIDMap := a.groupIDInfo(records)
+		for _, record := range records {
+			if aws.StringValue(record.Type) == "TXT" || groupIDMap[aws.StringValue(record.Name)] != a.getGroupID() {
+				continue
+			}
+
+			if record.AliasTarget != nil {
+				endpoints = append(endpoints, &pkg.Endpoint{
+					DNSName:  aws.StringValue(record.Name),
+					Hostname: aws.StringValue(record.AliasTarget.DNSName),
+					Private:  zone.Private,
+				})
+				continue
+			}
+			if aws.StringValue(record.Type) == "CNAME" && len(record.ResourceRecords) > 0 {
+				endpoints = append(endpoints, &pkg.Endpoint{
+					DNSName:  aws.StringValue(record.Name),
+					Hostname: aws.StringValue(record.ResourceRecords[0].Value),
+					TTL:      aws.Int64Value(record.TTL),
+					Private:  zone.Private,
+				})
+				continue
+			}
+			for _, rr := range record.ResourceRecords {
+				endpoints = append(endpoints, &pkg.Endpoint{
+					DNSName: aws.StringValue(record.Name),
+					IP:      aws.StringValue(rr.Value),
+					TTL:     aws.Int64Value(record.TTL),
+					Private: zone.Private,
+				})
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+//hostedZonesMaps builds the maps from zone name to zone id used to find the zone of a record. Private records
+//are only placed into private zones, all other records into any zone preferring the public one if names clash
+func hostedZonesMaps(hostedZones []*awsclient.HostedZone) (all, private map[string]string) {
+	all = map[string]string{}
+	private = map[string]string{}
+	for _, zone := range hostedZones {
+		if zone.Private {
+			private[zone.Name] = zone.ID
+			if _, exist := all[zone.Name]; exist {
+				continue
+			}
+		}
+		all[zone.Name] = zone.ID
+	}
+	return all, private
+}
+
+//selectHostedZones returns the hosted zones managed by mate
+func (a *awsConsumer) selectHostedZones(hostedZones []*awsclient.HostedZone) []*awsclient.HostedZone {
+	var selected []*awsclient.HostedZone
+	for _, zone := range hostedZones {
+		if a.selectHostedZone(zone) {
+			selected = append(selected, zone)
+		}
+	}
+	return selected
+}
+
+//selectHostedZone returns whether mate manages the records of the zone
+func (a *awsConsumer) selectHostedZone(zone *awsclient.HostedZone) bool {
+	if len(a.zoneIDs) > 0 {
+		matches := false
+		for _, id := range a.zoneIDs {
+			if strings.TrimPrefix(id, "/hostedzone/") == strings.TrimPrefix(zone.ID, "/hostedzone/") {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	if len(a.domains) > 0 {
+		matches := false
+		for _, domain := range a.domains {
+			domain = pkg.SanitizeDNSName(domain)
+			if zone.Name == domain || strings.HasSuffix(zone.Name, "."+domain) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	switch a.zoneType {
+	case "public":
+		return !zone.Private
+	case "private":
+		return zone.Private
+	}
+	return true
+}
+
+//getSelectedZoneID returns the id of the selected zone of the record, empty if the record is skipped. Records of a
+//name whose best matching zone isn't selected are skipped rather than placed into a parent zone.
+func getSelectedZoneID(selectedZonesMap, hostedZonesMap map[string]string, record *route53.ResourceRecordSet) string {
+	zoneName := getZoneNameForEndpoint(hostedZonesMap, record)
+	if zoneName == "" {
+		log.Warnf("Hosted zone for endpoint: %s was not found. Skipping record...", aws.StringValue(record.Name))
+		return ""
+	}
+	if getZoneNameForEndpoint(selectedZonesMap, record) != zoneName {
+		log.Warnf("Hosted zone: %s of endpoint: %s is not managed by mate. Skipping record...", zoneName, aws.StringValue(record.Name))
+		return ""
+	}
+	return selectedZonesMap[zoneName]
+}
+
 //getZoneIDForEndpoint returns the zone id for the record based on its dns name, returns best match
 //i.e. if the record has dns name "test.sub.example.com" and route53 has two hosted zones "example.com" and "sub.example.com"
 //"sub.example.com" will be returned
 func getZoneIDForEndpoint(hostedZonesMap map[string]string, record *route53.ResourceRecordSet) string {
+	return hostedZonesMap[getZoneNameForEndpoint(hostedZonesMap, record)]
+}
+
+//getZoneNameForEndpoint returns the name of the best matching zone for the record, see getZoneIDForEndpoint
+func getZoneNameForEndpoint(hostedZonesMap map[string]string, record *route53.ResourceRecordSet) string {
 	var matchName string
-	var matchID string
-	for zoneName, zoneID := range hostedZonesMap {
+	for zoneName := range hostedZonesMap {
 		if strings.HasSuffix(aws.StringValue(record.Name), zoneName) && len(zoneName) > len(matchName) { //get the longest match for the dns name
 			matchName = zoneName
-			matchID = zoneID
 		}
 	}
-	return matchID
+	return matchName
 }
 
 //getGroupID returns the idenitifier for AWS records as stored in TXT records
@@ -251,11 +516,16 @@ func (a *awsConsumer) getGroupID() string {
 	return fmt.Sprintf("\"mate:%s\"", a.groupID)
 }
 
-//getAssignedTXTRecordObject returns the TXT record which accompanies the Alias record
+//getAssignedTXTRecordObject returns the TXT record which accompanies the Alias record. Since no other record can
+//exist next to a CNAME, the TXT record of a CNAME is kept at _mate.<name>
 func (a *awsConsumer) getAssignedTXTRecordObject(aliasRecord *route53.ResourceRecordSet) *route53.ResourceRecordSet {
+	name := aliasRecord.Name
+	if aws.StringValue(aliasRecord.Type) == "CNAME" {
+		name = aws.String(ownerName(aws.StringValue(aliasRecord.Name)))
+	}
 	return &route53.ResourceRecordSet{
 		Type: aws.String("TXT"),
-		Name: aliasRecord.Name,
+		Name: name,
 		TTL:  aws.Int64(defaultTxtTTL),
 		ResourceRecords: []*route53.ResourceRecord{{
 			Value: aws.String(a.getGroupID()),
@@ -263,6 +533,32 @@ func (a *awsConsumer) getAssignedTXTRecordObject(aliasRecord *route53.ResourceRe
 	}
 }
 
+//ownedARecord returns the plain A record of the name if the name is owned by the group, nil otherwise
+func (a *awsConsumer) ownedARecord(zoneID, name string) (*route53.ResourceRecordSet, error) {
+	records, err := a.client.ListRecordSets(zoneID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records in zoneID: %s. Error: %v", zoneID, err)
+	}
+	if a.groupIDInfo(records)[name] != a.getGroupID() {
+		return nil, nil
+	}
+	for _, record := range records {
+		if aws.StringValue(record.Name) == name && aws.StringValue(record.Type) == "A" && record.AliasTarget == nil {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+//recordOwnedName returns the dns name a record belongs to, which is the CNAME for TXT records at _mate.<name>
+func recordOwnedName(record *route53.ResourceRecordSet) string {
+	name := aws.StringValue(record.Name)
+	if aws.StringValue(record.Type) == "TXT" && isOwnerName(name) {
+		return ownedName(name)
+	}
+	return name
+}
+
 //groupIDInfo builds a map from dns name to its group ID
 func (a *awsConsumer) groupIDInfo(records []*route53.ResourceRecordSet) map[string]string {
 	groupIDMap := map[string]string{} //maps dns to group ID
@@ -270,10 +566,10 @@ func (a *awsConsumer) groupIDInfo(records []*route53.ResourceRecordSet) map[stri
 	for _, record := range records {
 		if aws.StringValue(record.Type) == "TXT" {
 			if len(record.ResourceRecords) > 0 {
-				groupIDMap[aws.StringValue(record.Name)] = aws.StringValue(record.ResourceRecords[0].Value)
+				groupIDMap[recordOwnedName(record)] = aws.StringValue(record.ResourceRecords[0].Value)
 			} else {
 				log.Errorf("Unexpected response from AWS API, got TXT record with empty resources: %s. Record is excluded from syncing", aws.StringValue(record.Name))
-				groupIDMap[aws.StringValue(record.Name)] = ""
+				groupIDMap[recordOwnedName(record)] = ""
 			}
 		} else {
 			if _, exist := groupIDMap[aws.StringValue(record.Name)]; !exist {
@@ -289,14 +585,15 @@ func (a *awsConsumer) recordInfo(records []*route53.ResourceRecordSet) map[strin
 	groupIDMap := a.groupIDInfo(records)
 	infoMap := map[string]*pkg.RecordInfo{} //maps record DNS to its GroupID (if exists) and Target (LB)
 	for _, record := range records {
-		groupID := groupIDMap[aws.StringValue(record.Name)]
-		if _, exist := infoMap[aws.StringValue(record.Name)]; !exist {
-			infoMap[aws.StringValue(record.Name)] = &pkg.RecordInfo{
+		name := recordOwnedName(record)
+		groupID := groupIDMap[name]
+		if _, exist := infoMap[name]; !exist {
+			infoMap[name] = &pkg.RecordInfo{
 				GroupID: groupID,
 			}
 		}
 		if aws.StringValue(record.Type) != "TXT" {
-			infoMap[aws.StringValue(record.Name)].Target = a.getRecordTarget(record) //sanitization not needed here, as per IP case
+			infoMap[name].Target = a.getRecordTarget(record) //sanitization not needed here, as per IP case
 		}
 	}
 
@@ -314,47 +611,111 @@ func (a *awsConsumer) getRecordTarget(r *route53.ResourceRecordSet) string {
 	return aws.StringValue(r.ResourceRecords[0].Value)
 }
 
-//endpointsToRecords converts pkg Endpoint to route53 A [Alias] Records depending whether IP/LB Hostname is used
-func (a *awsConsumer) endpointsToRecords(endpoints []*pkg.Endpoint) ([]*route53.ResourceRecordSet, error) {
+//endpointsToRecords converts pkg Endpoint to route53 A [Alias] or CNAME Records depending whether IP/LB Hostname is
+//used. Endpoints whose hostname is an AWS alias target without known canonical hosted zone id are returned as issues
+//by their sanitized dns name, other hostnames become CNAME records without looking up a canonical hosted zone id.
+func (a *awsConsumer) endpointsToRecords(endpoints []*pkg.Endpoint) ([]*route53.ResourceRecordSet, map[string]error, error) {
 	lbDNS := make([]string, 0, len(endpoints))
 	for _, endpoint := range endpoints {
-		if endpoint.Hostname != "" {
+		if endpoint.Hostname != "" && awsclient.IsAliasTarget(endpoint.Hostname) {
 			lbDNS = append(lbDNS, endpoint.Hostname)
 		}
 	}
 	zoneIDs, err := a.client.GetCanonicalZoneIDs(lbDNS)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var rset []*route53.ResourceRecordSet
+	issues := map[string]error{}
 
 	for _, ep := range endpoints {
 		if loadBalancerZoneID, exist := zoneIDs[ep.Hostname]; exist {
 			rset = append(rset, a.endpointToRecord(ep, aws.String(loadBalancerZoneID)))
-		} else if ep.IP != "" {
-			rset = append(rset, a.endpointToRecord(ep, aws.String("")))
+		} else if ep.IP != "" || !awsclient.IsAliasTarget(ep.Hostname) {
+			rset = appendRecord(rset, a.endpointToRecord(ep, nil))
 		} else {
-			return nil, fmt.Errorf("Canonical Zone ID for load balancer: %s was not found", ep.Hostname)
+			issues[pkg.SanitizeDNSName(ep.DNSName)] = fmt.Errorf("record %s: Canonical Zone ID for load balancer: %s was not found", ep.DNSName, ep.Hostname)
+		}
+	}
+	return rset, issues, nil
+}
+
+//appendRecord appends the record to the records. The addresses of an A record are merged into the A record of the
+//same name if there is one already, e.g. for services with several external IPs.
+func appendRecord(records []*route53.ResourceRecordSet, record *route53.ResourceRecordSet) []*route53.ResourceRecordSet {
+	if aws.StringValue(record.Type) != "A" || record.AliasTarget != nil {
+		return append(records, record)
+	}
+	for _, r := range records {
+		if aws.StringValue(r.Type) != "A" || r.AliasTarget != nil || aws.StringValue(r.Name) != aws.StringValue(record.Name) {
+			continue
 		}
+		for _, rr := range record.ResourceRecords {
+			if !containsString(recordValues(r), aws.StringValue(rr.Value)) {
+				r.ResourceRecords = append(r.ResourceRecords, rr)
+			}
+		}
+		return records
+	}
+	return append(records, record)
+}
+
+//recordValues returns the values of the resource records of the record
+func recordValues(record *route53.ResourceRecordSet) []string {
+	values := make([]string, 0, len(record.ResourceRecords))
+	for _, rr := range record.ResourceRecords {
+		values = append(values, aws.StringValue(rr.Value))
+	}
+	return values
+}
+
+//sameRecordValues returns whether the records have the same values regardless of their order
+func sameRecordValues(a, b *route53.ResourceRecordSet) bool {
+	valuesA, valuesB := recordValues(a), recordValues(b)
+	sort.Strings(valuesA)
+	sort.Strings(valuesB)
+	return strings.Join(valuesA, ",") == strings.Join(valuesB, ",")
+}
+
+func sortedIssueNames(issues map[string]error) []string {
+	names := make([]string, 0, len(issues))
+	for name := range issues {
+		names = append(names, name)
 	}
-	return rset, nil
+	sort.Strings(names)
+	return names
 }
 
 //endpointToRecord convert endpoint to an AWS A [Alias] record depending whether IP of LB hostname is used
-//if both are specified hostname takes precedence and Alias record is to be created
+//if both are specified hostname takes precedence and Alias record is to be created. Without canonical zone id
+//the hostname can't be aliased, a CNAME record is created unless an IP is given.
 func (a *awsConsumer) endpointToRecord(ep *pkg.Endpoint, canonicalZoneID *string) *route53.ResourceRecordSet {
 	rs := &route53.ResourceRecordSet{
 		Type: aws.String("A"),
 		Name: aws.String(pkg.SanitizeDNSName(ep.DNSName)),
 	}
-	if ep.Hostname != "" {
+	if ep.Hostname != "" && canonicalZoneID != nil {
 		rs.AliasTarget = &route53.AliasTarget{
 			DNSName:              aws.String(pkg.SanitizeDNSName(ep.Hostname)),
 			EvaluateTargetHealth: aws.Bool(evaluateTargetHealth),
 			HostedZoneId:         canonicalZoneID,
 		}
+	} else if ep.Hostname != "" && ep.IP == "" {
+		rs.Type = aws.String("CNAME")
+		rs.TTL = aws.Int64(defaultCNAMETTL)
+		if ep.TTL > 0 {
+			rs.TTL = aws.Int64(ep.TTL)
+		}
+		rs.ResourceRecords = []*route53.ResourceRecord{
+			&route53.ResourceRecord{
+				Value: aws.String(pkg.SanitizeDNSName(ep.Hostname)),
+			},
+		}
 	} else {
 		rs.TTL = aws.Int64(defaultATTL)
+		if ep.TTL > 0 {
+			rs.TTL = aws.Int64(ep.TTL)
+		}
 		rs.ResourceRecords = []*route53.ResourceRecord{
 			&route53.ResourceRecord{
 				Value: aws.String(ep.IP),
@@ -2,11 +2,13 @@ package consumers
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/zalando-incubator/mate/pkg"
+	awsclient "github.com/zalando-incubator/mate/pkg/aws"
 	awstest "github.com/zalando-incubator/mate/pkg/aws/test"
 )
 
@@ -31,7 +33,7 @@ func TestEndpointToRecord(t *testing.T) {
 	ep := &pkg.Endpoint{
 		DNSName:  "example.com",
 		IP:       "10.202.10.123",
-		Hostname: "amazon.elb.com",
+		Hostname: "amazon.eu-central-1.elb.amazonaws.com",
 	}
 	rsA := client.endpointToRecord(ep, &zoneID)
 	if *rsA.Type != "A" || *rsA.Name != pkg.SanitizeDNSName(ep.DNSName) ||
@@ -52,7 +54,7 @@ func TestEndpointToRecord(t *testing.T) {
 	//only Hostname specified -> Alias Record
 	ep = &pkg.Endpoint{
 		DNSName:  "example.com",
-		Hostname: "amazon.elb.com",
+		Hostname: "amazon.eu-central-1.elb.amazonaws.com",
 	}
 	rsA = client.endpointToRecord(ep, &zoneID)
 	if *rsA.Type != "A" || *rsA.Name != pkg.SanitizeDNSName(ep.DNSName) ||
@@ -71,7 +73,7 @@ func TestGetAssignedTXTRecordObject(t *testing.T) {
 	ep := &pkg.Endpoint{
 		DNSName:  "example.com",
 		IP:       "10.202.10.123",
-		Hostname: "amazon.elb.com",
+		Hostname: "amazon.eu-central-1.elb.amazonaws.com",
 	}
 	rsA := client.endpointToRecord(ep, &zoneID)
 	rsTXT := client.getAssignedTXTRecordObject(rsA)
@@ -137,7 +139,7 @@ func TestGroupIDInfo(t *testing.T) {
 			Type: aws.String("A"),
 			Name: aws.String("test.example.com."),
 			AliasTarget: &route53.AliasTarget{
-				DNSName:      aws.String("abc.def.ghi."),
+				DNSName:      aws.String("def.eu-west-1.elb.amazonaws.com."),
 				HostedZoneId: aws.String("123"),
 			},
 		},
@@ -215,7 +217,7 @@ func TestRecordInfo(t *testing.T) {
 			Type: aws.String("A"),
 			Name: aws.String("test.example.com."),
 			AliasTarget: &route53.AliasTarget{
-				DNSName:      aws.String("abc.def.ghi."),
+				DNSName:      aws.String("def.eu-west-1.elb.amazonaws.com."),
 				HostedZoneId: aws.String("123"),
 			},
 		},
@@ -249,7 +251,7 @@ func TestRecordInfo(t *testing.T) {
 		if val.GroupID != client.getGroupID() {
 			t.Errorf("Incorrect record info for %v", records)
 		}
-		if !sameTargets("abc.def.ghi.", val.Target) {
+		if !sameTargets("def.eu-west-1.elb.amazonaws.com.", val.Target) {
 			t.Errorf("Incorrect record info for %v", records)
 		}
 	}
@@ -318,7 +320,7 @@ func TestRecordInfo(t *testing.T) {
 			Type: aws.String("A"),
 			Name: aws.String("new.example.com."),
 			AliasTarget: &route53.AliasTarget{
-				DNSName:      aws.String("elb.com."),
+				DNSName:      aws.String("lb.eu-central-1.elb.amazonaws.com."),
 				HostedZoneId: aws.String("123"),
 			},
 		},
@@ -335,7 +337,7 @@ func TestRecordInfo(t *testing.T) {
 			Type: aws.String("A"),
 			Name: aws.String("test.example.com."),
 			AliasTarget: &route53.AliasTarget{
-				DNSName:      aws.String("abc.def.ghi."),
+				DNSName:      aws.String("def.eu-west-1.elb.amazonaws.com."),
 				HostedZoneId: aws.String("123"),
 			},
 		},
@@ -359,7 +361,7 @@ func TestRecordInfo(t *testing.T) {
 		if val.GroupID != client.getGroupID() {
 			t.Errorf("Incorrect record info for %v", records)
 		}
-		if !sameTargets("abc.def.ghi.", val.Target) {
+		if !sameTargets("def.eu-west-1.elb.amazonaws.com.", val.Target) {
 			t.Errorf("Incorrect record info for %v", records)
 		}
 	}
@@ -369,7 +371,7 @@ func TestRecordInfo(t *testing.T) {
 		if val.GroupID != "mate:new-group-id" {
 			t.Errorf("Incorrect record info for %v", records)
 		}
-		if !sameTargets("elb.com.", val.Target) {
+		if !sameTargets("lb.eu-central-1.elb.amazonaws.com.", val.Target) {
 			t.Errorf("Incorrect record info for %v", records)
 		}
 	}
@@ -394,7 +396,7 @@ func TestGetRecordTarget(t *testing.T) {
 		Type: aws.String("A"),
 		Name: aws.String("another.example.com."),
 		AliasTarget: &route53.AliasTarget{
-			DNSName:      aws.String("200.elb.com"),
+			DNSName:      aws.String("200.eu-central-1.elb.amazonaws.com"),
 			HostedZoneId: aws.String("123"),
 		},
 	}
@@ -417,8 +419,8 @@ func TestGetRecordTarget(t *testing.T) {
 		},
 	}
 
-	if target := client.getRecordTarget(r1); target != "200.elb.com" {
-		t.Errorf("Incorrect target extracted for %v, expected: %s, got: %s", r1, "200.elb.com", target)
+	if target := client.getRecordTarget(r1); target != "200.eu-central-1.elb.amazonaws.com" {
+		t.Errorf("Incorrect target extracted for %v, expected: %s, got: %s", r1, "200.eu-central-1.elb.amazonaws.com", target)
 	}
 	if target := client.getRecordTarget(r2); target != "" {
 		t.Errorf("Incorrect target extracted for %v, expected: %s, got: %s", r2, "", target)
@@ -510,22 +512,22 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 			msg: "two new fighting services",
 			sync: []*pkg.Endpoint{
 				{
-					"test.example.com", "", "301.elb.com",
+					DNSName: "test.example.com", IP: "", Hostname: "301.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"test.example.com", "", "401.elb.com",
+					DNSName: "test.example.com", IP: "", Hostname: "401.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"update.example.com", "", "elb.com",
+					DNSName: "update.example.com", IP: "", Hostname: "lb.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"withouttxt.example.com", "", "random.com",
+					DNSName: "withouttxt.example.com", IP: "", Hostname: "random.com",
 				},
 				{
-					"nest.sub.example.com", "", "nested.elb",
+					DNSName: "nest.sub.example.com", IP: "", Hostname: "nested.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"ip.sub.example.com", "192.168.0.1", "",
+					DNSName: "ip.sub.example.com", IP: "192.168.0.1", Hostname: "",
 				},
 			},
 			expectUpsert: map[string][]*route53.ResourceRecordSet{
@@ -534,7 +536,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("nest.sub.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("nested.elb"),
+							DNSName:      aws.String("nested.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -561,7 +563,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("test.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("301.elb.com"),
+							DNSName:      aws.String("301.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -573,7 +575,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("elb.com"),
+							DNSName:      aws.String("lb.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -602,7 +604,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -617,19 +619,19 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 			msg: "two fighting services, one old, one new",
 			sync: []*pkg.Endpoint{
 				{
-					"test.example.com", "", "302.elb.com",
+					DNSName: "test.example.com", IP: "", Hostname: "302.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"test.example.com", "", "404.elb.com",
+					DNSName: "test.example.com", IP: "", Hostname: "404.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"update.example.com", "", "elb.com",
+					DNSName: "update.example.com", IP: "", Hostname: "lb.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"withouttxt.example.com", "", "random.com",
+					DNSName: "withouttxt.example.com", IP: "", Hostname: "random.com",
 				},
 				{
-					"nest.sub.example.com", "", "nested.elb",
+					DNSName: "nest.sub.example.com", IP: "", Hostname: "nested.eu-central-1.elb.amazonaws.com",
 				},
 			},
 			expectUpsert: map[string][]*route53.ResourceRecordSet{
@@ -638,7 +640,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("nest.sub.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("nested.elb"),
+							DNSName:      aws.String("nested.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -652,7 +654,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("elb.com"),
+							DNSName:      aws.String("lb.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -681,7 +683,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -696,16 +698,16 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 			msg: "partial overlap",
 			sync: []*pkg.Endpoint{
 				{
-					"test.example.com", "", "404.elb.com",
+					DNSName: "test.example.com", IP: "", Hostname: "404.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"update.example.com", "", "elb.com",
+					DNSName: "update.example.com", IP: "", Hostname: "lb.eu-central-1.elb.amazonaws.com",
 				},
 				{
-					"withouttxt.example.com", "", "random.com",
+					DNSName: "withouttxt.example.com", IP: "", Hostname: "random.com",
 				},
 				{
-					"nest.sub.example.com", "", "nested.elb",
+					DNSName: "nest.sub.example.com", IP: "", Hostname: "nested.eu-central-1.elb.amazonaws.com",
 				},
 			},
 			expectUpsert: map[string][]*route53.ResourceRecordSet{
@@ -714,7 +716,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("nest.sub.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("nested.elb"),
+							DNSName:      aws.String("nested.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -728,7 +730,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("elb.com"),
+							DNSName:      aws.String("lb.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -757,7 +759,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -771,9 +773,9 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 		{
 			msg: "no initial, sync new ones",
 			sync: []*pkg.Endpoint{{
-				"test.example.com", "", "abc.def.ghi",
+				DNSName: "test.example.com", IP: "", Hostname: "def.eu-west-1.elb.amazonaws.com",
 			}, {
-				"withouttxt.example.com", "", "random.com",
+				DNSName: "withouttxt.example.com", IP: "", Hostname: "random.com",
 			}},
 			expectUpsert: map[string][]*route53.ResourceRecordSet{
 				"example.com.": []*route53.ResourceRecordSet{
@@ -781,7 +783,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("test.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("abc.def.ghi"),
+							DNSName:      aws.String("def.eu-west-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -797,7 +799,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("302.elb.com"),
+							DNSName:      aws.String("302.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -824,7 +826,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -838,9 +840,9 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 		{
 			msg: "sync delete all",
 			sync: []*pkg.Endpoint{{
-				"another.example.com", "", "abc.def.ghi",
+				DNSName: "another.example.com", IP: "", Hostname: "def.eu-west-1.elb.amazonaws.com",
 			}, {
-				"cname.example.com", "", "hello.elb.com",
+				DNSName: "cname.example.com", IP: "", Hostname: "hello.eu-central-1.elb.amazonaws.com",
 			}},
 			expectDelete: map[string][]*route53.ResourceRecordSet{
 				"example.com.": []*route53.ResourceRecordSet{
@@ -848,7 +850,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("test.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -860,7 +862,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("302.elb.com"),
+							DNSName:      aws.String("302.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -887,7 +889,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("404.elb.com"),
+							DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -900,13 +902,13 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 		}, {
 			msg: "insert, update, delete, leave",
 			sync: []*pkg.Endpoint{{
-				"new.example.com", "", "qux.elb",
+				DNSName: "new.example.com", IP: "", Hostname: "qux.eu-central-1.elb.amazonaws.com",
 			}, {
-				"test.example.com", "", "foo.elb2",
+				DNSName: "test.example.com", IP: "", Hostname: "foo.us-east-1.elb.amazonaws.com",
 			}, {
-				"test.foo.com", "", "foo.loadbalancer", //skip it
+				DNSName: "test.foo.com", IP: "", Hostname: "foo.eu-west-1.elb.amazonaws.com", //skip it
 			}, {
-				"update.foo.com", "", "new.loadbalancer",
+				DNSName: "update.foo.com", IP: "", Hostname: "new.eu-west-1.elb.amazonaws.com",
 			}},
 			expectUpsert: map[string][]*route53.ResourceRecordSet{
 				"foo.com.": []*route53.ResourceRecordSet{
@@ -914,7 +916,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.foo.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("new.loadbalancer"),
+							DNSName:      aws.String("new.eu-west-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -928,7 +930,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("test.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("foo.elb2"),
+							DNSName:      aws.String("foo.us-east-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -940,7 +942,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("new.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("qux.elb"),
+							DNSName:      aws.String("qux.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -956,7 +958,7 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 						Type: aws.String("A"),
 						Name: aws.String("update.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("302.elb.com"),
+							DNSName:      aws.String("302.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -983,14 +985,14 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 			},
 		}, {
 			msg:     "process new",
-			process: &pkg.Endpoint{DNSName: "process.example.com.", Hostname: "cool.elb"},
+			process: &pkg.Endpoint{DNSName: "process.example.com.", Hostname: "cool.eu-central-1.elb.amazonaws.com"},
 			expectCreate: map[string][]*route53.ResourceRecordSet{
 				"example.com.": []*route53.ResourceRecordSet{
 					&route53.ResourceRecordSet{
 						Type: aws.String("A"),
 						Name: aws.String("process.example.com."),
 						AliasTarget: &route53.AliasTarget{
-							DNSName:      aws.String("cool.elb"),
+							DNSName:      aws.String("cool.eu-central-1.elb.amazonaws.com"),
 							HostedZoneId: aws.String("123"),
 						},
 					},
@@ -1027,3 +1029,445 @@ func TestAWSConsumer(t *testing.T) { //exclude IP endpoints for now only Alias w
 		})
 	}
 }
+
+func TestHostedZonesMaps(t *testing.T) {
+	hostedZones := []*awsclient.HostedZone{
+		{ID: "id1", Name: "example.com."},
+		{ID: "id2", Name: "example.com.", Private: true},
+		{ID: "id3", Name: "internal.example.com.", Private: true},
+	}
+	all, private := hostedZonesMaps(hostedZones)
+	if len(all) != 2 || all["example.com."] != "id1" || all["internal.example.com."] != "id3" {
+		t.Errorf("Incorrect zones map for %v: %v", hostedZones, all)
+	}
+	if len(private) != 2 || private["example.com."] != "id2" || private["internal.example.com."] != "id3" {
+		t.Errorf("Incorrect private zones map for %v: %v", hostedZones, private)
+	}
+}
+
+func TestAWSConsumerPrivateZones(t *testing.T) {
+	groupID := "testing-group-id"
+
+	client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+	client.PrivateHostedZones = map[string]string{"example.com.": "private.example.com."}
+
+	consumer := withClient(client, groupID)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "public.example.com", Hostname: "abc.eu-central-1.elb.amazonaws.com"},
+		{DNSName: "private.example.com", IP: "10.0.0.1", Private: true},
+		{DNSName: "private.foo.com", IP: "10.0.0.2", Private: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.LastUpsert["example.com."]) != 2 || *client.LastUpsert["example.com."][0].Name != "public.example.com." {
+		t.Error("Public record should be upserted into the public zone", client.LastUpsert["example.com."])
+	}
+	if len(client.LastUpsert["private.example.com."]) != 2 || *client.LastUpsert["private.example.com."][0].Name != "private.example.com." {
+		t.Error("Private record should be upserted into the private zone", client.LastUpsert["private.example.com."])
+	}
+	if len(client.LastUpsert["foo.com."]) != 0 {
+		t.Error("Private record must not be upserted into a public zone", client.LastUpsert["foo.com."])
+	}
+
+	err = consumer.Process(&pkg.Endpoint{DNSName: "process.example.com", IP: "10.0.0.3", Private: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.LastCreate["private.example.com."]) != 2 || *client.LastCreate["private.example.com."][0].Name != "process.example.com." {
+		t.Error("Private record should be created in the private zone", client.LastCreate["private.example.com."])
+	}
+	if len(client.LastCreate["example.com."]) != 0 {
+		t.Error("Private record must not be created in a public zone", client.LastCreate["example.com."])
+	}
+}
+
+func TestAWSConsumerPrivateAndPublicSameName(t *testing.T) {
+	groupID := "testing-group-id"
+
+	client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+	client.PrivateHostedZones = map[string]string{"example.com.": "private.example.com."}
+
+	consumer := withClient(client, groupID)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "both.example.com", IP: "1.2.3.4"},
+		{DNSName: "both.example.com", IP: "10.0.0.1", Private: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public := client.LastUpsert["example.com."]
+	if len(public) != 2 || *public[0].Name != "both.example.com." || len(public[0].ResourceRecords) != 1 || *public[0].ResourceRecords[0].Value != "1.2.3.4" {
+		t.Error("Public record should be upserted into the public zone", public)
+	}
+	private := client.LastUpsert["private.example.com."]
+	if len(private) != 2 || *private[0].Name != "both.example.com." || len(private[0].ResourceRecords) != 1 || *private[0].ResourceRecords[0].Value != "10.0.0.1" {
+		t.Error("Private record should be upserted into the private zone", private)
+	}
+}
+
+func TestAWSConsumerSelectSameNameZone(t *testing.T) {
+	groupID := "testing-group-id"
+
+	for _, test := range []struct {
+		msg     string
+		zoneIDs []string
+		typ     string
+	}{
+		{"private zones", nil, "private"},
+		{"by zone id", []string{"private.example.com."}, ""},
+	} {
+		client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+		client.PrivateHostedZones = map[string]string{"example.com.": "private.example.com."}
+
+		consumer := withClient(client, groupID)
+		consumer.zoneIDs = test.zoneIDs
+		consumer.zoneType = test.typ
+
+		if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "sync.example.com", IP: "10.0.0.1"}}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.msg, err)
+		}
+		if err := consumer.Process(&pkg.Endpoint{DNSName: "process.example.com", IP: "10.0.0.2"}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.msg, err)
+		}
+
+		// the selected private zone is used although the public one has the same name
+		if upsert := client.LastUpsert["private.example.com."]; len(upsert) != 2 || aws.StringValue(upsert[0].Name) != "sync.example.com." {
+			t.Errorf("%s: expected the synced record in the private zone, got %v", test.msg, upsert)
+		}
+		if create := client.LastCreate["private.example.com."]; len(create) != 2 || aws.StringValue(create[0].Name) != "process.example.com." {
+			t.Errorf("%s: expected the processed record in the private zone, got %v", test.msg, create)
+		}
+		if len(client.LastUpsert["example.com."]) != 0 || len(client.LastCreate["example.com."]) != 0 {
+			t.Errorf("%s: expected no changes in the public zone, got %v %v", test.msg, client.LastUpsert, client.LastCreate)
+		}
+	}
+}
+
+func TestAWSConsumerUnknownAliasTargets(t *testing.T) {
+	groupID := "testing-group-id"
+	client := awstest.NewClient(groupID, awstest.GetOriginalState(fmt.Sprintf("\"mate:%s\"", groupID)), awstest.GetHostedZones())
+	client.CanonicalZoneIDs = map[string]string{"new.eu-central-1.elb.amazonaws.com": "Z215JYRZR1TBD5"}
+
+	consumer := withClient(client, groupID)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "new.foo.com", Hostname: "new.eu-central-1.elb.amazonaws.com"},
+		{DNSName: "update.foo.com", Hostname: "unknown-1234.xx-north-9.elb.amazonaws.com"},
+	})
+	if err == nil || err.Error() != "record update.foo.com: Canonical Zone ID for load balancer: unknown-1234.xx-north-9.elb.amazonaws.com was not found" {
+		t.Errorf("expected an error for the unknown alias target, got %v", err)
+	}
+
+	if upsert := client.LastUpsert["foo.com."]; len(upsert) != 2 || aws.StringValue(upsert[0].Name) != "new.foo.com." {
+		t.Errorf("expected the other records to be synced, got %v", upsert)
+	}
+	for _, record := range client.LastDelete["foo.com."] {
+		if aws.StringValue(record.Name) == "update.foo.com." {
+			t.Errorf("expected the record of the unknown alias target to be kept, got %v", client.LastDelete["foo.com."])
+		}
+	}
+	if len(client.LastDelete["foo.com."]) != 2 {
+		t.Errorf("expected public-ip.foo.com to be deleted, got %v", client.LastDelete["foo.com."])
+	}
+
+	err = consumer.Process(&pkg.Endpoint{DNSName: "process.foo.com", Hostname: "unknown-1234.xx-north-9.elb.amazonaws.com"})
+	if err == nil {
+		t.Error("expected an error for the unknown alias target")
+	}
+	if len(client.LastCreate["foo.com."]) != 0 {
+		t.Errorf("expected no records to be created, got %v", client.LastCreate["foo.com."])
+	}
+}
+
+func TestAWSConsumerCNAME(t *testing.T) {
+	groupID := "testing-group-id"
+	owner := fmt.Sprintf("\"mate:%s\"", groupID)
+	client := awstest.NewClient(groupID, awstest.GetOriginalState(owner), awstest.GetHostedZones())
+	client.CanonicalZoneIDs = map[string]string{"404.eu-central-1.elb.amazonaws.com": "Z215JYRZR1TBD5"}
+
+	consumer := withClient(client, groupID)
+
+	// the alias record is replaced by a CNAME in the same change batch
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "update.foo.com", Hostname: "cdn.example.net", TTL: 60},
+		{DNSName: "public-ip.foo.com", IP: "127.0.0.1"},
+		{DNSName: "new.foo.com", Hostname: "ingress.example.net"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectCNAME := &route53.ResourceRecordSet{
+		Type: aws.String("CNAME"),
+		Name: aws.String("update.foo.com."),
+		TTL:  aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{
+			{Value: aws.String("cdn.example.net.")},
+		},
+	}
+	expectCNAMEOwner := &route53.ResourceRecordSet{
+		Type: aws.String("TXT"),
+		Name: aws.String("_mate.update.foo.com."),
+		TTL:  aws.Int64(defaultTxtTTL),
+		ResourceRecords: []*route53.ResourceRecord{
+			{Value: aws.String(owner)},
+		},
+	}
+	alias := client.Current["foo.com."][3]
+	aliasOwner := client.Current["foo.com."][4]
+
+	if !checkEndpointSlices(client.LastDelete["foo.com."], []*route53.ResourceRecordSet{alias, aliasOwner}) {
+		t.Error("expected the alias record and its owner to be deleted", client.LastDelete["foo.com."])
+	}
+	if !checkEndpointSlices(client.LastCreate["foo.com."], []*route53.ResourceRecordSet{expectCNAME, expectCNAMEOwner}) {
+		t.Error("expected the CNAME and its owner to be created", client.LastCreate["foo.com."])
+	}
+	upsert := client.LastUpsert["foo.com."]
+	if len(upsert) != 2 || aws.StringValue(upsert[0].Type) != "CNAME" || aws.StringValue(upsert[1].Name) != "_mate.new.foo.com." {
+		t.Error("expected a new CNAME with its owner at _mate.new.foo.com", upsert)
+	}
+
+	// the CNAME is recognized as owned and replaced by an alias record again
+	client.Current["foo.com."] = []*route53.ResourceRecordSet{expectCNAME, expectCNAMEOwner}
+	client.LastCreate = map[string][]*route53.ResourceRecordSet{}
+	client.LastDelete = map[string][]*route53.ResourceRecordSet{}
+	client.LastUpsert = map[string][]*route53.ResourceRecordSet{}
+
+	records, err := consumer.Records()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var cname *pkg.Endpoint
+	for _, record := range records {
+		if record.DNSName == "update.foo.com." {
+			cname = record
+		}
+	}
+	if cname == nil || cname.Hostname != "cdn.example.net." || cname.TTL != 60 {
+		t.Errorf("expected the CNAME to be listed, got %v", cname)
+	}
+
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "update.foo.com", Hostname: "cdn.example.net", TTL: 60}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastCreate["foo.com."]) != 0 || len(client.LastDelete["foo.com."]) != 0 || len(client.LastUpsert["foo.com."]) != 0 {
+		t.Error("expected no changes for the CNAME in place", client.LastCreate, client.LastDelete, client.LastUpsert)
+	}
+
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "update.foo.com", Hostname: "404.eu-central-1.elb.amazonaws.com"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !checkEndpointSlices(client.LastDelete["foo.com."], []*route53.ResourceRecordSet{expectCNAME, expectCNAMEOwner}) {
+		t.Error("expected the CNAME and its owner to be deleted", client.LastDelete["foo.com."])
+	}
+	create := client.LastCreate["foo.com."]
+	if len(create) != 2 || create[0].AliasTarget == nil || aws.StringValue(create[1].Name) != "update.foo.com." {
+		t.Error("expected the alias record and its owner to be created", create)
+	}
+}
+
+func TestAWSConsumerCNAMELookup(t *testing.T) {
+	groupID := "testing-group-id"
+	client := awstest.NewClient(groupID, awstest.GetOriginalState(fmt.Sprintf("\"mate:%s\"", groupID)), awstest.GetHostedZones())
+
+	consumer := withClient(client, groupID)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "update.foo.com", Hostname: "cdn.example.net"},
+		{DNSName: "new.foo.com", Hostname: "new.eu-central-1.elb.amazonaws.com"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LookedUp) != 1 || client.LookedUp[0] != "new.eu-central-1.elb.amazonaws.com" {
+		t.Errorf("expected only the load balancer to be looked up, got %v", client.LookedUp)
+	}
+}
+
+func TestAWSConsumerZoneSelection(t *testing.T) {
+	groupID := "testing-group-id"
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "new.foo.com", IP: "127.0.0.1"},
+		{DNSName: "new.example.com", IP: "127.0.0.2"},
+		{DNSName: "new.sub.example.com", IP: "127.0.0.3"},
+		{DNSName: "private.example.com", IP: "10.0.0.1", Private: true},
+	}
+
+	for _, test := range []struct {
+		msg     string
+		domains []string
+		zoneIDs []string
+		typ     string
+		expect  []string
+	}{
+		{"all zones", nil, nil, "", []string{"example.com.", "foo.com.", "private.example.com.", "sub.example.com."}},
+		{"by domain", []string{"example.com"}, nil, "", []string{"example.com.", "private.example.com.", "sub.example.com."}},
+		{"by subdomain", []string{"sub.example.com."}, nil, "", []string{"sub.example.com."}},
+		{"by zone id", nil, []string{"/hostedzone/foo.com.", "sub.example.com."}, "", []string{"foo.com.", "sub.example.com."}},
+		{"public zones", nil, nil, "public", []string{"example.com.", "foo.com.", "sub.example.com."}},
+		{"private zones", nil, nil, "private", []string{"private.example.com."}},
+		{"domain and type", []string{"example.com"}, nil, "private", []string{"private.example.com."}},
+	} {
+		client := awstest.NewClient(groupID, awstest.GetOriginalState(fmt.Sprintf("\"mate:%s\"", groupID)), awstest.GetHostedZones())
+		client.PrivateHostedZones = map[string]string{"example.com.": "private.example.com."}
+
+		consumer := withClient(client, groupID)
+		consumer.domains = test.domains
+		consumer.zoneIDs = test.zoneIDs
+		consumer.zoneType = test.typ
+
+		if err := consumer.Sync(endpoints); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.msg, err)
+		}
+
+		var changed []string
+		for _, zone := range []string{"example.com.", "foo.com.", "private.example.com.", "sub.example.com."} {
+			if len(client.LastUpsert[zone]) > 0 || len(client.LastDelete[zone]) > 0 || len(client.LastCreate[zone]) > 0 {
+				changed = append(changed, zone)
+			}
+		}
+		if fmt.Sprint(changed) != fmt.Sprint(test.expect) {
+			t.Errorf("%s: expected changes in %v, got %v", test.msg, test.expect, changed)
+		}
+
+		records, err := consumer.Records()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.msg, err)
+		}
+		for _, record := range records {
+			if test.typ == "private" && !record.Private || len(test.domains) > 0 && !strings.HasSuffix(record.DNSName, "example.com.") {
+				t.Errorf("%s: unexpected record of an unselected zone: %v", test.msg, record)
+			}
+		}
+	}
+
+	// a record isn't placed into the parent zone of an unselected zone
+	client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+	consumer := withClient(client, groupID)
+	consumer.zoneIDs = []string{"example.com."}
+
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "process.sub.example.com", IP: "127.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastCreate) != 0 {
+		t.Errorf("expected no records to be created, got %v", client.LastCreate)
+	}
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "process.example.com", IP: "127.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastCreate["example.com."]) != 2 {
+		t.Errorf("expected the record to be created in the selected zone, got %v", client.LastCreate)
+	}
+}
+
+func TestAWSConsumerMultipleIPs(t *testing.T) {
+	groupID := "testing-group-id"
+	client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+	consumer := withClient(client, groupID)
+
+	// e.g. a service with two external IPs
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "multi.foo.com", IP: "10.0.0.1"},
+		{DNSName: "multi.foo.com", IP: "10.0.0.2"},
+		{DNSName: "multi.foo.com", IP: "10.0.0.1"},
+	}
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	upsert := client.LastUpsert["foo.com."]
+	if len(upsert) != 2 || aws.StringValue(upsert[0].Type) != "A" || fmt.Sprint(recordValues(upsert[0])) != "[10.0.0.1 10.0.0.2]" {
+		t.Fatalf("expected a single A record with both IPs, got %v", upsert)
+	}
+
+	// the record in place doesn't cause any changes, regardless of the order
+	client.Current["foo.com."] = []*route53.ResourceRecordSet{
+		{
+			Type: aws.String("A"),
+			Name: aws.String("multi.foo.com."),
+			TTL:  aws.Int64(defaultATTL),
+			ResourceRecords: []*route53.ResourceRecord{
+				{Value: aws.String("10.0.0.2")},
+				{Value: aws.String("10.0.0.1")},
+			},
+		},
+		upsert[1],
+	}
+	client.LastUpsert = map[string][]*route53.ResourceRecordSet{}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastUpsert["foo.com."]) != 0 || len(client.LastDelete["foo.com."]) != 0 {
+		t.Errorf("expected no changes, got upserts %v and deletes %v", client.LastUpsert["foo.com."], client.LastDelete["foo.com."])
+	}
+
+	// a changed IP replaces the record, even though the other one is still in place
+	if err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "multi.foo.com", IP: "10.0.0.1"},
+		{DNSName: "multi.foo.com", IP: "10.0.0.3"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	upsert = client.LastUpsert["foo.com."]
+	if len(upsert) != 2 || fmt.Sprint(recordValues(upsert[0])) != "[10.0.0.1 10.0.0.3]" {
+		t.Errorf("expected the A record to be replaced, got %v", upsert)
+	}
+}
+
+func TestAWSConsumerProcessMultipleIPs(t *testing.T) {
+	groupID := "testing-group-id"
+	client := awstest.NewClient(groupID, map[string][]*route53.ResourceRecordSet{}, awstest.GetHostedZones())
+	consumer := withClient(client, groupID)
+
+	// the first IP of a service with two external IPs creates the records
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "multi.foo.com", IP: "10.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	create := client.LastCreate["foo.com."]
+	if len(create) != 2 || fmt.Sprint(recordValues(create[0])) != "[10.0.0.1]" {
+		t.Fatalf("expected the A and TXT records to be created, got %v", create)
+	}
+	client.Current["foo.com."] = create
+
+	// the second one is added to the owned record
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "multi.foo.com", IP: "10.0.0.2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	upsert := client.LastUpsert["foo.com."]
+	if len(upsert) != 1 || aws.StringValue(upsert[0].Type) != "A" || fmt.Sprint(recordValues(upsert[0])) != "[10.0.0.1 10.0.0.2]" {
+		t.Fatalf("expected the A record to be upserted with both IPs, got %v", upsert)
+	}
+	if fmt.Sprint(recordValues(create[0])) != "[10.0.0.1]" {
+		t.Errorf("expected the current record to be left alone, got %v", create[0])
+	}
+	client.Current["foo.com."] = []*route53.ResourceRecordSet{upsert[0], create[1]}
+	client.LastUpsert = map[string][]*route53.ResourceRecordSet{}
+
+	// a known IP doesn't cause any changes
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "multi.foo.com", IP: "10.0.0.2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastUpsert["foo.com."]) != 0 {
+		t.Errorf("expected no changes, got %v", client.LastUpsert["foo.com."])
+	}
+
+	// records of other groups are never merged
+	client.Current["foo.com."][1] = &route53.ResourceRecordSet{
+		Type:            aws.String("TXT"),
+		Name:            aws.String("multi.foo.com."),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"mate:other"`)}},
+	}
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "multi.foo.com", IP: "10.0.0.3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.LastUpsert["foo.com."]) != 0 {
+		t.Errorf("expected the foreign record not to be upserted, got %v", client.LastUpsert["foo.com."])
+	}
+}
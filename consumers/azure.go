@@ -0,0 +1,777 @@
+package consumers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/oauth2"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultAzureARMEndpoint  = "https://management.azure.com"
+	defaultAzureAuthorityURL = "https://login.microsoftonline.com"
+	azureAPIVersion          = "2018-05-01"
+	azureTimeout             = 30 * time.Second
+	// azureApex is the relative name of the zone apex
+	azureApex = "@"
+	// azureOwnerMetadataKey labels the record sets written by mate
+	azureOwnerMetadataKey = "mate-record-group-id"
+)
+
+type azureZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type azureARecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type azureCNAMERecord struct {
+	CNAME string `json:"cname"`
+}
+
+type azureTXTRecord struct {
+	Value []string `json:"value"`
+}
+
+type azureRecordSetProperties struct {
+	TTL         int64             `json:"TTL"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	ARecords    []azureARecord    `json:"ARecords,omitempty"`
+	CNAMERecord *azureCNAMERecord `json:"CNAMERecord,omitempty"`
+	TXTRecords  []azureTXTRecord  `json:"TXTRecords,omitempty"`
+}
+
+// azureRecordSet is a record set of a zone. Name is relative to the zone
+// and Type is the short record type, e.g. A, after being read from the API.
+type azureRecordSet struct {
+	Name       string                   `json:"name,omitempty"`
+	Type       string                   `json:"type,omitempty"`
+	Etag       string                   `json:"etag,omitempty"`
+	Properties azureRecordSetProperties `json:"properties"`
+}
+
+// azureNameSets holds the record sets of a single name in a zone. Foreign
+// record sets, e.g. MX or TXT sets created by hand, make the name unusable.
+type azureNameSets struct {
+	owner   *azureRecordSet
+	sets    map[string]*azureRecordSet
+	foreign bool
+}
+
+// azureError is a failed request to the ARM API
+type azureError struct {
+	status     string
+	statusCode int
+	Details    struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e *azureError) Error() string {
+	if e.Details.Code == "" {
+		return fmt.Sprintf("request failed (%s)", e.status)
+	}
+	return fmt.Sprintf("request failed (%s): %s: %s", e.status, e.Details.Code, e.Details.Message)
+}
+
+func isAzureNotFound(err error) bool {
+	e, ok := err.(*azureError)
+	return ok && e.statusCode == http.StatusNotFound
+}
+
+type azureConsumer struct {
+	client        *http.Client
+	armEndpoint   string
+	resourceGroup string
+	groupID       string
+}
+
+// AzureOptions configures the consumer for Azure DNS. The record sets are
+// managed with the credentials of a service principal.
+type AzureOptions struct {
+	ARMEndpoint    string
+	AuthorityURL   string
+	SubscriptionID string
+	ResourceGroup  string
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	GroupID        string
+}
+
+// NewAzureConsumer creates a consumer which manages the record sets of the
+// zones in a resource group. Ownership of record sets is tracked by a TXT
+// record set, see ownerName.
+func NewAzureConsumer(cfg *AzureOptions) (Consumer, error) {
+	if cfg.SubscriptionID == "" {
+		return nil, errors.New("please provide --azure-subscription-id")
+	}
+	if cfg.ResourceGroup == "" {
+		return nil, errors.New("please provide --azure-resource-group")
+	}
+	if cfg.TenantID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("please provide --azure-tenant-id, --azure-client-id and --azure-client-secret")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --azure-record-group-id")
+	}
+	if cfg.ARMEndpoint == "" {
+		cfg.ARMEndpoint = defaultAzureARMEndpoint
+	}
+	if cfg.AuthorityURL == "" {
+		cfg.AuthorityURL = defaultAzureAuthorityURL
+	}
+	for flag, endpoint := range map[string]string{"--azure-arm-endpoint": cfg.ARMEndpoint, "--azure-authority-url": cfg.AuthorityURL} {
+		if _, err := url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %v", flag, endpoint, err)
+		}
+	}
+
+	armEndpoint := strings.TrimSuffix(cfg.ARMEndpoint, "/")
+	tokens := &azureTokenSource{
+		client:       &http.Client{Timeout: azureTimeout},
+		tokenURL:     strings.TrimSuffix(cfg.AuthorityURL, "/") + "/" + azurePathEscape(cfg.TenantID) + "/oauth2/token",
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		resource:     armEndpoint + "/",
+	}
+
+	return &azureConsumer{
+		client: &http.Client{
+			Timeout:   azureTimeout,
+			Transport: &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, tokens)},
+		},
+		armEndpoint:   armEndpoint,
+		resourceGroup: fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", azurePathEscape(cfg.SubscriptionID), azurePathEscape(cfg.ResourceGroup)),
+		groupID:       cfg.GroupID,
+	}, nil
+}
+
+func (d *azureConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		log.Warnln("[Azure] No zones found. At least one zone should be created to create DNS records...")
+		return nil
+	}
+
+	desired := make(map[string]map[string]*azureRecordSet)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[Azure] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		zone := azureZoneFor(zones, ep.DNSName)
+		if zone == nil {
+			log.Warnf("[Azure] Zone for endpoint %s was not found. Skipping record...", ep.DNSName)
+			continue
+		}
+
+		set, err := d.endpointToRecordSet(ep)
+		if err != nil {
+			log.Warnf("[Azure] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		name := azureName(ep.DNSName)
+		if desired[zone.Name] == nil {
+			desired[zone.Name] = make(map[string]*azureRecordSet)
+		}
+		merged, err := mergeAzureRecordSets(desired[zone.Name][name], set)
+		if err != nil {
+			log.Warnf("[Azure] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+		desired[zone.Name][name] = merged
+	}
+
+	errs := make([]error, 0)
+	for _, zone := range zones {
+		if err := d.syncZone(zone, desired[zone.Name]); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %v", zone.Name, err))
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *azureConsumer) syncZone(zone *azureZone, desired map[string]*azureRecordSet) error {
+	current, err := d.currentRecordSets(zone)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0)
+
+	for name, set := range desired {
+		existing, exists := current[name]
+		if exists && (existing.foreign || !d.isResponsible(existing.owner)) {
+			log.Warnf("[Azure] Skipping record %s: not owned by group ID %s", name, d.groupID)
+			continue
+		}
+
+		errs = append(errs, d.apply(zone, name, existing, set)...)
+	}
+
+	for name, existing := range current {
+		if !d.isResponsible(existing.owner) || desired[name] != nil {
+			continue
+		}
+
+		errs = append(errs, d.apply(zone, name, existing, nil)...)
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *azureConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Azure] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Azure] channel closed")
+				return
+			}
+
+			log.Infof("[Azure] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Azure] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint to a name that is either owned or
+// not in use at all.
+func (d *azureConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[Azure] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+
+	zone := azureZoneFor(zones, endpoint.DNSName)
+	if zone == nil {
+		log.Warnf("[Azure] Zone for endpoint %s was not found. Skipping record...", endpoint.DNSName)
+		return nil
+	}
+
+	set, err := d.endpointToRecordSet(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", endpoint.DNSName, err)
+	}
+
+	name := azureName(endpoint.DNSName)
+	existing, err := d.currentName(zone, name)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && (existing.foreign || !d.isResponsible(existing.owner)) {
+		log.Warnf("[Azure] Record [name=%s] could not be created, another record with same name already exists", name)
+		return nil
+	}
+
+	// keep the other addresses of the name
+	if existing != nil && set.Type == "A" {
+		if a, exists := existing.sets["A"]; exists {
+			set, _ = mergeAzureRecordSets(&azureRecordSet{Type: "A", Properties: a.Properties}, set)
+		}
+	}
+
+	return combineErrors(d.apply(zone, name, existing, set))
+}
+
+// apply changes the record sets of a name to the desired one. A nil record
+// set removes the name including its ownership record set.
+func (d *azureConsumer) apply(zone *azureZone, name string, existing *azureNameSets, desired *azureRecordSet) []error {
+	errs := make([]error, 0)
+
+	if existing == nil {
+		existing = &azureNameSets{sets: map[string]*azureRecordSet{}}
+	}
+
+	// claim the name before writing any record sets, so that they can always
+	// be cleaned up
+	if desired != nil && existing.owner == nil {
+		if err := d.putRecordSet(zone, "TXT", ownerName(name), d.ownerRecordSet(), nil); err != nil {
+			return append(errs, err)
+		}
+	}
+
+	// remove outdated record sets first, a CNAME can't coexist with others
+	for _, recordType := range sortedAzureTypes(existing.sets) {
+		if desired != nil && desired.Type == recordType {
+			continue
+		}
+		if err := d.deleteRecordSet(zone, recordType, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if desired != nil {
+		current, exists := existing.sets[desired.Type]
+		if !exists || !sameAzureRecordSet(current, desired) {
+			if err := d.putRecordSet(zone, desired.Type, name, desired, current); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// release the name only once all of its record sets are gone
+	if desired == nil && existing.owner != nil && len(errs) == 0 {
+		if err := d.deleteRecordSet(zone, "TXT", ownerName(name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// zones returns the zones of the resource group
+func (d *azureConsumer) zones() ([]*azureZone, error) {
+	zones := make([]*azureZone, 0)
+
+	err := d.list(d.resourceGroup+"/providers/Microsoft.Network/dnsZones", func(value json.RawMessage) error {
+		var page []*azureZone
+		if err := json.Unmarshal(value, &page); err != nil {
+			return err
+		}
+		for _, zone := range page {
+			zone.Name = azureName(zone.Name)
+		}
+		zones = append(zones, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones: %v", err)
+	}
+
+	return zones, nil
+}
+
+// currentRecordSets returns the names of the zone with their owner and their
+// A and CNAME record sets. Owner record sets are assigned to the name they
+// belong to, other record sets mark their name as foreign.
+func (d *azureConsumer) currentRecordSets(zone *azureZone) (map[string]*azureNameSets, error) {
+	current := make(map[string]*azureNameSets)
+
+	err := d.list(d.zonePath(zone)+"/recordsets", func(value json.RawMessage) error {
+		var page []*azureRecordSet
+		if err := json.Unmarshal(value, &page); err != nil {
+			return err
+		}
+
+		for _, set := range page {
+			set.Type = azureRecordType(set.Type)
+			if set.Type == "SOA" || set.Type == "NS" && set.Name == azureApex {
+				continue // the zone's own records don't keep A records off the apex
+			}
+			addAzureRecordSet(current, azureFQDN(set.Name, zone), set)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list record sets: %v", err)
+	}
+
+	return current, nil
+}
+
+// currentName returns the record sets of a single name, or nil if it has none.
+// The API can only get the record sets of a name one type at a time, so the
+// record sets of the whole zone are listed to find foreign ones as well.
+func (d *azureConsumer) currentName(zone *azureZone, name string) (*azureNameSets, error) {
+	current, err := d.currentRecordSets(zone)
+	if err != nil {
+		return nil, err
+	}
+	return current[name], nil
+}
+
+// putRecordSet creates or replaces a record set. Replacing requires the etag
+// of the current record set to not overwrite concurrent changes.
+func (d *azureConsumer) putRecordSet(zone *azureZone, recordType, name string, set, current *azureRecordSet) error {
+	log.Debugf("[Azure] Writing record set %s %s", name, recordType)
+
+	header := http.Header{"If-None-Match": {"*"}}
+	if current != nil {
+		header = http.Header{"If-Match": {current.Etag}}
+	}
+
+	body := &azureRecordSet{Properties: set.Properties}
+	if err := d.do("PUT", d.recordSetPath(zone, recordType, name), header, body, nil); err != nil {
+		return fmt.Errorf("failed to write record set %s %s: %v", name, recordType, err)
+	}
+	return nil
+}
+
+func (d *azureConsumer) deleteRecordSet(zone *azureZone, recordType, name string) error {
+	log.Debugf("[Azure] Deleting record set %s %s", name, recordType)
+	if err := d.do("DELETE", d.recordSetPath(zone, recordType, name), nil, nil, nil); err != nil && !isAzureNotFound(err) {
+		return fmt.Errorf("failed to delete record set %s %s: %v", name, recordType, err)
+	}
+	return nil
+}
+
+// list requests all pages of the resource by following their next links and
+// passes their values to f
+func (d *azureConsumer) list(path string, f func(json.RawMessage) error) error {
+	next := d.armEndpoint + path + "?api-version=" + azureAPIVersion
+	for next != "" {
+		var page struct {
+			Value    json.RawMessage `json:"value"`
+			NextLink string          `json:"nextLink"`
+		}
+		if err := d.do("GET", next, nil, nil, &page); err != nil {
+			return err
+		}
+
+		if err := f(page.Value); err != nil {
+			return err
+		}
+
+		next = page.NextLink
+	}
+	return nil
+}
+
+// do sends the request to the ARM API and decodes the response into result
+// unless it is nil. Relative targets are resolved against the ARM endpoint.
+func (d *azureConsumer) do(method, target string, header http.Header, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !strings.Contains(target, "://") {
+		target = d.armEndpoint + target + "?api-version=" + azureAPIVersion
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &azureError{status: resp.Status, statusCode: resp.StatusCode}
+		json.Unmarshal(data, e)
+		return e
+	}
+
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("unexpected response (%s): %v", resp.Status, err)
+		}
+	}
+	return nil
+}
+
+func (d *azureConsumer) zonePath(zone *azureZone) string {
+	return d.resourceGroup + "/providers/Microsoft.Network/dnsZones/" + azurePathEscape(zone.Name)
+}
+
+func (d *azureConsumer) recordSetPath(zone *azureZone, recordType, name string) string {
+	return d.zonePath(zone) + "/" + recordType + "/" + azurePathEscape(azureRelativeName(name, zone))
+}
+
+// owner returns the identifier for record sets as stored in TXT records
+func (d *azureConsumer) owner() string {
+	return ownerPrefix + d.groupID
+}
+
+// ownerRecordSet returns the TXT record set which accompanies the record
+// sets of a name
+func (d *azureConsumer) ownerRecordSet() *azureRecordSet {
+	return &azureRecordSet{
+		Type: "TXT",
+		Properties: azureRecordSetProperties{
+			TTL:        defaultTTL,
+			Metadata:   d.metadata(),
+			TXTRecords: []azureTXTRecord{{Value: []string{d.owner()}}},
+		},
+	}
+}
+
+// metadata labels the record sets written by mate. It is informational only,
+// ownership is decided by the TXT record set.
+func (d *azureConsumer) metadata() map[string]string {
+	return map[string]string{azureOwnerMetadataKey: d.groupID}
+}
+
+func (d *azureConsumer) isResponsible(owner *azureRecordSet) bool {
+	if owner == nil {
+		return false
+	}
+	for _, txt := range owner.Properties.TXTRecords {
+		if strings.Join(txt.Value, "") == d.owner() {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointToRecordSet converts the endpoint to an A record set for IPs and a
+// CNAME record set for hostnames
+func (d *azureConsumer) endpointToRecordSet(ep *pkg.Endpoint) (*azureRecordSet, error) {
+	set := &azureRecordSet{
+		Properties: azureRecordSetProperties{
+			TTL:      ttl(ep),
+			Metadata: d.metadata(),
+		},
+	}
+
+	switch {
+	case ep.IP != "":
+		ip := net.ParseIP(ep.IP)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %s", ep.IP)
+		}
+		set.Type = "A"
+		set.Properties.ARecords = []azureARecord{{IPv4Address: ip.String()}}
+	case ep.Hostname != "":
+		set.Type = "CNAME"
+		set.Properties.CNAMERecord = &azureCNAMERecord{CNAME: azureName(ep.Hostname)}
+	default:
+		return nil, errors.New("neither IP nor hostname given")
+	}
+
+	return set, nil
+}
+
+// addAzureRecordSet assigns the record set of the given name to the entry of
+// the name it belongs to, record sets mate doesn't manage make it foreign
+func addAzureRecordSet(current map[string]*azureNameSets, name string, set *azureRecordSet) {
+	entry := func(name string) *azureNameSets {
+		if _, exists := current[name]; !exists {
+			current[name] = &azureNameSets{sets: make(map[string]*azureRecordSet)}
+		}
+		return current[name]
+	}
+
+	switch {
+	case set.Type == "TXT" && isOwnerName(name):
+		for _, txt := range set.Properties.TXTRecords {
+			if strings.HasPrefix(strings.Join(txt.Value, ""), ownerPrefix) {
+				entry(ownedName(name)).owner = set
+				return
+			}
+		}
+	case set.Type == "A" || set.Type == "CNAME":
+		entry(name).sets[set.Type] = set
+		return
+	}
+
+	entry(name).foreign = true
+}
+
+// mergeAzureRecordSets adds the addresses of an A record set to another one,
+// CNAMEs can't have siblings
+func mergeAzureRecordSets(set, add *azureRecordSet) (*azureRecordSet, error) {
+	if set == nil {
+		return add, nil
+	}
+	if set.Type == "CNAME" || add.Type == "CNAME" {
+		return nil, errors.New("a CNAME can't be combined with other records")
+	}
+
+	merged := *set
+	merged.Properties.ARecords = append([]azureARecord{}, set.Properties.ARecords...)
+	for _, a := range add.Properties.ARecords {
+		exists := false
+		for _, b := range merged.Properties.ARecords {
+			exists = exists || a.IPv4Address == b.IPv4Address
+		}
+		if !exists {
+			merged.Properties.ARecords = append(merged.Properties.ARecords, a)
+		}
+	}
+	merged.Properties.TTL = add.Properties.TTL
+	merged.Properties.Metadata = add.Properties.Metadata
+	return &merged, nil
+}
+
+// sameAzureRecordSet reports whether the record sets have the same TTL and
+// records regardless of their order
+func sameAzureRecordSet(a, b *azureRecordSet) bool {
+	if a.Properties.TTL != b.Properties.TTL {
+		return false
+	}
+
+	switch b.Type {
+	case "A":
+		if len(a.Properties.ARecords) != len(b.Properties.ARecords) {
+			return false
+		}
+		ips := make(map[string]bool)
+		for _, r := range a.Properties.ARecords {
+			ips[r.IPv4Address] = true
+		}
+		for _, r := range b.Properties.ARecords {
+			if !ips[r.IPv4Address] {
+				return false
+			}
+		}
+		return true
+	case "CNAME":
+		return a.Properties.CNAMERecord != nil && b.Properties.CNAMERecord != nil &&
+			azureName(a.Properties.CNAMERecord.CNAME) == azureName(b.Properties.CNAMERecord.CNAME)
+	}
+	return false
+}
+
+func sortedAzureTypes(sets map[string]*azureRecordSet) []string {
+	types := make([]string, 0, len(sets))
+	for _, recordType := range []string{"A", "CNAME"} {
+		if _, exists := sets[recordType]; exists {
+			types = append(types, recordType)
+		}
+	}
+	return types
+}
+
+// azureZoneFor returns the zone with the longest name matching the dns name
+func azureZoneFor(zones []*azureZone, dnsName string) *azureZone {
+	name := azureName(dnsName)
+
+	var match *azureZone
+	for _, zone := range zones {
+		if name != zone.Name && !strings.HasSuffix(name, "."+zone.Name) {
+			continue
+		}
+		if match == nil || len(zone.Name) > len(match.Name) { //get the longest match for the dns name
+			match = zone
+		}
+	}
+	return match
+}
+
+// azureRecordType returns the short record type of a resource type like
+// Microsoft.Network/dnszones/A
+func azureRecordType(resourceType string) string {
+	return resourceType[strings.LastIndex(resourceType, "/")+1:]
+}
+
+// azureName returns the name in lower case and without trailing dot
+func azureName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(pkg.SanitizeDNSName(name), "."))
+}
+
+// azureRelativeName returns the name relative to the zone, @ for the apex
+func azureRelativeName(name string, zone *azureZone) string {
+	if name == zone.Name {
+		return azureApex
+	}
+	return strings.TrimSuffix(name, "."+zone.Name)
+}
+
+// azureFQDN returns the full name of a name relative to the zone
+func azureFQDN(relative string, zone *azureZone) string {
+	if relative == azureApex {
+		return zone.Name
+	}
+	return strings.ToLower(relative) + "." + zone.Name
+}
+
+// azurePathEscape escapes the string as a single path segment. It stands in
+// for url.PathEscape, which isn't available before Go 1.8.
+func azurePathEscape(segment string) string {
+	return strings.Replace((&url.URL{Path: segment}).EscapedPath(), "/", "%2F", -1)
+}
+
+// azureTokenSource requests tokens for a service principal with the client
+// credentials grant of Azure Active Directory
+type azureTokenSource struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	resource     string
+}
+
+func (s *azureTokenSource) Token() (*oauth2.Token, error) {
+	resp, err := s.client.PostForm(s.tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"resource":      {s.resource},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request token (%s)", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("failed to request token: empty access token")
+	}
+
+	result := &oauth2.Token{AccessToken: token.AccessToken, TokenType: token.TokenType}
+	if seconds, err := strconv.Atoi(token.ExpiresIn.String()); err == nil && seconds > 0 {
+		result.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return result, nil
+}
@@ -0,0 +1,513 @@
+package consumers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	testAzureTenant       = "tenant"
+	testAzureClientSecret = "secret"
+	testAzureToken        = "token"
+	testAzureZonesPath    = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/dnsZones"
+)
+
+// fakeAzure is a stand-in for the token endpoint of Azure Active Directory
+// and the DNS endpoints of the Azure Resource Manager. Zones are listed at
+// most two per page to exercise the next links. Writing TXT record sets fails
+// with rejectTXT.
+type fakeAzure struct {
+	zones     []string
+	sets      map[string]map[string]*azureRecordSet
+	nextEtag  int
+	tokens    int
+	rejectTXT bool
+	sync.Mutex
+}
+
+func newFakeAzure(zones ...string) (*fakeAzure, *httptest.Server) {
+	api := &fakeAzure{
+		zones: zones,
+		sets:  make(map[string]map[string]*azureRecordSet),
+	}
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakeAzure) add(zone, rrtype, name string, ttl int64, values ...string) {
+	set := &azureRecordSet{Properties: azureRecordSetProperties{TTL: ttl}}
+	switch rrtype {
+	case "A":
+		for _, ip := range values {
+			set.Properties.ARecords = append(set.Properties.ARecords, azureARecord{IPv4Address: ip})
+		}
+	case "CNAME":
+		set.Properties.CNAMERecord = &azureCNAMERecord{CNAME: values[0]}
+	case "TXT":
+		set.Properties.TXTRecords = []azureTXTRecord{{Value: values}}
+	}
+	f.store(zone, rrtype, name, set)
+}
+
+func (f *fakeAzure) store(zone, rrtype, name string, set *azureRecordSet) {
+	if f.sets[zone] == nil {
+		f.sets[zone] = make(map[string]*azureRecordSet)
+	}
+	f.nextEtag++
+	set.Name = name
+	set.Type = "Microsoft.Network/dnszones/" + rrtype
+	set.Etag = strconv.Itoa(f.nextEtag)
+	f.sets[zone][rrtype+"/"+name] = set
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.URL.Path == "/"+testAzureTenant+"/oauth2/token" {
+		f.token(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+testAzureToken {
+		f.fail(w, http.StatusUnauthorized, "AuthenticationFailed", "Authentication failed.")
+		return
+	}
+	if r.URL.Query().Get("api-version") != azureAPIVersion {
+		f.fail(w, http.StatusBadRequest, "MissingApiVersionParameter", "The api-version query parameter is required.")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, testAzureZonesPath) {
+		f.fail(w, http.StatusNotFound, "ResourceGroupNotFound", "Resource group not found.")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, testAzureZonesPath), "/"), "/")
+
+	switch {
+	case parts[0] == "" && r.Method == "GET":
+		page, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+		start, end := page*2, page*2+2
+		if end >= len(f.zones) {
+			end = len(f.zones)
+		}
+
+		zones := make([]*azureZone, 0)
+		for _, zone := range f.zones[start:end] {
+			zones = append(zones, &azureZone{ID: testAzureZonesPath + "/" + zone, Name: zone})
+		}
+
+		result := map[string]interface{}{"value": zones}
+		if end < len(f.zones) {
+			result["nextLink"] = fmt.Sprintf("http://%s%s?api-version=%s&$skiptoken=%d", r.Host, testAzureZonesPath, azureAPIVersion, page+1)
+		}
+		json.NewEncoder(w).Encode(result)
+	case !f.hasZone(parts[0]):
+		f.fail(w, http.StatusNotFound, "ParentResourceNotFound", "Zone not found.")
+	case len(parts) == 2 && parts[1] == "recordsets" && r.Method == "GET":
+		sets := make([]*azureRecordSet, 0)
+		for _, set := range f.sets[parts[0]] {
+			sets = append(sets, set)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": sets})
+	case len(parts) == 3:
+		f.recordSet(w, r, parts[0], parts[1], parts[2])
+	default:
+		f.fail(w, http.StatusNotFound, "NotFound", "Could not route to "+r.URL.Path)
+	}
+}
+
+func (f *fakeAzure) recordSet(w http.ResponseWriter, r *http.Request, zone, rrtype, name string) {
+	existing := f.sets[zone][rrtype+"/"+name]
+
+	switch r.Method {
+	case "GET":
+		if existing == nil {
+			f.fail(w, http.StatusNotFound, "NotFound", "The resource record was not found.")
+			return
+		}
+		json.NewEncoder(w).Encode(existing)
+	case "PUT":
+		if rrtype == "TXT" && f.rejectTXT {
+			f.fail(w, http.StatusBadRequest, "BadRequest", "The TXT record set is invalid.")
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && (existing == nil || existing.Etag != match) {
+			f.fail(w, http.StatusPreconditionFailed, "PreconditionFailed", "The condition If-Match was not met.")
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && existing != nil {
+			f.fail(w, http.StatusPreconditionFailed, "PreconditionFailed", "The record set already exists.")
+			return
+		}
+		for key := range f.sets[zone] {
+			other := strings.SplitN(key, "/", 2)
+			if other[1] == name && other[0] != rrtype && (other[0] == "CNAME" || rrtype == "CNAME") {
+				f.fail(w, http.StatusBadRequest, "BadRequest", "A CNAME record set cannot coexist with other record sets.")
+				return
+			}
+		}
+
+		var set azureRecordSet
+		if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+			f.fail(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		f.store(zone, rrtype, name, &set)
+
+		if existing == nil {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(set)
+	case "DELETE":
+		delete(f.sets[zone], rrtype+"/"+name)
+		if existing == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (f *fakeAzure) token(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("client_secret") != testAzureClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	f.tokens++
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": testAzureToken,
+		"token_type":   "Bearer",
+		"expires_in":   "3599",
+	})
+}
+
+func (f *fakeAzure) hasZone(name string) bool {
+	for _, zone := range f.zones {
+		if zone == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeAzure) fail(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+// dump returns the record sets of the zone as "name type ttl records" with
+// the group ID of the metadata appended if present
+func (f *fakeAzure) dump(zone string) []string {
+	f.Lock()
+	defer f.Unlock()
+
+	result := make([]string, 0)
+	for _, set := range f.sets[zone] {
+		records := make([]string, 0)
+		for _, a := range set.Properties.ARecords {
+			records = append(records, a.IPv4Address)
+		}
+		if set.Properties.CNAMERecord != nil {
+			records = append(records, set.Properties.CNAMERecord.CNAME)
+		}
+		for _, txt := range set.Properties.TXTRecords {
+			records = append(records, strings.Join(txt.Value, ""))
+		}
+		sort.Strings(records)
+
+		entry := fmt.Sprintf("%s %s %d %s", set.Name, azureRecordType(set.Type), set.Properties.TTL, strings.Join(records, ","))
+		if group, exists := set.Properties.Metadata[azureOwnerMetadataKey]; exists {
+			entry += " group=" + group
+		}
+		result = append(result, entry)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newTestAzureConsumer(t *testing.T, endpoint string) Consumer {
+	consumer, err := NewAzureConsumer(&AzureOptions{
+		ARMEndpoint:    endpoint,
+		AuthorityURL:   endpoint,
+		SubscriptionID: "sub",
+		ResourceGroup:  "rg",
+		TenantID:       testAzureTenant,
+		ClientID:       "client",
+		ClientSecret:   testAzureClientSecret,
+		GroupID:        "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestAzureSync(t *testing.T) {
+	api, server := newFakeAzure("example.net", "example.com", "example.org", "sub.example.org")
+	defer server.Close()
+
+	api.add("example.org", "A", "same", 300, "10.0.0.1")
+	api.add("example.org", "TXT", "_mate.same", 300, "mate:test")
+	api.add("example.org", "A", "changed", 300, "10.0.0.2", "10.0.0.3")
+	api.add("example.org", "TXT", "_mate.changed", 300, "mate:test")
+	api.add("example.org", "A", "gone", 300, "10.0.0.4")
+	api.add("example.org", "TXT", "_mate.gone", 300, "mate:test")
+	api.add("example.org", "A", "foreign", 300, "10.0.0.5")
+	api.add("example.org", "TXT", "_mate.foreign", 300, "mate:other")
+	api.add("example.org", "A", "manual", 300, "10.0.0.6")
+	api.add("example.org", "CNAME", "alias", 300, "old.example.com")
+	api.add("example.org", "TXT", "_mate.alias", 300, "mate:test")
+	api.add("example.org", "TXT", "@", 3600, "v=spf1 -all")
+	api.add("example.org", "MX", "mail", 300)
+	api.add("example.org", "TXT", "verify", 300, "site-verification")
+	api.add("example.org", "A", "shared", 300, "10.0.0.7")
+	api.add("example.org", "TXT", "_mate.shared", 300, "mate:test")
+	api.add("example.org", "MX", "shared", 300)
+	api.add("sub.example.org", "SOA", "@", 3600)
+	api.add("sub.example.org", "NS", "@", 3600)
+
+	consumer := newTestAzureConsumer(t, server.URL)
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "changed.example.org", IP: "10.0.0.3", TTL: 60},
+		{DNSName: "changed.example.org", IP: "10.0.1.2", TTL: 60},
+		{DNSName: "foreign.example.org", IP: "10.0.1.5"},
+		{DNSName: "manual.example.org", IP: "10.0.1.6"},
+		{DNSName: "alias.example.org", IP: "10.0.1.7"},
+		{DNSName: "example.org", IP: "10.0.1.8"},
+		{DNSName: "mail.example.org", IP: "10.0.1.10"},
+		{DNSName: "verify.example.org", Hostname: "lb.example.net"},
+		{DNSName: "shared.example.org", IP: "10.0.1.11"},
+		{DNSName: "v6.example.org", IP: "2001:db8::1"},
+		{DNSName: "sub.example.org", IP: "10.0.1.12"},
+		{DNSName: "www.sub.example.org.", Hostname: "lb.example.net."},
+		{DNSName: "other.example.io", IP: "10.0.1.9"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// names with record sets mate doesn't manage are left alone, even if owned
+	expected := []string{
+		"@ TXT 3600 v=spf1 -all",
+		"_mate.alias TXT 300 mate:test",
+		"_mate.changed TXT 300 mate:test",
+		"_mate.foreign TXT 300 mate:other",
+		"_mate.same TXT 300 mate:test",
+		"_mate.shared TXT 300 mate:test",
+		"alias A 300 10.0.1.7 group=test",
+		"changed A 60 10.0.0.3,10.0.1.2 group=test",
+		"foreign A 300 10.0.0.5",
+		"mail MX 300 ",
+		"manual A 300 10.0.0.6",
+		"same A 300 10.0.0.1",
+		"shared A 300 10.0.0.7",
+		"shared MX 300 ",
+		"verify TXT 300 site-verification",
+	}
+	if sets := api.dump("example.org"); !reflect.DeepEqual(sets, expected) {
+		t.Errorf("unexpected record sets\n got: %v\nwant: %v", sets, expected)
+	}
+
+	expected = []string{
+		"@ A 300 10.0.1.12 group=test",
+		"@ NS 3600 ",
+		"@ SOA 3600 ",
+		"_mate TXT 300 mate:test group=test",
+		"_mate.www TXT 300 mate:test group=test",
+		"www CNAME 300 lb.example.net group=test",
+	}
+	if sets := api.dump("sub.example.org"); !reflect.DeepEqual(sets, expected) {
+		t.Errorf("unexpected record sets\n got: %v\nwant: %v", sets, expected)
+	}
+
+	if api.tokens != 1 {
+		t.Errorf("expected the token to be reused, got %d token requests", api.tokens)
+	}
+}
+
+func TestAzureProcess(t *testing.T) {
+	api, server := newFakeAzure("example.org")
+	defer server.Close()
+
+	api.add("example.org", "A", "owned", 300, "10.0.0.1")
+	api.add("example.org", "TXT", "_mate.owned", 300, "mate:test")
+	api.add("example.org", "A", "cname", 300, "10.0.0.2")
+	api.add("example.org", "TXT", "_mate.cname", 300, "mate:test")
+	api.add("example.org", "A", "foreign", 300, "10.0.0.3")
+	api.add("example.org", "TXT", "_mate.foreign", 300, "mate:other")
+	api.add("example.org", "CNAME", "manual", 300, "lb.example.com")
+	api.add("example.org", "MX", "mail", 300)
+	api.add("example.org", "TXT", "verify", 300, "site-verification")
+
+	consumer := newTestAzureConsumer(t, server.URL)
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.3"},
+		{DNSName: "manual.example.org", IP: "10.0.1.4"},
+		{DNSName: "new.example.org", IP: "10.0.1.5"},
+		{DNSName: "other.example.io", IP: "10.0.1.6"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+		{DNSName: "mail.example.org", IP: "10.0.1.7"},
+		{DNSName: "verify.example.org", Hostname: "lb.example.net"},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := []string{
+		"_mate.cname TXT 300 mate:test",
+		"_mate.foreign TXT 300 mate:other",
+		"_mate.new TXT 300 mate:test group=test",
+		"_mate.owned TXT 300 mate:test",
+		"cname CNAME 300 lb.example.net group=test",
+		"foreign A 300 10.0.0.3",
+		"mail MX 300 ",
+		"manual CNAME 300 lb.example.com",
+		"new A 300 10.0.1.5 group=test",
+		"owned A 300 10.0.0.1,10.0.1.1 group=test",
+		"verify TXT 300 site-verification",
+	}
+	if sets := api.dump("example.org"); !reflect.DeepEqual(sets, expected) {
+		t.Errorf("unexpected record sets\n got: %v\nwant: %v", sets, expected)
+	}
+}
+
+func TestAzureOwnerFirst(t *testing.T) {
+	api, server := newFakeAzure("example.org")
+	defer server.Close()
+
+	consumer := newTestAzureConsumer(t, server.URL)
+
+	// record sets without an owner could never be removed again
+	api.rejectTXT = true
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}}); err == nil {
+		t.Error("expected sync to fail")
+	}
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"}); err == nil {
+		t.Error("expected process to fail")
+	}
+	if sets := api.dump("example.org"); len(sets) != 0 {
+		t.Errorf("expected no record sets without an owner, got %v", sets)
+	}
+}
+
+func TestAzureErrors(t *testing.T) {
+	_, server := newFakeAzure("example.org")
+	defer server.Close()
+
+	consumer, err := NewAzureConsumer(&AzureOptions{
+		ARMEndpoint:    server.URL,
+		AuthorityURL:   server.URL,
+		SubscriptionID: "sub",
+		ResourceGroup:  "rg",
+		TenantID:       testAzureTenant,
+		ClientID:       "client",
+		ClientSecret:   "wrong",
+		GroupID:        "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}})
+	if err == nil || !strings.Contains(err.Error(), "failed to request token") {
+		t.Errorf("expected token error, got %v", err)
+	}
+
+	consumer = newTestAzureConsumer(t, server.URL)
+	consumer.(*azureConsumer).resourceGroup = "/subscriptions/sub/resourceGroups/missing"
+
+	err = consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"})
+	if err == nil || !strings.Contains(err.Error(), "ResourceGroupNotFound") {
+		t.Errorf("expected resource group error, got %v", err)
+	}
+}
+
+func TestNewAzureConsumer(t *testing.T) {
+	valid := AzureOptions{SubscriptionID: "sub", ResourceGroup: "rg", TenantID: "tenant", ClientID: "client", ClientSecret: "secret", GroupID: "test"}
+
+	for _, test := range []struct {
+		title  string
+		modify func(*AzureOptions)
+		valid  bool
+	}{
+		{"valid", func(*AzureOptions) {}, true},
+		{"missing subscription", func(o *AzureOptions) { o.SubscriptionID = "" }, false},
+		{"missing resource group", func(o *AzureOptions) { o.ResourceGroup = "" }, false},
+		{"missing client secret", func(o *AzureOptions) { o.ClientSecret = "" }, false},
+		{"missing group id", func(o *AzureOptions) { o.GroupID = "" }, false},
+		{"invalid arm endpoint", func(o *AzureOptions) { o.ARMEndpoint = "http://[::1" }, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			options := valid
+			test.modify(&options)
+			_, err := NewAzureConsumer(&options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestAzureZoneFor(t *testing.T) {
+	zones := []*azureZone{{Name: "example.org"}, {Name: "sub.example.org"}, {Name: "ample.org"}}
+
+	for _, test := range []struct {
+		dnsName  string
+		expected string
+	}{
+		{"example.org", "example.org"},
+		{"www.example.org.", "example.org"},
+		{"www.sub.example.org", "sub.example.org"},
+		{"WWW.Sub.Example.org", "sub.example.org"},
+		{"www.xample.org", ""},
+	} {
+		zone := azureZoneFor(zones, test.dnsName)
+		name := ""
+		if zone != nil {
+			name = zone.Name
+		}
+		if name != test.expected {
+			t.Errorf("azureZoneFor(%s) => %q, want %q", test.dnsName, name, test.expected)
+		}
+	}
+}
+
+func TestAzurePathEscape(t *testing.T) {
+	for _, test := range []struct {
+		segment  string
+		expected string
+	}{
+		{"example.org", "example.org"},
+		{"my group", "my%20group"},
+		{"a/b?c#d", "a%2Fb%3Fc%23d"},
+		{"*.example.org", "%2A.example.org"},
+	} {
+		if escaped := azurePathEscape(test.segment); escaped != test.expected {
+			t.Errorf("azurePathEscape(%s) => %q, want %q", test.segment, escaped, test.expected)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package consumers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultCloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+	cloudflareTimeout        = 30 * time.Second
+	cloudflareZonesPerPage   = 50
+	cloudflareRecordsPerPage = 100
+	// cloudflareAutoTTL lets Cloudflare choose the TTL, required for proxied records
+	cloudflareAutoTTL = 1
+)
+
+type cloudflareZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int64  `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// cloudflareResponse is the envelope of all API responses
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// cloudflareRecordSet holds the records of a single name in a zone
+type cloudflareRecordSet struct {
+	owner   *cloudflareRecord
+	records []*cloudflareRecord
+}
+
+type cloudflareConsumer struct {
+	client   *http.Client
+	baseURL  string
+	apiToken string
+	apiEmail string
+	apiKey   string
+	groupID  string
+}
+
+// CloudflareOptions configures the consumer for the Cloudflare API. Either
+// an API token or the email and global API key of an account are required.
+type CloudflareOptions struct {
+	BaseURL  string
+	APIToken string
+	APIEmail string
+	APIKey   string
+	GroupID  string
+}
+
+// NewCloudflareConsumer creates a consumer which manages records of the
+// zones accessible with the given credentials. Ownership of records is
+// tracked by a TXT record, see ownerName.
+func NewCloudflareConsumer(cfg *CloudflareOptions) (Consumer, error) {
+	if cfg.APIToken == "" && (cfg.APIEmail == "" || cfg.APIKey == "") {
+		return nil, errors.New("please provide --cloudflare-api-token or --cloudflare-api-email and --cloudflare-api-key")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --cloudflare-record-group-id")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultCloudflareBaseURL
+	}
+	if _, err := url.Parse(cfg.BaseURL); err != nil {
+		return nil, fmt.Errorf("invalid --cloudflare-api-url %s: %v", cfg.BaseURL, err)
+	}
+
+	return &cloudflareConsumer{
+		client:   &http.Client{Timeout: cloudflareTimeout},
+		baseURL:  strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiToken: cfg.APIToken,
+		apiEmail: cfg.APIEmail,
+		apiKey:   cfg.APIKey,
+		groupID:  cfg.GroupID,
+	}, nil
+}
+
+func (d *cloudflareConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		log.Warnln("[Cloudflare] No zones found. At least one zone should be created to create DNS records...")
+		return nil
+	}
+
+	desired := make(map[string]map[string][]*cloudflareRecord)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[Cloudflare] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		zone := cloudflareZoneFor(zones, ep.DNSName)
+		if zone == nil {
+			log.Warnf("[Cloudflare] Zone for endpoint %s was not found. Skipping record...", ep.DNSName)
+			continue
+		}
+
+		record, err := endpointToCloudflareRecord(ep)
+		if err != nil {
+			log.Warnf("[Cloudflare] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		if desired[zone.ID] == nil {
+			desired[zone.ID] = make(map[string][]*cloudflareRecord)
+		}
+		records, err := addCloudflareRecord(desired[zone.ID][record.Name], record)
+		if err != nil {
+			log.Warnf("[Cloudflare] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+		desired[zone.ID][record.Name] = records
+	}
+
+	errs := make([]error, 0)
+	for _, zone := range zones {
+		if err := d.syncZone(zone, desired[zone.ID]); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %v", zone.Name, err))
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *cloudflareConsumer) syncZone(zone *cloudflareZone, desired map[string][]*cloudflareRecord) error {
+	current, err := d.currentRecords(zone)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0)
+
+	for name, records := range desired {
+		existing, exists := current[name]
+		if exists && !d.isResponsible(existing.owner) {
+			log.Warnf("[Cloudflare] Skipping record %s: not owned by group ID %s", name, d.groupID)
+			continue
+		}
+
+		errs = append(errs, d.apply(zone, name, existing, records)...)
+	}
+
+	for name, existing := range current {
+		if !d.isResponsible(existing.owner) || desired[name] != nil {
+			continue
+		}
+
+		errs = append(errs, d.apply(zone, name, existing, nil)...)
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *cloudflareConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Cloudflare] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Cloudflare] channel closed")
+				return
+			}
+
+			log.Infof("[Cloudflare] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Cloudflare] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint to a name that is either owned or
+// not in use at all.
+func (d *cloudflareConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[Cloudflare] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+
+	zone := cloudflareZoneFor(zones, endpoint.DNSName)
+	if zone == nil {
+		log.Warnf("[Cloudflare] Zone for endpoint %s was not found. Skipping record...", endpoint.DNSName)
+		return nil
+	}
+
+	record, err := endpointToCloudflareRecord(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", endpoint.DNSName, err)
+	}
+
+	current, err := d.currentRecords(zone, record.Name, ownerName(record.Name))
+	if err != nil {
+		return err
+	}
+
+	existing, exists := current[record.Name]
+	if exists && !d.isResponsible(existing.owner) {
+		log.Warnf("[Cloudflare] Record [name=%s] could not be created, another record with same name already exists", record.Name)
+		return nil
+	}
+
+	// keep the other addresses of the name
+	desired := []*cloudflareRecord{}
+	if exists && record.Type != "CNAME" {
+		for _, r := range existing.records {
+			if r.Type != "CNAME" && !(r.Type == record.Type && r.Content == record.Content) {
+				desired = append(desired, &cloudflareRecord{Type: r.Type, Name: r.Name, Content: r.Content, TTL: r.TTL, Proxied: r.Proxied})
+			}
+		}
+	}
+	desired = append(desired, record)
+
+	return combineErrors(d.apply(zone, record.Name, existing, desired))
+}
+
+// apply changes the records of a name to the desired ones. A nil list of
+// desired records removes the name including its ownership record.
+func (d *cloudflareConsumer) apply(zone *cloudflareZone, name string, existing *cloudflareRecordSet, desired []*cloudflareRecord) []error {
+	errs := make([]error, 0)
+
+	var current []*cloudflareRecord
+	if existing != nil {
+		current = existing.records
+	}
+
+	matched := make(map[*cloudflareRecord]bool)
+	creates := make([]*cloudflareRecord, 0)
+	updates := make([]*cloudflareRecord, 0)
+
+	for _, record := range desired {
+		found := false
+		for _, c := range current {
+			if c.Type == record.Type && c.Content == record.Content && !matched[c] {
+				matched[c] = true
+				found = true
+				if c.TTL != record.TTL || c.Proxied != record.Proxied {
+					record.ID = c.ID
+					updates = append(updates, record)
+				}
+				break
+			}
+		}
+		if !found {
+			creates = append(creates, record)
+		}
+	}
+
+	// claim the name before writing any records, so that they can always be
+	// cleaned up
+	if desired != nil && (existing == nil || existing.owner == nil) {
+		if err := d.createRecord(zone, d.ownerRecord(name)); err != nil {
+			return append(errs, err)
+		}
+	}
+
+	// remove outdated records first, a CNAME can't coexist with others
+	for _, c := range current {
+		if !matched[c] {
+			if err := d.deleteRecord(zone, c); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, record := range updates {
+		if err := d.updateRecord(zone, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, record := range creates {
+		if err := d.createRecord(zone, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// release the name only once all of its records are gone
+	if desired == nil && existing != nil && existing.owner != nil && len(errs) == 0 {
+		if err := d.deleteRecord(zone, existing.owner); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// zones returns all zones accessible with the credentials
+func (d *cloudflareConsumer) zones() ([]*cloudflareZone, error) {
+	zones := make([]*cloudflareZone, 0)
+
+	err := d.list("/zones", url.Values{}, cloudflareZonesPerPage, func(result json.RawMessage) error {
+		var page []*cloudflareZone
+		if err := json.Unmarshal(result, &page); err != nil {
+			return err
+		}
+		zones = append(zones, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones: %v", err)
+	}
+
+	return zones, nil
+}
+
+// currentRecords returns the names of the zone, or only the given ones, with
+// their owner and their A, AAAA and CNAME records. Owner records are
+// assigned to the name they belong to.
+func (d *cloudflareConsumer) currentRecords(zone *cloudflareZone, names ...string) (map[string]*cloudflareRecordSet, error) {
+	queries := []url.Values{{}}
+	if len(names) > 0 {
+		queries = make([]url.Values, 0, len(names))
+		for _, name := range names {
+			queries = append(queries, url.Values{"name": {name}})
+		}
+	}
+
+	current := make(map[string]*cloudflareRecordSet)
+	entry := func(name string) *cloudflareRecordSet {
+		if _, exists := current[name]; !exists {
+			current[name] = &cloudflareRecordSet{}
+		}
+		return current[name]
+	}
+
+	for _, query := range queries {
+		err := d.list("/zones/"+zone.ID+"/dns_records", query, cloudflareRecordsPerPage, func(result json.RawMessage) error {
+			var page []*cloudflareRecord
+			if err := json.Unmarshal(result, &page); err != nil {
+				return err
+			}
+
+			for _, record := range page {
+				if record.Type == "TXT" && isOwnerName(record.Name) {
+					if strings.HasPrefix(strings.Trim(record.Content, `"`), ownerPrefix) {
+						entry(ownedName(record.Name)).owner = record
+					}
+					continue
+				}
+
+				set := entry(record.Name)
+
+				switch record.Type {
+				case "A", "AAAA", "CNAME":
+					set.records = append(set.records, record)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list records: %v", err)
+		}
+	}
+
+	return current, nil
+}
+
+func (d *cloudflareConsumer) createRecord(zone *cloudflareZone, record *cloudflareRecord) error {
+	log.Debugf("[Cloudflare] Creating record %s %s %s", record.Name, record.Type, record.Content)
+	if err := d.do("POST", "/zones/"+zone.ID+"/dns_records", record, nil); err != nil {
+		return fmt.Errorf("failed to create record %s %s: %v", record.Name, record.Type, err)
+	}
+	return nil
+}
+
+func (d *cloudflareConsumer) updateRecord(zone *cloudflareZone, record *cloudflareRecord) error {
+	log.Debugf("[Cloudflare] Updating record %s %s %s", record.Name, record.Type, record.Content)
+	if err := d.do("PUT", "/zones/"+zone.ID+"/dns_records/"+record.ID, record, nil); err != nil {
+		return fmt.Errorf("failed to update record %s %s: %v", record.Name, record.Type, err)
+	}
+	return nil
+}
+
+func (d *cloudflareConsumer) deleteRecord(zone *cloudflareZone, record *cloudflareRecord) error {
+	log.Debugf("[Cloudflare] Deleting record %s %s %s", record.Name, record.Type, record.Content)
+	if err := d.do("DELETE", "/zones/"+zone.ID+"/dns_records/"+record.ID, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete record %s %s: %v", record.Name, record.Type, err)
+	}
+	return nil
+}
+
+// list requests all pages of the resource and passes their results to f
+func (d *cloudflareConsumer) list(path string, query url.Values, perPage int, f func(json.RawMessage) error) error {
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(perPage))
+
+		var resp cloudflareResponse
+		if err := d.do("GET", path+"?"+query.Encode(), nil, &resp); err != nil {
+			return err
+		}
+
+		if err := f(resp.Result); err != nil {
+			return err
+		}
+
+		if page >= resp.ResultInfo.TotalPages {
+			return nil
+		}
+	}
+}
+
+// do sends the request to the API and decodes the response envelope into
+// result unless it is nil
+func (d *cloudflareConsumer) do(method, path string, body interface{}, result *cloudflareResponse) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, d.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if d.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+d.apiToken)
+	} else {
+		req.Header.Set("X-Auth-Email", d.apiEmail)
+		req.Header.Set("X-Auth-Key", d.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope cloudflareResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("unexpected response (%s): %v", resp.Status, err)
+	}
+
+	if !envelope.Success {
+		messages := make([]string, 0, len(envelope.Errors))
+		for _, e := range envelope.Errors {
+			messages = append(messages, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+		return fmt.Errorf("request failed (%s): %s", resp.Status, strings.Join(messages, ", "))
+	}
+
+	if result != nil {
+		*result = envelope
+	}
+	return nil
+}
+
+// owner returns the identifier for records as stored in TXT records
+func (d *cloudflareConsumer) owner() string {
+	return fmt.Sprintf("\"%s%s\"", ownerPrefix, d.groupID)
+}
+
+// ownerRecord returns the TXT record which accompanies the records of a name
+func (d *cloudflareConsumer) ownerRecord(name string) *cloudflareRecord {
+	return &cloudflareRecord{
+		Type:    "TXT",
+		Name:    ownerName(name),
+		Content: d.owner(),
+		TTL:     defaultTTL,
+	}
+}
+
+func (d *cloudflareConsumer) isResponsible(owner *cloudflareRecord) bool {
+	return owner != nil && strings.Trim(owner.Content, `"`) == strings.Trim(d.owner(), `"`)
+}
+
+// endpointToCloudflareRecord converts the endpoint to an A or AAAA record
+// for IPs and a CNAME record for hostnames
+func endpointToCloudflareRecord(ep *pkg.Endpoint) (*cloudflareRecord, error) {
+	record := &cloudflareRecord{
+		Name:    cloudflareName(ep.DNSName),
+		TTL:     ttl(ep),
+		Proxied: ep.Proxied,
+	}
+	if ep.Proxied {
+		record.TTL = cloudflareAutoTTL
+	}
+
+	switch {
+	case ep.IP != "":
+		ip := net.ParseIP(ep.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", ep.IP)
+		}
+		record.Type = "AAAA"
+		if ip.To4() != nil {
+			record.Type = "A"
+		}
+		record.Content = ip.String()
+	case ep.Hostname != "":
+		record.Type = "CNAME"
+		record.Content = cloudflareName(ep.Hostname)
+	default:
+		return nil, errors.New("neither IP nor hostname given")
+	}
+
+	return record, nil
+}
+
+// addCloudflareRecord adds the record to the records of the same name, CNAMEs
+// can't have siblings
+func addCloudflareRecord(records []*cloudflareRecord, record *cloudflareRecord) ([]*cloudflareRecord, error) {
+	for _, r := range records {
+		if r.Type == "CNAME" || record.Type == "CNAME" {
+			return nil, errors.New("a CNAME can't be combined with other records")
+		}
+		if r.Type == record.Type && r.Content == record.Content {
+			return records, nil
+		}
+	}
+	return append(records, record), nil
+}
+
+// cloudflareZoneFor returns the zone with the longest name matching the dns name
+func cloudflareZoneFor(zones []*cloudflareZone, dnsName string) *cloudflareZone {
+	name := cloudflareName(dnsName)
+
+	var match *cloudflareZone
+	for _, zone := range zones {
+		if name != zone.Name && !strings.HasSuffix(name, "."+zone.Name) {
+			continue
+		}
+		if match == nil || len(zone.Name) > len(match.Name) { //get the longest match for the dns name
+			match = zone
+		}
+	}
+	return match
+}
+
+// cloudflareName returns the name in the format used by Cloudflare, i.e.
+// lower case and without trailing dot
+func cloudflareName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(pkg.SanitizeDNSName(name), "."))
+}
@@ -0,0 +1,396 @@
+package consumers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const testCloudflareToken = "token"
+
+// fakeCloudflare is a stand-in for the zone and DNS record endpoints of the
+// Cloudflare API. It returns at most two items per page to exercise the
+// pagination. Creating TXT records fails with rejectTXT.
+type fakeCloudflare struct {
+	zones     []*cloudflareZone
+	records   map[string][]*cloudflareRecord
+	nextID    int
+	rejectTXT bool
+	sync.Mutex
+}
+
+func newFakeCloudflare(zones ...*cloudflareZone) (*fakeCloudflare, *httptest.Server) {
+	api := &fakeCloudflare{
+		zones:   zones,
+		records: make(map[string][]*cloudflareRecord),
+	}
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakeCloudflare) add(zoneID, rrtype, name, content string, proxied bool) {
+	f.nextID++
+	f.records[zoneID] = append(f.records[zoneID], &cloudflareRecord{
+		ID:      strconv.Itoa(f.nextID),
+		Type:    rrtype,
+		Name:    name,
+		Content: content,
+		TTL:     300,
+		Proxied: proxied,
+	})
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testCloudflareToken {
+		f.fail(w, http.StatusForbidden, 9109, "Invalid access token")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "zones" && r.Method == "GET":
+		items := make([]interface{}, 0, len(f.zones))
+		for _, zone := range f.zones {
+			items = append(items, zone)
+		}
+		f.page(w, r, items)
+	case len(parts) == 3 && parts[2] == "dns_records" && r.Method == "GET":
+		items := make([]interface{}, 0)
+		for _, record := range f.records[parts[1]] {
+			if name := r.URL.Query().Get("name"); name == "" || name == record.Name {
+				items = append(items, record)
+			}
+		}
+		f.page(w, r, items)
+	case len(parts) == 3 && parts[2] == "dns_records" && r.Method == "POST":
+		var record cloudflareRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			f.fail(w, http.StatusBadRequest, 1000, err.Error())
+			return
+		}
+		if record.Type == "TXT" && f.rejectTXT {
+			f.fail(w, http.StatusBadRequest, 1004, "DNS Validation Error")
+			return
+		}
+		if record.Proxied && record.TTL != cloudflareAutoTTL {
+			f.fail(w, http.StatusBadRequest, 9000, "proxied records must use automatic TTL")
+			return
+		}
+		for _, existing := range f.records[parts[1]] {
+			if existing.Name == record.Name && (existing.Type == "CNAME" || record.Type == "CNAME") {
+				f.fail(w, http.StatusBadRequest, 81053, "A CNAME record with that host already exists.")
+				return
+			}
+		}
+		f.add(parts[1], record.Type, record.Name, record.Content, record.Proxied)
+		f.records[parts[1]][len(f.records[parts[1]])-1].TTL = record.TTL
+		f.succeed(w, record)
+	case len(parts) == 4 && parts[2] == "dns_records" && (r.Method == "PUT" || r.Method == "DELETE"):
+		records := f.records[parts[1]]
+		for i, existing := range records {
+			if existing.ID != parts[3] {
+				continue
+			}
+			if r.Method == "DELETE" {
+				f.records[parts[1]] = append(records[:i], records[i+1:]...)
+			} else if err := json.NewDecoder(r.Body).Decode(existing); err != nil {
+				f.fail(w, http.StatusBadRequest, 1000, err.Error())
+				return
+			}
+			existing.ID = parts[3]
+			f.succeed(w, existing)
+			return
+		}
+		f.fail(w, http.StatusNotFound, 81044, "Record does not exist.")
+	default:
+		f.fail(w, http.StatusNotFound, 7003, "Could not route to "+r.URL.Path)
+	}
+}
+
+func (f *fakeCloudflare) page(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	const perPage = 2
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"result":  items[start:end],
+		"result_info": map[string]int{
+			"page":        page,
+			"total_pages": (len(items) + perPage - 1) / perPage,
+		},
+	})
+}
+
+func (f *fakeCloudflare) succeed(w http.ResponseWriter, result interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+}
+
+func (f *fakeCloudflare) fail(w http.ResponseWriter, status, code int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"errors":  []map[string]interface{}{{"code": code, "message": message}},
+	})
+}
+
+// dump returns the records of the zone as "name type ttl content [proxied]"
+func (f *fakeCloudflare) dump(zoneID string) []string {
+	f.Lock()
+	defer f.Unlock()
+
+	result := make([]string, 0)
+	for _, r := range f.records[zoneID] {
+		record := fmt.Sprintf("%s %s %d %s", r.Name, r.Type, r.TTL, r.Content)
+		if r.Proxied {
+			record += " proxied"
+		}
+		result = append(result, record)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newTestCloudflareConsumer(t *testing.T, baseURL string) Consumer {
+	consumer, err := NewCloudflareConsumer(&CloudflareOptions{
+		BaseURL:  baseURL,
+		APIToken: testCloudflareToken,
+		GroupID:  "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestCloudflareSync(t *testing.T) {
+	api, server := newFakeCloudflare(
+		&cloudflareZone{ID: "1", Name: "example.net"},
+		&cloudflareZone{ID: "2", Name: "example.com"},
+		&cloudflareZone{ID: "3", Name: "example.org"},
+		&cloudflareZone{ID: "4", Name: "sub.example.org"},
+	)
+	defer server.Close()
+
+	api.add("3", "A", "same.example.org", "10.0.0.1", false)
+	api.add("3", "TXT", "_mate.same.example.org", `"mate:test"`, false)
+	api.add("3", "A", "changed.example.org", "10.0.0.2", false)
+	api.add("3", "A", "changed.example.org", "10.0.0.3", false)
+	api.add("3", "TXT", "_mate.changed.example.org", `"mate:test"`, false)
+	api.add("3", "A", "gone.example.org", "10.0.0.4", false)
+	api.add("3", "TXT", "_mate.gone.example.org", `"mate:test"`, false)
+	api.add("3", "A", "foreign.example.org", "10.0.0.5", false)
+	api.add("3", "TXT", "_mate.foreign.example.org", `"mate:other"`, false)
+	api.add("3", "A", "manual.example.org", "10.0.0.6", false)
+	api.add("3", "CNAME", "alias.example.org", "old.example.com", false)
+	api.add("3", "TXT", "_mate.alias.example.org", `"mate:test"`, false)
+
+	consumer := newTestCloudflareConsumer(t, server.URL)
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "changed.example.org", IP: "10.0.0.3", Proxied: true},
+		{DNSName: "changed.example.org", IP: "10.0.1.2", Proxied: true},
+		{DNSName: "foreign.example.org", IP: "10.0.1.5"},
+		{DNSName: "manual.example.org", IP: "10.0.1.6"},
+		{DNSName: "alias.example.org", IP: "10.0.1.7"},
+		{DNSName: "v6.example.org", IP: "2001:db8::1", TTL: 60},
+		{DNSName: "www.sub.example.org", Hostname: "lb.example.net", Proxied: true},
+		{DNSName: "other.example.io", IP: "10.0.1.8"},
+		{DNSName: "private.example.org", IP: "10.0.1.9", Private: true},
+	}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`_mate.alias.example.org TXT 300 "mate:test"`,
+		`_mate.changed.example.org TXT 300 "mate:test"`,
+		`_mate.foreign.example.org TXT 300 "mate:other"`,
+		`_mate.same.example.org TXT 300 "mate:test"`,
+		`_mate.v6.example.org TXT 300 "mate:test"`,
+		`alias.example.org A 300 10.0.1.7`,
+		`changed.example.org A 1 10.0.0.3 proxied`,
+		`changed.example.org A 1 10.0.1.2 proxied`,
+		`foreign.example.org A 300 10.0.0.5`,
+		`manual.example.org A 300 10.0.0.6`,
+		`same.example.org A 300 10.0.0.1`,
+		`v6.example.org AAAA 60 2001:db8::1`,
+	}
+	if records := api.dump("3"); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+
+	expected = []string{
+		`_mate.www.sub.example.org TXT 300 "mate:test"`,
+		`www.sub.example.org CNAME 1 lb.example.net proxied`,
+	}
+	if records := api.dump("4"); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestCloudflareProcess(t *testing.T) {
+	api, server := newFakeCloudflare(&cloudflareZone{ID: "1", Name: "example.org"})
+	defer server.Close()
+
+	api.add("1", "A", "owned.example.org", "10.0.0.1", false)
+	api.add("1", "TXT", "_mate.owned.example.org", `"mate:test"`, false)
+	api.add("1", "A", "cname.example.org", "10.0.0.2", false)
+	api.add("1", "TXT", "_mate.cname.example.org", `"mate:test"`, false)
+	api.add("1", "A", "foreign.example.org", "10.0.0.3", false)
+	api.add("1", "TXT", "_mate.foreign.example.org", `"mate:other"`, false)
+
+	consumer := newTestCloudflareConsumer(t, server.URL)
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.3"},
+		{DNSName: "new.example.org", IP: "10.0.1.4", Proxied: true},
+		{DNSName: "other.example.io", IP: "10.0.1.5"},
+		{DNSName: "private.example.org", IP: "10.0.1.6", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := []string{
+		`_mate.cname.example.org TXT 300 "mate:test"`,
+		`_mate.foreign.example.org TXT 300 "mate:other"`,
+		`_mate.new.example.org TXT 300 "mate:test"`,
+		`_mate.owned.example.org TXT 300 "mate:test"`,
+		`cname.example.org CNAME 300 lb.example.net`,
+		`foreign.example.org A 300 10.0.0.3`,
+		`new.example.org A 1 10.0.1.4 proxied`,
+		`owned.example.org A 300 10.0.0.1`,
+		`owned.example.org A 300 10.0.1.1`,
+	}
+	if records := api.dump("1"); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestCloudflareOwnerFirst(t *testing.T) {
+	api, server := newFakeCloudflare(&cloudflareZone{ID: "1", Name: "example.org"})
+	defer server.Close()
+
+	consumer := newTestCloudflareConsumer(t, server.URL)
+
+	// records without an owner could never be removed again
+	api.rejectTXT = true
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}}); err == nil {
+		t.Error("expected sync to fail")
+	}
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"}); err == nil {
+		t.Error("expected process to fail")
+	}
+	if records := api.dump("1"); len(records) != 0 {
+		t.Errorf("expected no records without an owner, got %v", records)
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	_, server := newFakeCloudflare(&cloudflareZone{ID: "1", Name: "example.org"})
+	defer server.Close()
+
+	consumer, err := NewCloudflareConsumer(&CloudflareOptions{
+		BaseURL:  server.URL,
+		APIToken: "wrong",
+		GroupID:  "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}})
+	if err == nil || !strings.Contains(err.Error(), "Invalid access token") {
+		t.Errorf("expected invalid token error, got %v", err)
+	}
+
+	err = consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"})
+	if err == nil {
+		t.Error("expected process to fail")
+	}
+}
+
+func TestNewCloudflareConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options CloudflareOptions
+		valid   bool
+	}{
+		{"api token", CloudflareOptions{APIToken: "token", GroupID: "test"}, true},
+		{"api key", CloudflareOptions{APIEmail: "mate@example.org", APIKey: "key", GroupID: "test"}, true},
+		{"missing credentials", CloudflareOptions{GroupID: "test"}, false},
+		{"missing api key", CloudflareOptions{APIEmail: "mate@example.org", GroupID: "test"}, false},
+		{"missing group id", CloudflareOptions{APIToken: "token"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewCloudflareConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestEndpointToCloudflareRecord(t *testing.T) {
+	for _, test := range []struct {
+		endpoint *pkg.Endpoint
+		expected *cloudflareRecord
+	}{
+		{
+			&pkg.Endpoint{DNSName: "foo.example.org.", IP: "10.0.0.1"},
+			&cloudflareRecord{Type: "A", Name: "foo.example.org", Content: "10.0.0.1", TTL: 300},
+		},
+		{
+			&pkg.Endpoint{DNSName: "Foo.example.org", IP: "2001:DB8::1", TTL: 60},
+			&cloudflareRecord{Type: "AAAA", Name: "foo.example.org", Content: "2001:db8::1", TTL: 60},
+		},
+		{
+			&pkg.Endpoint{DNSName: "foo.example.org", Hostname: "lb.example.net.", Proxied: true},
+			&cloudflareRecord{Type: "CNAME", Name: "foo.example.org", Content: "lb.example.net", TTL: 1, Proxied: true},
+		},
+	} {
+		record, err := endpointToCloudflareRecord(test.endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(record, test.expected) {
+			t.Errorf("endpointToCloudflareRecord(%v) => %v, want %v", test.endpoint, record, test.expected)
+		}
+	}
+
+	if _, err := endpointToCloudflareRecord(&pkg.Endpoint{DNSName: "foo.example.org", IP: "invalid"}); err == nil {
+		t.Error("expected an error for an invalid IP")
+	}
+}
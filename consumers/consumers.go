@@ -1,14 +1,146 @@
 package consumers
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/miekg/dns"
+
 	"github.com/zalando-incubator/mate/pkg"
 )
 
-// Consumer interface
+// Consumer interface. Sync replaces the records owned by the group with the
+// ones of the endpoints. Process applies a single endpoint between syncs: a
+// free name is created, an address is added to the records of an owned name
+// so that the endpoints of a name with several addresses don't replace each
+// other, and names owned by someone else are left alone. Addresses that are
+// gone are only removed by the next Sync.
 type Consumer interface {
 	Sync([]*pkg.Endpoint) error
 	Consume(<-chan *pkg.Endpoint, chan<- error, <-chan struct{}, *sync.WaitGroup)
 	Process(*pkg.Endpoint) error
 }
+
+const (
+	// ownerPrefix starts the value of TXT records identifying the group
+	// owning the records of a name
+	ownerPrefix = "mate:"
+	// ownerLabel is prepended to a name to get the name of its TXT owner
+	// record. A CNAME can't have any other records next to it, so the owner
+	// record can't share its name. Owner records of A records in AWS and
+	// Google predate CNAME support and stay next to the record to keep
+	// existing records owned; the AWS consumer uses this label for CNAMEs.
+	ownerLabel = "_mate."
+)
+
+// defaultTTL is the TTL of records whose endpoint doesn't set one
+const defaultTTL = int64(300)
+
+// ownerName returns the name of the TXT record holding the owner of the name
+func ownerName(name string) string {
+	return ownerLabel + name
+}
+
+// isOwnerName returns whether the name is the one of an owner record
+func isOwnerName(name string) bool {
+	return strings.HasPrefix(name, ownerLabel)
+}
+
+// ownedName returns the name owned by the owner record of the given name
+func ownedName(name string) string {
+	return strings.TrimPrefix(name, ownerLabel)
+}
+
+// ttl returns the TTL of the endpoint or the default TTL if it isn't set
+func ttl(endpoint *pkg.Endpoint) int64 {
+	if endpoint.TTL > 0 {
+		return endpoint.TTL
+	}
+	return defaultTTL
+}
+
+// canonicalName returns the fully qualified name in lower case
+func canonicalName(name string) string {
+	return strings.ToLower(pkg.SanitizeDNSName(name))
+}
+
+// containsString returns whether the list contains the string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointToRR converts the endpoint to an A or, if only a hostname is given, a CNAME record
+func endpointToRR(ep *pkg.Endpoint) (dns.RR, error) {
+	hdr := dns.RR_Header{
+		Name:  canonicalName(ep.DNSName),
+		Class: dns.ClassINET,
+		Ttl:   uint32(ttl(ep)),
+	}
+
+	if ep.IP != "" {
+		ip := net.ParseIP(ep.IP).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %s", ep.IP)
+		}
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	}
+
+	if ep.Hostname != "" {
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: canonicalName(ep.Hostname)}, nil
+	}
+
+	return nil, errors.New("neither IP nor hostname given")
+}
+
+// canAddRR returns whether the record can be added to the records of the same name, CNAMEs can't have siblings
+func canAddRR(records []dns.RR, record dns.RR) bool {
+	if len(records) == 0 {
+		return true
+	}
+	return record.Header().Rrtype != dns.TypeCNAME && records[0].Header().Rrtype != dns.TypeCNAME
+}
+
+// sameRRs compares the records ignoring their order
+func sameRRs(x, y []dns.RR) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	values := func(records []dns.RR) []string {
+		result := make([]string, 0, len(records))
+		for _, r := range records {
+			result = append(result, strings.ToLower(r.String()))
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	vx, vy := values(x), values(y)
+	for i := range vx {
+		if vx[i] != vy[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedRRNames returns the names of the records in order
+func sortedRRNames(records map[string][]dns.RR) []string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
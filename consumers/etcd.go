@@ -0,0 +1,608 @@
+package consumers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultEtcdPrefix = "/skydns"
+	etcdTimeout       = 10 * time.Second
+	// etcdLabelPrefix starts the labels of the keys mate writes below the
+	// path of a name
+	etcdLabelPrefix = "mate-"
+)
+
+// skydnsService is the value of a key in the SkyDNS layout. Owner is not
+// part of the layout and ignored by CoreDNS.
+type skydnsService struct {
+	Host  string `json:"host"`
+	TTL   uint32 `json:"ttl,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+// etcdKeyValue is a key read from etcd with the revision of its last change
+type etcdKeyValue struct {
+	Key         string
+	Value       []byte
+	ModRevision int64
+}
+
+// etcdRecords holds the keys of a single name. Foreign keys, that is keys
+// at the path of the name or directly below it which are not owned, make the
+// name unusable.
+type etcdRecords struct {
+	owned   map[string]*etcdKeyValue
+	foreign bool
+}
+
+type etcdConsumer struct {
+	client  *etcdClient
+	prefix  string
+	groupID string
+}
+
+// EtcdOptions configures the consumer for etcd. The endpoints are the ones
+// of the gRPC gateway of etcd v3, which is served on the client URLs.
+type EtcdOptions struct {
+	Endpoints []string
+	Prefix    string
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+	GroupID   string
+}
+
+// NewEtcdConsumer creates a consumer which publishes records into etcd in
+// the SkyDNS layout as served by the etcd plugin of CoreDNS. Every record
+// is a key below the path of its name, e.g.
+// /skydns/org/example/foo/mate-10-0-0-1 for foo.example.org, holding the
+// group ID owning it.
+func NewEtcdConsumer(cfg *EtcdOptions) (Consumer, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("please provide --etcd-endpoint")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --etcd-record-group-id")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultEtcdPrefix
+	}
+	if !strings.HasPrefix(cfg.Prefix, "/") {
+		return nil, fmt.Errorf("invalid --etcd-prefix %s: must start with /", cfg.Prefix)
+	}
+
+	endpoints := make([]string, 0, len(cfg.Endpoints))
+	for _, endpoint := range cfg.Endpoints {
+		if _, err := url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid --etcd-endpoint %s: %v", endpoint, err)
+		}
+		endpoints = append(endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+
+	tlsConfig, err := etcdTLSConfig(cfg.CertFile, cfg.KeyFile, cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdConsumer{
+		client: &etcdClient{
+			client: &http.Client{
+				Timeout:   etcdTimeout,
+				Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+			},
+			endpoints: endpoints,
+		},
+		prefix:  path.Clean(cfg.Prefix),
+		groupID: cfg.GroupID,
+	}, nil
+}
+
+func (d *etcdConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	desired := make(map[string]map[string]*skydnsService)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[Etcd] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		key, service, err := d.endpointToService(ep)
+		if err != nil {
+			log.Warnf("[Etcd] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		name := etcdName(ep.DNSName)
+		if desired[name] == nil {
+			desired[name] = make(map[string]*skydnsService)
+		}
+		if err := addSkyDNSService(desired[name], key, service); err != nil {
+			log.Warnf("[Etcd] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+	}
+
+	kvs, err := d.client.get(d.prefix + "/")
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %v", err)
+	}
+	current := d.group(kvs)
+
+	errs := make([]error, 0)
+
+	for name, services := range desired {
+		existing := current[name]
+		if existing != nil && existing.foreign {
+			log.Warnf("[Etcd] Skipping record %s: not owned by group ID %s", name, d.groupID)
+			continue
+		}
+
+		if err := d.apply(name, existing, services); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, existing := range current {
+		if len(existing.owned) == 0 || desired[name] != nil {
+			continue
+		}
+
+		if err := d.apply(name, existing, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *etcdConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Etcd] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Etcd] channel closed")
+				return
+			}
+
+			log.Infof("[Etcd] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Etcd] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint to a name that is either owned or
+// not in use at all.
+func (d *etcdConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[Etcd] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	key, service, err := d.endpointToService(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", endpoint.DNSName, err)
+	}
+
+	name := etcdName(endpoint.DNSName)
+	kvs, err := d.client.get(d.path(name))
+	if err != nil {
+		return fmt.Errorf("failed to get keys of %s: %v", name, err)
+	}
+
+	existing := d.group(kvs)[name]
+	if existing != nil && existing.foreign {
+		log.Warnf("[Etcd] Record [name=%s] could not be created, another record with same name already exists", name)
+		return nil
+	}
+
+	// keep the other addresses of the name
+	desired := map[string]*skydnsService{key: service}
+	if existing != nil && net.ParseIP(service.Host) != nil {
+		for k, kv := range existing.owned {
+			var other skydnsService
+			if err := json.Unmarshal(kv.Value, &other); err == nil && net.ParseIP(other.Host) != nil && k != key {
+				desired[k] = &other
+			}
+		}
+	}
+
+	return d.apply(name, existing, desired)
+}
+
+// apply changes the owned keys of a name to the desired ones in a single
+// transaction, which fails if any of the keys changed since being read. A
+// nil map of desired keys removes all keys of the name.
+func (d *etcdConsumer) apply(name string, existing *etcdRecords, desired map[string]*skydnsService) error {
+	owned := map[string]*etcdKeyValue{}
+	if existing != nil {
+		owned = existing.owned
+	}
+
+	compares := make([]etcdCompare, 0)
+	ops := make([]etcdOp, 0)
+
+	for _, key := range sortedEtcdKeys(owned) {
+		compares = append(compares, etcdCompare{key: key, modRevision: owned[key].ModRevision})
+		if _, keep := desired[key]; !keep {
+			log.Debugf("[Etcd] Deleting key %s", key)
+			ops = append(ops, etcdOp{key: key, delete: true})
+		}
+	}
+
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := json.Marshal(desired[key])
+		if err != nil {
+			return err
+		}
+
+		current, exists := owned[key]
+		if !exists {
+			// the key must not have been created in the meantime
+			compares = append(compares, etcdCompare{key: key})
+		}
+		if !exists || !bytes.Equal(current.Value, value) {
+			log.Debugf("[Etcd] Writing key %s", key)
+			ops = append(ops, etcdOp{key: key, value: value})
+		}
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	succeeded, err := d.client.txn(compares, ops)
+	if err != nil {
+		return fmt.Errorf("failed to update keys of %s: %v", name, err)
+	}
+	if !succeeded {
+		return fmt.Errorf("failed to update keys of %s: keys were modified concurrently", name)
+	}
+	return nil
+}
+
+// group assigns the keys to the names they belong to. Owned keys belong to
+// the name of their parent path. Foreign keys block the name of their own
+// path as well as the one of their parent path, as CoreDNS serves them for
+// both.
+func (d *etcdConsumer) group(kvs []*etcdKeyValue) map[string]*etcdRecords {
+	current := make(map[string]*etcdRecords)
+	entry := func(name string) *etcdRecords {
+		if _, exists := current[name]; !exists {
+			current[name] = &etcdRecords{owned: make(map[string]*etcdKeyValue)}
+		}
+		return current[name]
+	}
+
+	for _, kv := range kvs {
+		if !strings.HasPrefix(kv.Key, d.prefix+"/") {
+			continue
+		}
+		name, parent := d.name(kv.Key), d.name(path.Dir(kv.Key))
+
+		var service skydnsService
+		if err := json.Unmarshal(kv.Value, &service); err == nil && d.isResponsible(&service) {
+			entry(parent).owned[kv.Key] = kv
+			continue
+		}
+
+		entry(name).foreign = true
+		if parent != "" {
+			entry(parent).foreign = true
+		}
+	}
+
+	return current
+}
+
+// endpointToService converts the endpoint to the key and value of its record
+func (d *etcdConsumer) endpointToService(ep *pkg.Endpoint) (string, *skydnsService, error) {
+	name := etcdName(ep.DNSName)
+	if name == "" {
+		return "", nil, errors.New("empty dns name")
+	}
+
+	service := &skydnsService{
+		TTL:   uint32(ttl(ep)),
+		Owner: d.owner(),
+	}
+
+	var label string
+	switch {
+	case ep.IP != "":
+		ip := net.ParseIP(ep.IP)
+		if ip == nil {
+			return "", nil, fmt.Errorf("invalid IP address %s", ep.IP)
+		}
+		service.Host = ip.String()
+		label = etcdLabelPrefix + strings.NewReplacer(".", "-", ":", "-").Replace(service.Host)
+	case ep.Hostname != "":
+		service.Host = etcdName(ep.Hostname)
+		label = etcdLabelPrefix + "cname"
+	default:
+		return "", nil, errors.New("neither IP nor hostname given")
+	}
+
+	return d.path(name) + "/" + label, service, nil
+}
+
+// path returns the key path of a name, the labels of the name in reverse
+// order below the prefix
+func (d *etcdConsumer) path(name string) string {
+	labels := strings.Split(name, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return d.prefix + "/" + strings.Join(labels, "/")
+}
+
+// name returns the name of a key path, the inverse of path
+func (d *etcdConsumer) name(key string) string {
+	labels := strings.Split(strings.Trim(strings.TrimPrefix(key, d.prefix), "/"), "/")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// owner returns the identifier for keys as stored in their values
+func (d *etcdConsumer) owner() string {
+	return ownerPrefix + d.groupID
+}
+
+func (d *etcdConsumer) isResponsible(service *skydnsService) bool {
+	return service.Owner == d.owner()
+}
+
+// addSkyDNSService adds the record to the records of the same name, CNAMEs
+// can't have siblings
+func addSkyDNSService(services map[string]*skydnsService, key string, service *skydnsService) error {
+	isCNAME := net.ParseIP(service.Host) == nil
+	for k, s := range services {
+		if k != key && (isCNAME || net.ParseIP(s.Host) == nil) {
+			return errors.New("a CNAME can't be combined with other records")
+		}
+	}
+	services[key] = service
+	return nil
+}
+
+func sortedEtcdKeys(kvs map[string]*etcdKeyValue) []string {
+	keys := make([]string, 0, len(kvs))
+	for key := range kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// etcdName returns the name in lower case and without trailing dot
+func etcdName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(pkg.SanitizeDNSName(name), "."))
+}
+
+// etcdTLSConfig returns the configuration for client certificates and a
+// custom CA, or nil if none is given
+func etcdTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load etcd client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read etcd CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in etcd CA file %s", caFile)
+		}
+	}
+	return config, nil
+}
+
+// etcdCompare requires the key to be at the given revision of its last
+// change, a revision of 0 requires it to not exist
+type etcdCompare struct {
+	key         string
+	modRevision int64
+}
+
+// etcdOp puts the value to the key or deletes it
+type etcdOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// etcdClient talks to the JSON gRPC gateway of etcd v3. Keys and values are
+// base64 encoded and 64 bit integers are strings in its messages.
+type etcdClient struct {
+	client    *http.Client
+	endpoints []string
+}
+
+// get returns all keys starting with the prefix
+func (c *etcdClient) get(prefix string) ([]*etcdKeyValue, error) {
+	request := map[string]string{
+		"key":       etcdBytes(prefix),
+		"range_end": etcdBytes(etcdPrefixEnd(prefix)),
+	}
+
+	var response struct {
+		Kvs []struct {
+			Key         string      `json:"key"`
+			Value       string      `json:"value"`
+			ModRevision json.Number `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := c.do("/v3/kv/range", request, &response); err != nil {
+		return nil, err
+	}
+
+	kvs := make([]*etcdKeyValue, 0, len(response.Kvs))
+	for _, kv := range response.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", kv.Key, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of key %s: %v", key, err)
+		}
+		revision, err := kv.ModRevision.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision of key %s: %v", key, err)
+		}
+		kvs = append(kvs, &etcdKeyValue{Key: string(key), Value: value, ModRevision: revision})
+	}
+	return kvs, nil
+}
+
+// txn applies the operations if all comparisons hold and reports whether
+// they did
+func (c *etcdClient) txn(compares []etcdCompare, ops []etcdOp) (bool, error) {
+	type compare struct {
+		Key         string `json:"key"`
+		Target      string `json:"target"`
+		Result      string `json:"result"`
+		ModRevision string `json:"mod_revision"`
+	}
+
+	request := struct {
+		Compare []compare                `json:"compare"`
+		Success []map[string]interface{} `json:"success"`
+	}{
+		Compare: make([]compare, 0, len(compares)),
+		Success: make([]map[string]interface{}, 0, len(ops)),
+	}
+	for _, cmp := range compares {
+		request.Compare = append(request.Compare, compare{
+			Key:         etcdBytes(cmp.key),
+			Target:      "MOD",
+			Result:      "EQUAL",
+			ModRevision: fmt.Sprintf("%d", cmp.modRevision),
+		})
+	}
+	for _, op := range ops {
+		if op.delete {
+			request.Success = append(request.Success, map[string]interface{}{
+				"request_delete_range": map[string]string{"key": etcdBytes(op.key)},
+			})
+			continue
+		}
+		request.Success = append(request.Success, map[string]interface{}{
+			"request_put": map[string]string{"key": etcdBytes(op.key), "value": base64.StdEncoding.EncodeToString(op.value)},
+		})
+	}
+
+	var response struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := c.do("/v3/kv/txn", request, &response); err != nil {
+		return false, err
+	}
+	return response.Succeeded, nil
+}
+
+// do posts the request to the first endpoint reachable and decodes the
+// response into result
+func (c *etcdClient) do(method string, request, result interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range c.endpoints {
+		var resp *http.Response
+		resp, err = c.client.Post(endpoint+method, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Debugf("[Etcd] Endpoint %s failed: %v", endpoint, err)
+			continue
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			var e struct {
+				Error   string `json:"error"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(data, &e)
+			if e.Message == "" {
+				e.Message = e.Error
+			}
+			return fmt.Errorf("request failed (%s): %s", resp.Status, e.Message)
+		}
+
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("unexpected response (%s): %v", resp.Status, err)
+		}
+		return nil
+	}
+	return err
+}
+
+func etcdBytes(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// etcdPrefixEnd returns the end of the range of keys with the prefix
+func etcdPrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// the prefix consists of 0xff bytes only, range to the end of all keys
+	return "\x00"
+}
@@ -0,0 +1,347 @@
+package consumers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+// fakeEtcd is a stand-in for the key-value endpoints of the gRPC gateway of
+// etcd v3. Transactions only support comparisons of the mod revision.
+type fakeEtcd struct {
+	kvs      map[string]*etcdKeyValue
+	revision int64
+	// beforeTxn is called ahead of every transaction to simulate concurrent
+	// changes
+	beforeTxn func()
+	sync.Mutex
+}
+
+func newFakeEtcd() (*fakeEtcd, *httptest.Server) {
+	api := &fakeEtcd{kvs: make(map[string]*etcdKeyValue)}
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakeEtcd) put(key, value string) {
+	f.revision++
+	f.kvs[key] = &etcdKeyValue{Key: key, Value: []byte(value), ModRevision: f.revision}
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var request struct {
+			Key      string `json:"key"`
+			RangeEnd string `json:"range_end"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			f.fail(w, err.Error())
+			return
+		}
+		key, end := decode(request.Key), decode(request.RangeEnd)
+
+		kvs := make([]map[string]string, 0)
+		for _, k := range f.keys() {
+			if k >= key && k < end {
+				kvs = append(kvs, map[string]string{
+					"key":          etcdBytes(k),
+					"value":        base64.StdEncoding.EncodeToString(f.kvs[k].Value),
+					"mod_revision": strconv.FormatInt(f.kvs[k].ModRevision, 10),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs, "count": strconv.Itoa(len(kvs))})
+	case "/v3/kv/txn":
+		var request struct {
+			Compare []struct {
+				Key         string `json:"key"`
+				Target      string `json:"target"`
+				Result      string `json:"result"`
+				ModRevision string `json:"mod_revision"`
+			} `json:"compare"`
+			Success []struct {
+				RequestPut *struct {
+					Key   string `json:"key"`
+					Value string `json:"value"`
+				} `json:"request_put"`
+				RequestDeleteRange *struct {
+					Key string `json:"key"`
+				} `json:"request_delete_range"`
+			} `json:"success"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			f.fail(w, err.Error())
+			return
+		}
+
+		if f.beforeTxn != nil {
+			f.beforeTxn()
+		}
+
+		for _, cmp := range request.Compare {
+			if cmp.Target != "MOD" || cmp.Result != "EQUAL" {
+				f.fail(w, "unsupported comparison")
+				return
+			}
+			var current int64
+			if kv, exists := f.kvs[decode(cmp.Key)]; exists {
+				current = kv.ModRevision
+			}
+			if strconv.FormatInt(current, 10) != cmp.ModRevision {
+				json.NewEncoder(w).Encode(map[string]interface{}{})
+				return
+			}
+		}
+
+		for _, op := range request.Success {
+			switch {
+			case op.RequestPut != nil:
+				f.put(decode(op.RequestPut.Key), decode(op.RequestPut.Value))
+			case op.RequestDeleteRange != nil:
+				delete(f.kvs, decode(op.RequestDeleteRange.Key))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"succeeded": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Not Found", "code": 5})
+	}
+}
+
+func (f *fakeEtcd) fail(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": message, "message": message, "code": 3})
+}
+
+func (f *fakeEtcd) keys() []string {
+	keys := make([]string, 0, len(f.kvs))
+	for key := range f.kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dump returns the keys as "key value"
+func (f *fakeEtcd) dump() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	result := make([]string, 0)
+	for _, key := range f.keys() {
+		result = append(result, fmt.Sprintf("%s %s", key, f.kvs[key].Value))
+	}
+	return result
+}
+
+func newTestEtcdConsumer(t *testing.T, endpoints ...string) Consumer {
+	consumer, err := NewEtcdConsumer(&EtcdOptions{
+		Endpoints: endpoints,
+		GroupID:   "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestEtcdSync(t *testing.T) {
+	api, server := newFakeEtcd()
+	defer server.Close()
+
+	api.put("/skydns/org/example/same/mate-10-0-0-1", `{"host":"10.0.0.1","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/changed/mate-10-0-0-2", `{"host":"10.0.0.2","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/changed/mate-10-0-0-3", `{"host":"10.0.0.3","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/gone/mate-10-0-0-4", `{"host":"10.0.0.4","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/foreign/mate-10-0-0-5", `{"host":"10.0.0.5","ttl":300,"owner":"mate:other"}`)
+	api.put("/skydns/org/example/manual", `{"host":"10.0.0.6"}`)
+	api.put("/skydns/org/example/children/x1", `{"host":"10.0.0.7"}`)
+	api.put("/skydns/org/example/alias/mate-cname", `{"host":"old.example.com","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/com/example/www", `{"host":"10.0.0.8"}`)
+
+	consumer := newTestEtcdConsumer(t, server.URL)
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "changed.example.org", IP: "10.0.0.3", TTL: 60},
+		{DNSName: "changed.example.org", IP: "10.0.1.2", TTL: 60},
+		{DNSName: "foreign.example.org", IP: "10.0.1.5"},
+		{DNSName: "manual.example.org", IP: "10.0.1.6"},
+		{DNSName: "children.example.org", IP: "10.0.1.7"},
+		{DNSName: "alias.example.org", IP: "10.0.1.8"},
+		{DNSName: "V6.example.org.", IP: "2001:db8::1"},
+		{DNSName: "www.example.net", Hostname: "lb.example.com."},
+		{DNSName: "www.example.net", IP: "10.0.1.9"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`/skydns/com/example/www {"host":"10.0.0.8"}`,
+		`/skydns/net/example/www/mate-cname {"host":"lb.example.com","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/alias/mate-10-0-1-8 {"host":"10.0.1.8","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/changed/mate-10-0-0-3 {"host":"10.0.0.3","ttl":60,"owner":"mate:test"}`,
+		`/skydns/org/example/changed/mate-10-0-1-2 {"host":"10.0.1.2","ttl":60,"owner":"mate:test"}`,
+		`/skydns/org/example/children/x1 {"host":"10.0.0.7"}`,
+		`/skydns/org/example/foreign/mate-10-0-0-5 {"host":"10.0.0.5","ttl":300,"owner":"mate:other"}`,
+		`/skydns/org/example/manual {"host":"10.0.0.6"}`,
+		`/skydns/org/example/same/mate-10-0-0-1 {"host":"10.0.0.1","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/v6/mate-2001-db8--1 {"host":"2001:db8::1","ttl":300,"owner":"mate:test"}`,
+	}
+	if kvs := api.dump(); !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("unexpected keys\n got: %v\nwant: %v", kvs, expected)
+	}
+
+	// nothing changes on the next run
+	revision := api.revision
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.revision != revision {
+		t.Errorf("expected no writes, revision changed from %d to %d", revision, api.revision)
+	}
+}
+
+func TestEtcdProcess(t *testing.T) {
+	api, server := newFakeEtcd()
+	defer server.Close()
+
+	api.put("/skydns/org/example/owned/mate-10-0-0-1", `{"host":"10.0.0.1","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/cname/mate-10-0-0-2", `{"host":"10.0.0.2","ttl":300,"owner":"mate:test"}`)
+	api.put("/skydns/org/example/foreign/mate-10-0-0-3", `{"host":"10.0.0.3","ttl":300,"owner":"mate:other"}`)
+	api.put("/skydns/org/example/ownedx/x1", `{"host":"10.0.0.4"}`)
+
+	// the first endpoint isn't reachable
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	consumer := newTestEtcdConsumer(t, closed.URL, server.URL)
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.3"},
+		{DNSName: "new.example.org", IP: "10.0.1.4"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := []string{
+		`/skydns/org/example/cname/mate-cname {"host":"lb.example.net","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/foreign/mate-10-0-0-3 {"host":"10.0.0.3","ttl":300,"owner":"mate:other"}`,
+		`/skydns/org/example/new/mate-10-0-1-4 {"host":"10.0.1.4","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/owned/mate-10-0-0-1 {"host":"10.0.0.1","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/owned/mate-10-0-1-1 {"host":"10.0.1.1","ttl":300,"owner":"mate:test"}`,
+		`/skydns/org/example/ownedx/x1 {"host":"10.0.0.4"}`,
+	}
+	if kvs := api.dump(); !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("unexpected keys\n got: %v\nwant: %v", kvs, expected)
+	}
+}
+
+func TestEtcdConcurrentModification(t *testing.T) {
+	api, server := newFakeEtcd()
+	defer server.Close()
+
+	api.put("/skydns/org/example/owned/mate-10-0-0-1", `{"host":"10.0.0.1","ttl":300,"owner":"mate:test"}`)
+	api.beforeTxn = func() {
+		api.put("/skydns/org/example/owned/mate-10-0-0-1", `{"host":"10.0.0.1","ttl":300,"owner":"mate:other"}`)
+	}
+
+	consumer := newTestEtcdConsumer(t, server.URL)
+
+	err := consumer.Process(&pkg.Endpoint{DNSName: "owned.example.org", IP: "10.0.1.1"})
+	if err == nil || !strings.Contains(err.Error(), "modified concurrently") {
+		t.Errorf("expected concurrent modification error, got %v", err)
+	}
+
+	expected := []string{
+		`/skydns/org/example/owned/mate-10-0-0-1 {"host":"10.0.0.1","ttl":300,"owner":"mate:other"}`,
+	}
+	if kvs := api.dump(); !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("unexpected keys\n got: %v\nwant: %v", kvs, expected)
+	}
+}
+
+func TestNewEtcdConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options EtcdOptions
+		valid   bool
+	}{
+		{"valid", EtcdOptions{Endpoints: []string{"http://localhost:2379"}, GroupID: "test"}, true},
+		{"custom prefix", EtcdOptions{Endpoints: []string{"http://localhost:2379"}, Prefix: "/dns/", GroupID: "test"}, true},
+		{"missing endpoints", EtcdOptions{GroupID: "test"}, false},
+		{"missing group id", EtcdOptions{Endpoints: []string{"http://localhost:2379"}}, false},
+		{"relative prefix", EtcdOptions{Endpoints: []string{"http://localhost:2379"}, Prefix: "skydns", GroupID: "test"}, false},
+		{"missing certificate", EtcdOptions{Endpoints: []string{"https://localhost:2379"}, CertFile: "/nonexistent", KeyFile: "/nonexistent", GroupID: "test"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewEtcdConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestEtcdPath(t *testing.T) {
+	consumer := &etcdConsumer{prefix: "/skydns"}
+
+	for _, test := range []struct {
+		name string
+		path string
+	}{
+		{"example.org", "/skydns/org/example"},
+		{"foo.example.org", "/skydns/org/example/foo"},
+		{"org", "/skydns/org"},
+	} {
+		if path := consumer.path(test.name); path != test.path {
+			t.Errorf("path(%s) => %s, want %s", test.name, path, test.path)
+		}
+		if name := consumer.name(test.path); name != test.name {
+			t.Errorf("name(%s) => %s, want %s", test.path, name, test.name)
+		}
+	}
+}
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	for _, test := range []struct {
+		prefix, end string
+	}{
+		{"/skydns/", "/skydns0"},
+		{"a\xff", "b"},
+		{"\xff\xff", "\x00"},
+	} {
+		if end := etcdPrefixEnd(test.prefix); end != test.end {
+			t.Errorf("etcdPrefixEnd(%q) => %q, want %q", test.prefix, end, test.end)
+		}
+	}
+}
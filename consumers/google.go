@@ -3,10 +3,15 @@ package consumers
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/zalando-incubator/mate/pkg"
+	googleclient "github.com/zalando-incubator/mate/pkg/google"
 
 	log "github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -19,61 +24,176 @@ const (
 	labelPrefix   = "mate/record-group-id="
 )
 
+const (
+	defaultGoogleZoneRefreshInterval = 5 * time.Minute
+	defaultGoogleChangeTimeout       = 2 * time.Minute
+	defaultGoogleChangePollInterval  = time.Second
+)
+
+// GoogleClient interface
+type GoogleClient interface {
+	ListManagedZones(project string) ([]*googleclient.ManagedZone, error)
+	ListRecordSets(project, zone string) ([]*dns.ResourceRecordSet, error)
+	ListRecordSetsByName(project, zone, name string) ([]*dns.ResourceRecordSet, error)
+	CreateChange(project, zone string, change *dns.Change) (*dns.Change, error)
+	GetChange(project, zone, id string) (*dns.Change, error)
+}
+
 type googleDNSConsumer struct {
-	client  *dns.Service
-	zones   map[string]*dns.ManagedZone
+	client  GoogleClient
 	labels  []string
 	groupID string
+
+	// the zones are listed from all projects and filtered by name, domain
+	// and visibility
+	projects       []string
+	zoneNames      []string
+	domains        []string
+	zoneVisibility string
+
+	// submitted changes are polled until they are done
+	changeTimeout      time.Duration
+	changePollInterval time.Duration
+
+	// the managed zones are listed again after the refresh interval, the
+	// map is replaced as a whole so that callers can keep using their copy.
+	// The zones are keyed by project and name since a public and a private
+	// zone can have the same DNS name.
+	zonesMu             sync.Mutex
+	zones               map[string]*googleZone
+	zonesUpdated        time.Time
+	zoneRefreshInterval time.Duration
+}
+
+// googleZone is a managed zone together with the project it belongs to
+type googleZone struct {
+	*googleclient.ManagedZone
 	project string
 }
 
+func (z *googleZone) String() string {
+	return z.project + "/" + z.Name
+}
+
+// private returns whether the zone is only visible in its networks
+func (z *googleZone) private() bool {
+	return z.Visibility == "private"
+}
+
 type ownedRecord struct {
 	owner  *dns.ResourceRecordSet
 	record *dns.ResourceRecordSet
+	// foreign is whether the name has records of other types, e.g. a CNAME
+	foreign bool
 }
 
-// NewGoogleCloudDNSConsumer creates
-func NewGoogleCloudDNSConsumer(googleProject, googleRecordGroupID string) (Consumer, error) {
-	if googleProject == "" {
+// GoogleOptions configures the consumer for Google CloudDNS. Without
+// credentials file the application default credentials are used. The zones
+// of all projects are managed unless limited to the given zone names,
+// domains or visibility (public or private).
+type GoogleOptions struct {
+	Projects            []string
+	CredentialsFile     string
+	GroupID             string
+	ZoneNames           []string
+	Domains             []string
+	ZoneVisibility      string
+	ZoneRefreshInterval time.Duration
+	ChangeTimeout       time.Duration
+}
+
+// NewGoogleCloudDNSConsumer creates a consumer managing the records in the
+// managed zones of the projects
+func NewGoogleCloudDNSConsumer(cfg *GoogleOptions) (Consumer, error) {
+	if len(cfg.Projects) == 0 {
 		return nil, errors.New("Please provide --google-project")
 	}
 
-	if googleRecordGroupID == "" {
+	if cfg.GroupID == "" {
 		return nil, errors.New("Please provide --google-record-group-id")
 	}
 
-	gcloud, err := google.DefaultClient(context.Background(), dns.NdevClouddnsReadwriteScope)
+	if cfg.ZoneRefreshInterval <= 0 {
+		cfg.ZoneRefreshInterval = defaultGoogleZoneRefreshInterval
+	}
+
+	if cfg.ChangeTimeout <= 0 {
+		cfg.ChangeTimeout = defaultGoogleChangeTimeout
+	}
+
+	switch cfg.ZoneVisibility {
+	case "", "public", "private":
+	default:
+		return nil, fmt.Errorf("Invalid zone visibility %q, must be public or private", cfg.ZoneVisibility)
+	}
+
+	gcloud, err := googleHTTPClient(cfg.CredentialsFile)
 	if err != nil {
-		return nil, fmt.Errorf("Error creating default client: %v", err)
+		return nil, err
 	}
 
-	client, err := dns.New(gcloud)
+	client, err := googleclient.New(gcloud, "")
 	if err != nil {
 		return nil, fmt.Errorf("Error creating DNS service: %v", err)
 	}
 
-	resp, err := client.ManagedZones.List(googleProject).Do()
+	return withGoogleClient(client, cfg)
+}
+
+// googleHTTPClient authenticates with the service account key in the file or
+// with the application default credentials
+func googleHTTPClient(credentialsFile string) (*http.Client, error) {
+	if credentialsFile == "" {
+		gcloud, err := google.DefaultClient(context.Background(), dns.NdevClouddnsReadwriteScope)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating default client: %v", err)
+		}
+		return gcloud, nil
+	}
+
+	key, err := ioutil.ReadFile(credentialsFile)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting managed zones in project %s: %v", googleProject, err)
+		return nil, fmt.Errorf("Error reading credentials file: %v", err)
 	}
+	conf, err := google.JWTConfigFromJSON(key, dns.NdevClouddnsReadwriteScope)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing credentials file %s: %v", credentialsFile, err)
+	}
+	return conf.Client(context.Background()), nil
+}
 
-	zones := make(map[string]*dns.ManagedZone)
-	for _, z := range resp.ManagedZones {
-		zones[z.DnsName] = z
+// withGoogleClient creates the consumer with the client, listing the managed
+// zones right away
+func withGoogleClient(client GoogleClient, cfg *GoogleOptions) (*googleDNSConsumer, error) {
+	d := &googleDNSConsumer{
+		client:              client,
+		labels:              []string{heritageLabel, labelPrefix + cfg.GroupID},
+		groupID:             cfg.GroupID,
+		projects:            cfg.Projects,
+		zoneNames:           cfg.ZoneNames,
+		domains:             cfg.Domains,
+		zoneVisibility:      cfg.ZoneVisibility,
+		zoneRefreshInterval: cfg.ZoneRefreshInterval,
+		changeTimeout:       cfg.ChangeTimeout,
+		changePollInterval:  defaultGoogleChangePollInterval,
 	}
 
-	labels := []string{heritageLabel, labelPrefix + googleRecordGroupID}
+	zones, err := d.listZones()
+	if err != nil {
+		return nil, err
+	}
+	d.zones = zones
+	d.zonesUpdated = time.Now()
 
-	return &googleDNSConsumer{
-		client:  client,
-		zones:   zones,
-		labels:  labels,
-		groupID: googleRecordGroupID,
-		project: googleProject,
-	}, nil
+	return d, nil
 }
 
+// Sync submits the differences between the owned records and the endpoints:
+// missing records are added, changed ones replaced and records without
+// endpoints deleted. Records owned by others are never touched.
 func (d *googleDNSConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	d.refreshZones()
+
 	currentRecords, err := d.currentRecords()
 	if err != nil {
 		return err
@@ -82,60 +202,113 @@ func (d *googleDNSConsumer) Sync(endpoints []*pkg.Endpoint) error {
 	log.Debugln("Current records:")
 	d.printRecords(currentRecords)
 
-	change := new(dns.Change)
+	return d.applyChange(d.syncChange(currentRecords, endpoints))
+}
 
-	records := make(map[string][]string)
+// syncChange computes the changes per zone turning the owned records into
+// the ones of the endpoints. Private endpoints are placed into private zones
+// only, the others into any zone preferring the public one.
+func (d *googleDNSConsumer) syncChange(currentRecords map[*googleZone]map[string]*ownedRecord, endpoints []*pkg.Endpoint) map[*googleZone]*dns.Change {
+	desired := make(map[*googleZone]map[string]*dns.ResourceRecordSet)
+	skipped := make(map[*googleZone]map[string]bool)
 
 	for _, e := range endpoints {
-		record, exists := currentRecords[e.DNSName]
+		name := canonicalName(e.DNSName)
+
+		if e.IP == "" {
+			log.Warnf("Skipping endpoint %s without IP (only A records are supported)", e.DNSName)
+			continue
+		}
+
+		zone := d.hostedZoneFor(name, e.Private)
+		switch {
+		case zone == nil:
+			log.Warnf("Skipping endpoint %s (no managed zone found)", e.DNSName)
+			continue
+		case skipped[zone][name]:
+			continue
+		}
+
+		if record, exists := currentRecords[zone][name]; exists && (record.foreign || !d.isResponsible(record.owner)) {
+			if record.foreign {
+				log.Warnf("Skipping endpoint %s (the name has records of other types)", e.DNSName)
+			} else {
+				log.Warnf("Skipping endpoint %s (records are owned by someone else)", e.DNSName)
+			}
+			if skipped[zone] == nil {
+				skipped[zone] = make(map[string]bool)
+			}
+			skipped[zone][name] = true
+			continue
+		}
 
-		if !exists || exists && d.isResponsible(record.owner) {
-			records[e.DNSName] = append(records[e.DNSName], e.IP)
+		if desired[zone] == nil {
+			desired[zone] = make(map[string]*dns.ResourceRecordSet)
+		}
+		record, exists := desired[zone][name]
+		if !exists {
+			record = &dns.ResourceRecordSet{Name: name, Ttl: ttl(e), Type: "A"}
+			desired[zone][name] = record
+		}
+		if !containsString(record.Rrdatas, e.IP) {
+			record.Rrdatas = append(record.Rrdatas, e.IP)
+		}
+	}
+
+	changes := make(map[*googleZone]*dns.Change)
+	for zone, records := range currentRecords {
+		changes[zone] = d.zoneChange(records, desired[zone])
+	}
+	for zone, records := range desired {
+		if _, exists := changes[zone]; !exists {
+			changes[zone] = d.zoneChange(nil, records)
 		}
 	}
+	return changes
+}
+
+// zoneChange computes the change turning the owned records of a zone into
+// the desired ones
+func (d *googleDNSConsumer) zoneChange(currentRecords map[string]*ownedRecord, desired map[string]*dns.ResourceRecordSet) *dns.Change {
+	change := new(dns.Change)
 
-	for dnsName, ips := range records {
-		change.Additions = append(change.Additions,
-			&dns.ResourceRecordSet{
-				Name:    dnsName,
-				Rrdatas: ips,
-				Ttl:     300,
-				Type:    "A",
-			},
-			&dns.ResourceRecordSet{
-				Name:    dnsName,
+	for _, name := range sortedRecordNames(desired) {
+		record := desired[name]
+		sort.Strings(record.Rrdatas)
+
+		current, exists := currentRecords[name]
+		if !exists {
+			change.Additions = append(change.Additions, record, &dns.ResourceRecordSet{
+				Name:    name,
 				Rrdatas: d.labels,
-				Ttl:     300,
+				Ttl:     record.Ttl,
 				Type:    "TXT",
-			},
-		)
-	}
-
-	for _, r := range currentRecords {
-		if r.record != nil && d.isResponsible(r.owner) {
-			change.Deletions = append(change.Deletions,
-				&dns.ResourceRecordSet{
-					Name:    r.record.Name,
-					Rrdatas: r.record.Rrdatas,
-					Ttl:     r.record.Ttl,
-					Type:    r.record.Type,
-				},
-				&dns.ResourceRecordSet{
-					Name:    r.record.Name,
-					Rrdatas: d.labels,
-					Ttl:     r.record.Ttl,
-					Type:    "TXT",
-				},
-			)
-		}
-	}
-
-	err = d.applyChange(change)
-	if err != nil {
-		return fmt.Errorf("Error applying change for project %s: %v", d.project, err)
+			})
+			continue
+		}
+
+		// the owner record is kept, only the A record is replaced
+		if current.record != nil {
+			if sameRecordSet(current.record, record) {
+				continue
+			}
+			change.Deletions = append(change.Deletions, current.record)
+		}
+		change.Additions = append(change.Additions, record)
 	}
 
-	return nil
+	for _, name := range sortedOwnedNames(currentRecords) {
+		current := currentRecords[name]
+		if _, exists := desired[name]; exists || !d.isResponsible(current.owner) {
+			continue
+		}
+		if current.record != nil {
+			change.Deletions = append(change.Deletions, current.record)
+		}
+		change.Deletions = append(change.Deletions, current.owner)
+	}
+
+	return change
 }
 
 func (d *googleDNSConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
@@ -165,97 +338,186 @@ func (d *googleDNSConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<
 	}
 }
 
+// Process applies the ownership rules of Sync to the name of the endpoint:
+// a free name gets an A and an owner TXT record, the IP is added to the A
+// record of an owned name and names owned by someone else are reported as
+// conflicts.
 func (d *googleDNSConsumer) Process(endpoint *pkg.Endpoint) error {
-	change := new(dns.Change)
+	if endpoint.IP == "" {
+		log.Warnf("Skipping endpoint %s without IP (only A records are supported)", endpoint.DNSName)
+		return nil
+	}
 
-	change.Additions = []*dns.ResourceRecordSet{
-		{
-			Name:    endpoint.DNSName,
-			Rrdatas: []string{endpoint.IP},
-			Ttl:     300,
-			Type:    "A",
-		},
-		&dns.ResourceRecordSet{
-			Name:    endpoint.DNSName,
-			Rrdatas: d.labels,
-			Ttl:     300,
-			Type:    "TXT",
-		},
+	d.refreshZones()
+
+	name := canonicalName(endpoint.DNSName)
+	zone := d.hostedZoneFor(name, endpoint.Private)
+	if zone == nil {
+		log.Warnf("Skipping endpoint %s (no managed zone found)", endpoint.DNSName)
+		return nil
 	}
 
-	err := d.applyChange(change)
+	current, err := d.currentRecord(zone, name)
 	if err != nil {
-		return fmt.Errorf("Error applying change for project %s: %v", d.project, err)
+		return err
 	}
 
-	return nil
-}
+	record := &dns.ResourceRecordSet{
+		Name:    name,
+		Rrdatas: []string{endpoint.IP},
+		Ttl:     ttl(endpoint),
+		Type:    "A",
+	}
 
-func (d *googleDNSConsumer) applyChange(change *dns.Change) error {
-	if len(change.Additions) == 0 && len(change.Deletions) == 0 {
-		log.Infof("Didn't submit change (no changes)")
+	change := new(dns.Change)
+
+	switch {
+	case current == nil:
+		change.Additions = []*dns.ResourceRecordSet{record, {
+			Name:    name,
+			Rrdatas: d.labels,
+			Ttl:     record.Ttl,
+			Type:    "TXT",
+		}}
+	case !d.isResponsible(current.owner):
+		return fmt.Errorf("Conflict for %s: the records are not owned by group %s", name, d.groupID)
+	case current.record == nil:
+		change.Additions = []*dns.ResourceRecordSet{record}
+	case containsString(current.record.Rrdatas, endpoint.IP) && current.record.Ttl == record.Ttl:
+		log.Debugf("Records of %s are up to date", endpoint.DNSName)
 		return nil
+	default:
+		// keep the other addresses of the name
+		for _, ip := range current.record.Rrdatas {
+			if !containsString(record.Rrdatas, ip) {
+				record.Rrdatas = append(record.Rrdatas, ip)
+			}
+		}
+		sort.Strings(record.Rrdatas)
+
+		change.Deletions = []*dns.ResourceRecordSet{current.record}
+		change.Additions = []*dns.ResourceRecordSet{record}
 	}
 
-	additions := make(map[string][]*dns.ResourceRecordSet)
-	deletions := make(map[string][]*dns.ResourceRecordSet)
+	return d.applyChange(map[*googleZone]*dns.Change{zone: change})
+}
 
-	for _, add := range change.Additions {
-		hostedZone := d.hostedZoneFor(add.Name)
-		additions[hostedZone] = append(additions[hostedZone], add)
-	}
-	for _, del := range change.Deletions {
-		hostedZone := d.hostedZoneFor(del.Name)
-		deletions[hostedZone] = append(deletions[hostedZone], del)
+// currentRecord returns the A and TXT records of the name, nil if the name is
+// free. A CNAME is reported as a conflict since nothing can be added next to
+// it.
+func (d *googleDNSConsumer) currentRecord(zone *googleZone, name string) (*ownedRecord, error) {
+	rrsets, err := d.client.ListRecordSetsByName(zone.project, zone.Name, name)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting DNS records of %s from %s: %v", name, zone, err)
 	}
 
-	changes := make(map[string]*dns.Change)
-	for _, z := range d.zones {
-		if len(additions[z.Name]) == 0 && len(deletions[z.Name]) == 0 {
-			log.Debugf("Didn't submit change for zone %s (no changes)", z.Name)
+	var current *ownedRecord
+	for _, r := range rrsets {
+		if canonicalName(r.Name) != name {
 			continue
 		}
 
-		changes[z.Name] = &dns.Change{
-			Additions: additions[z.Name],
-			Deletions: deletions[z.Name],
+		switch r.Type {
+		case "CNAME":
+			return nil, fmt.Errorf("Conflict for %s: the name is a CNAME", name)
+		case "A", "TXT":
+			if current == nil {
+				current = &ownedRecord{}
+			}
+			if r.Type == "A" {
+				current.record = r
+			} else {
+				current.owner = r
+			}
 		}
 	}
+	return current, nil
+}
+
+// applyChange submits the change of each zone and returns the errors of all
+// zones
+func (d *googleDNSConsumer) applyChange(changes map[*googleZone]*dns.Change) error {
+	var errs []error
+	submitted := make(map[*googleZone]*dns.Change)
+	started := time.Now()
 
 	for z, c := range changes {
-		_, err := d.client.Changes.Create(d.project, z, c).Do()
+		if len(c.Additions) == 0 && len(c.Deletions) == 0 {
+			log.Debugf("Didn't submit change for zone %s (no changes)", z)
+			continue
+		}
+
+		created, err := d.client.CreateChange(z.project, z.Name, c)
 		if err != nil {
-			if strings.Contains(err.Error(), "alreadyExists") {
-				log.Warnf("Cannot update some DNS records (already exist)")
-				continue
-			}
-			log.Errorf("Unable to create change for %s/%s: %v", d.project, z, err)
+			errs = append(errs, fmt.Errorf("Unable to create change for %s: %v", z, err))
+			continue
+		}
+		log.Infof("Submitted change %s for %s (%d additions, %d deletions)", created.Id, z, len(c.Additions), len(c.Deletions))
+		submitted[z] = created
+	}
+
+	if len(submitted) == 0 && len(errs) == 0 {
+		log.Infof("Didn't submit change (no changes)")
+		return nil
+	}
+
+	// the changes of all zones propagate at the same time
+	for z, c := range submitted {
+		if err := d.waitForChange(z, c, started); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// waitForChange polls the change until it is done or the change timeout is
+// reached
+func (d *googleDNSConsumer) waitForChange(zone *googleZone, change *dns.Change, started time.Time) error {
+	deadline := started.Add(d.changeTimeout)
+
+	for change.Status != "done" {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("Change %s for %s is still %s after %s", change.Id, zone, change.Status, d.changeTimeout)
 		}
+		time.Sleep(d.changePollInterval)
+
+		current, err := d.client.GetChange(zone.project, zone.Name, change.Id)
+		if err != nil {
+			return fmt.Errorf("Unable to get change %s for %s: %v", change.Id, zone, err)
+		}
+		change = current
 	}
 
+	log.Infof("Change %s for %s is done after %s", change.Id, zone, time.Since(started))
 	return nil
 }
 
-func (d *googleDNSConsumer) currentRecords() (map[string]*ownedRecord, error) {
-	aggregatedRecords := make([]*dns.ResourceRecordSet, 0)
+// currentRecords returns the A and TXT records of the managed zones by zone
+// and name
+func (d *googleDNSConsumer) currentRecords() (map[*googleZone]map[string]*ownedRecord, error) {
+	records := make(map[*googleZone]map[string]*ownedRecord)
 
-	for _, z := range d.zones {
-		resp, err := d.client.ResourceRecordSets.List(d.project, z.Name).Do()
+	for _, z := range d.managedZones() {
+		rrsets, err := d.client.ListRecordSets(z.project, z.Name)
 		if err != nil {
-			return nil, fmt.Errorf("Error getting DNS records from %s/%s: %v", d.project, z.Name, err)
+			return nil, fmt.Errorf("Error getting DNS records from %s: %v", z, err)
 		}
 
-		aggregatedRecords = append(aggregatedRecords, resp.Rrsets...)
-	}
+		records[z] = make(map[string]*ownedRecord)
 
-	records := make(map[string]*ownedRecord)
+		for _, r := range rrsets {
+			name := canonicalName(r.Name)
 
-	for _, r := range aggregatedRecords {
-		if r.Type == "A" || r.Type == "TXT" {
-			record, exists := records[r.Name]
+			// the records of the zone itself don't block an A record
+			if name == z.DnsName && (r.Type == "SOA" || r.Type == "NS") {
+				continue
+			}
 
+			record, exists := records[z][name]
 			if !exists {
 				record = &ownedRecord{}
+				records[z][name] = record
 			}
 
 			switch r.Type {
@@ -263,33 +525,198 @@ func (d *googleDNSConsumer) currentRecords() (map[string]*ownedRecord, error) {
 				record.record = r
 			case "TXT":
 				record.owner = r
+			default:
+				record.foreign = true
 			}
-
-			records[r.Name] = record
 		}
 	}
 
 	return records, nil
 }
 
-func (d *googleDNSConsumer) printRecords(records map[string]*ownedRecord) {
-	for _, r := range records {
-		if r.record != nil && d.isResponsible(r.owner) {
-			log.Debugln(" ", r.record.Name, r.record.Type, r.record.Rrdatas)
+// Records returns the endpoints of the A records owned by the group
+func (d *googleDNSConsumer) Records() ([]*pkg.Endpoint, error) {
+	currentRecords, err := d.currentRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*pkg.Endpoint
+	for zone, records := range currentRecords {
+		for _, r := range records {
+			if r.record == nil || !d.isResponsible(r.owner) {
+				continue
+			}
+			for _, ip := range r.record.Rrdatas {
+				endpoints = append(endpoints, &pkg.Endpoint{
+					DNSName: r.record.Name,
+					IP:      ip,
+					TTL:     r.record.Ttl,
+					Private: zone.private(),
+				})
+			}
 		}
 	}
+	return endpoints, nil
 }
 
-func (d *googleDNSConsumer) hostedZoneFor(name string) string {
-	var matchName string
-	var matchID string
-	for zoneName, zone := range d.zones {
-		if strings.HasSuffix(name, zoneName) && len(zoneName) > len(matchName) { //get the longest match for the dns name
-			matchName = zoneName
-			matchID = zone.Name
+func (d *googleDNSConsumer) printRecords(records map[*googleZone]map[string]*ownedRecord) {
+	for zone, zoneRecords := range records {
+		for _, r := range zoneRecords {
+			if r.record != nil && d.isResponsible(r.owner) {
+				log.Debugln(" ", zone, r.record.Name, r.record.Type, r.record.Rrdatas)
+			}
 		}
 	}
-	return matchID
+}
+
+// listZones returns the selected managed zones of all projects by project
+// and name. If several zones of the same visibility have the same DNS name
+// the first one is used.
+func (d *googleDNSConsumer) listZones() (map[string]*googleZone, error) {
+	zones := make(map[string]*googleZone)
+	byDNSName := make(map[string]*googleZone)
+	for _, project := range d.projects {
+		managedZones, err := d.client.ListManagedZones(project)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting managed zones in project %s: %v", project, err)
+		}
+
+		for _, z := range managedZones {
+			zone := &googleZone{ManagedZone: z, project: project}
+			if !d.selectZone(zone) {
+				log.Debugf("Ignoring managed zone %s (not selected)", zone)
+				continue
+			}
+			key := z.DnsName
+			if zone.private() {
+				key = "private " + key
+			}
+			if existing, exists := byDNSName[key]; exists {
+				log.Warnf("Ignoring managed zone %s (%s is already managed in %s)", zone, z.DnsName, existing)
+				continue
+			}
+			byDNSName[key] = zone
+			zones[zone.String()] = zone
+		}
+	}
+	return zones, nil
+}
+
+// selectZone returns whether the zone matches the zone names, domains and
+// visibility to manage
+func (d *googleDNSConsumer) selectZone(zone *googleZone) bool {
+	if len(d.zoneNames) > 0 && !containsString(d.zoneNames, zone.Name) {
+		return false
+	}
+
+	if len(d.domains) > 0 {
+		matches := false
+		for _, domain := range d.domains {
+			domain = canonicalName(domain)
+			if zone.DnsName == domain || strings.HasSuffix(zone.DnsName, "."+domain) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	visibility := zone.Visibility
+	if visibility == "" {
+		visibility = "public"
+	}
+	return d.zoneVisibility == "" || d.zoneVisibility == visibility
+}
+
+// refreshZones lists the managed zones again once the refresh interval has
+// passed, so that new zones are picked up. The known zones are kept if that
+// fails.
+func (d *googleDNSConsumer) refreshZones() {
+	d.zonesMu.Lock()
+	defer d.zonesMu.Unlock()
+
+	if time.Since(d.zonesUpdated) < d.zoneRefreshInterval {
+		return
+	}
+	d.zonesUpdated = time.Now()
+
+	zones, err := d.listZones()
+	if err != nil {
+		log.Warnf("Failed to refresh the managed zones, using the known ones: %v", err)
+		return
+	}
+
+	for key, zone := range zones {
+		if _, exists := d.zones[key]; !exists {
+			log.Infof("Found new managed zone %s for %s", zone, zone.DnsName)
+		}
+	}
+	for key, zone := range d.zones {
+		if _, exists := zones[key]; !exists {
+			log.Infof("Managed zone %s for %s is gone", zone, zone.DnsName)
+		}
+	}
+	d.zones = zones
+}
+
+// managedZones returns the known managed zones by project and name
+func (d *googleDNSConsumer) managedZones() map[string]*googleZone {
+	d.zonesMu.Lock()
+	defer d.zonesMu.Unlock()
+	return d.zones
+}
+
+// hostedZoneFor returns the zone with the longest DNS name matching the name.
+// Private names are only placed into private zones, the others into any zone
+// preferring the public one if a public and a private zone match equally.
+func (d *googleDNSConsumer) hostedZoneFor(name string, private bool) *googleZone {
+	var match *googleZone
+	for _, zone := range d.managedZones() {
+		if private && !zone.private() || !strings.HasSuffix(name, zone.DnsName) {
+			continue
+		}
+		switch {
+		case match == nil, len(zone.DnsName) > len(match.DnsName): //get the longest match for the dns name
+			match = zone
+		case len(zone.DnsName) == len(match.DnsName) && match.private() && !zone.private():
+			match = zone
+		}
+	}
+	return match
+}
+
+// sameRecordSet returns whether the record sets have the same TTL and data
+func sameRecordSet(x, y *dns.ResourceRecordSet) bool {
+	if x.Ttl != y.Ttl || len(x.Rrdatas) != len(y.Rrdatas) {
+		return false
+	}
+	for _, data := range x.Rrdatas {
+		if !containsString(y.Rrdatas, data) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedRecordNames(records map[string]*dns.ResourceRecordSet) []string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedOwnedNames(records map[string]*ownedRecord) []string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (d *googleDNSConsumer) isResponsible(record *dns.ResourceRecordSet) bool {
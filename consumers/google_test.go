@@ -0,0 +1,717 @@
+package consumers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/dns/v1"
+
+	"github.com/zalando-incubator/mate/pkg"
+	googleclient "github.com/zalando-incubator/mate/pkg/google"
+	googletest "github.com/zalando-incubator/mate/pkg/google/test"
+)
+
+const testGoogleProject = "test-project"
+
+var testGoogleOwner = []string{`"heritage=mate"`, `"mate/record-group-id=test"`}
+
+// newFakeGoogle starts a fake CloudDNS with the zones example.org and
+// sub.example.org holding records of the group test, of another group and
+// records without owner
+func newFakeGoogle(t *testing.T) *googletest.Server {
+	server := googletest.NewServer()
+	server.PageSize = 2
+
+	server.AddZone(testGoogleProject, "example-org", "example.org.")
+	server.AddZone(testGoogleProject, "sub-example-org", "sub.example.org.")
+	server.AddZone("other-project", "example-net", "example.net.")
+
+	for _, r := range []*dns.ResourceRecordSet{
+		{Name: "owned.example.org.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.0.1"}},
+		{Name: "owned.example.org.", Type: "TXT", Ttl: 300, Rrdatas: testGoogleOwner},
+		{Name: "foreign.example.org.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.0.2"}},
+		{Name: "foreign.example.org.", Type: "TXT", Ttl: 300, Rrdatas: []string{`"heritage=mate"`, `"mate/record-group-id=other"`}},
+		{Name: "manual.example.org.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.0.3"}},
+	} {
+		server.AddRecordSet(testGoogleProject, "example-org", r)
+	}
+	for _, r := range []*dns.ResourceRecordSet{
+		{Name: "owned.sub.example.org.", Type: "A", Ttl: 60, Rrdatas: []string{"10.0.1.1", "10.0.1.2"}},
+		{Name: "owned.sub.example.org.", Type: "TXT", Ttl: 60, Rrdatas: testGoogleOwner},
+	} {
+		server.AddRecordSet(testGoogleProject, "sub-example-org", r)
+	}
+
+	return server
+}
+
+func newFakeGoogleClient(t *testing.T, server *googletest.Server) GoogleClient {
+	client, err := googleclient.New(http.DefaultClient, server.BasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func newFakeGoogleConsumer(t *testing.T, server *googletest.Server) *googleDNSConsumer {
+	return newFakeGoogleConsumerWith(t, server, &GoogleOptions{Projects: []string{testGoogleProject}})
+}
+
+// newFakeGoogleConsumerWith creates a consumer of the group test with the
+// zone selection of the options
+func newFakeGoogleConsumerWith(t *testing.T, server *googletest.Server, cfg *GoogleOptions) *googleDNSConsumer {
+	cfg.GroupID = "test"
+	cfg.ZoneRefreshInterval = time.Hour
+	cfg.ChangeTimeout = time.Second
+
+	consumer, err := withGoogleClient(newFakeGoogleClient(t, server), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer.changePollInterval = time.Millisecond
+	return consumer
+}
+
+var testGoogleRecords = map[string][]string{
+	"example-org": {
+		"foreign.example.org. 300 A 10.0.0.2",
+		`foreign.example.org. 300 TXT "heritage=mate" "mate/record-group-id=other"`,
+		"manual.example.org. 300 A 10.0.0.3",
+		"owned.example.org. 300 A 10.0.0.1",
+		`owned.example.org. 300 TXT "heritage=mate" "mate/record-group-id=test"`,
+	},
+	"sub-example-org": {
+		"owned.sub.example.org. 60 A 10.0.1.1 10.0.1.2",
+		`owned.sub.example.org. 60 TXT "heritage=mate" "mate/record-group-id=test"`,
+	},
+}
+
+func checkGoogleRecords(t *testing.T, server *googletest.Server, expected map[string][]string) {
+	for _, zone := range []string{"example-org", "sub-example-org"} {
+		records := server.RecordSets(testGoogleProject, zone)
+		sort.Strings(records)
+		want := append([]string{}, expected[zone]...)
+		sort.Strings(want)
+		if strings.Join(records, "\n") != strings.Join(want, "\n") {
+			t.Errorf("unexpected records in %s\n got: %s\nwant: %s", zone, strings.Join(records, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func newTestGoogleConsumer(groupID string) *googleDNSConsumer {
+	return &googleDNSConsumer{
+		zones: map[string]*googleZone{
+			"test-project/example-org":         {&googleclient.ManagedZone{Name: "example-org", DnsName: "example.org."}, "test-project"},
+			"test-project/sub-example-org":     {&googleclient.ManagedZone{Name: "sub-example-org", DnsName: "sub.example.org."}, "test-project"},
+			"test-project/private-example-org": {&googleclient.ManagedZone{Name: "private-example-org", DnsName: "example.org.", Visibility: "private"}, "test-project"},
+		},
+		labels:   []string{heritageLabel, labelPrefix + groupID},
+		groupID:  groupID,
+		projects: []string{"test-project"},
+	}
+}
+
+func dumpGoogleRecordSets(records []*dns.ResourceRecordSet) string {
+	dump := make([]string, 0, len(records))
+	for _, r := range records {
+		dump = append(dump, fmt.Sprintf("%s %d %s %s", r.Name, r.Ttl, r.Type, strings.Join(r.Rrdatas, ",")))
+	}
+	return strings.Join(dump, "\n")
+}
+
+func TestGoogleSyncChange(t *testing.T) {
+	consumer := newTestGoogleConsumer("test")
+	owner := func(name string, ttl int64) *dns.ResourceRecordSet {
+		return &dns.ResourceRecordSet{Name: name, Ttl: ttl, Type: "TXT", Rrdatas: []string{`"heritage=mate"`, `"mate/record-group-id=test"`}}
+	}
+	a := func(name string, ttl int64, ips ...string) *dns.ResourceRecordSet {
+		return &dns.ResourceRecordSet{Name: name, Ttl: ttl, Type: "A", Rrdatas: ips}
+	}
+
+	exampleOrg := consumer.zones["test-project/example-org"]
+	subExampleOrg := consumer.zones["test-project/sub-example-org"]
+	privateExampleOrg := consumer.zones["test-project/private-example-org"]
+
+	current := map[*googleZone]map[string]*ownedRecord{exampleOrg: {
+		"same.example.org.":    {owner: owner("same.example.org.", 300), record: a("same.example.org.", 300, "10.0.0.2", "10.0.0.1")},
+		"changed.example.org.": {owner: owner("changed.example.org.", 300), record: a("changed.example.org.", 300, "10.0.0.3")},
+		"ttl.example.org.":     {owner: owner("ttl.example.org.", 300), record: a("ttl.example.org.", 300, "10.0.0.4")},
+		"gone.example.org.":    {owner: owner("gone.example.org.", 60), record: a("gone.example.org.", 60, "10.0.0.5")},
+		"lonely.example.org.":  {owner: owner("lonely.example.org.", 300)},
+		"foreign.example.org.": {owner: &dns.ResourceRecordSet{Name: "foreign.example.org.", Type: "TXT", Rrdatas: []string{`"other"`}}, record: a("foreign.example.org.", 300, "10.0.0.6")},
+		"manual.example.org.":  {record: a("manual.example.org.", 300, "10.0.0.7")},
+	}}
+
+	changes := consumer.syncChange(current, []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "Same.example.org.", IP: "10.0.0.2"},
+		{DNSName: "changed.example.org", IP: "10.0.1.3"},
+		{DNSName: "ttl.example.org", IP: "10.0.0.4", TTL: 60},
+		{DNSName: "lonely.example.org", IP: "10.0.1.8"},
+		{DNSName: "new.sub.example.org", IP: "10.0.1.2"},
+		{DNSName: "new.sub.example.org", IP: "10.0.1.1"},
+		{DNSName: "new.sub.example.org", IP: "10.0.1.1"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.6"},
+		{DNSName: "manual.example.org", IP: "10.0.1.7"},
+		{DNSName: "private.example.org", IP: "10.0.1.9", Private: true},
+		{DNSName: "hostname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "other.example.io", IP: "10.0.1.10"},
+	})
+
+	if len(changes) != 3 {
+		t.Errorf("expected changes for three zones, got %v", changes)
+	}
+
+	for _, test := range []struct {
+		zone      *googleZone
+		additions string
+		deletions string
+	}{
+		{
+			exampleOrg,
+			`changed.example.org. 300 A 10.0.1.3
+lonely.example.org. 300 A 10.0.1.8
+ttl.example.org. 60 A 10.0.0.4`,
+			`changed.example.org. 300 A 10.0.0.3
+ttl.example.org. 300 A 10.0.0.4
+gone.example.org. 60 A 10.0.0.5
+gone.example.org. 60 TXT "heritage=mate","mate/record-group-id=test"`,
+		},
+		{
+			subExampleOrg,
+			`new.sub.example.org. 300 A 10.0.1.1,10.0.1.2
+new.sub.example.org. 300 TXT heritage=mate,mate/record-group-id=test`,
+			"",
+		},
+		{
+			privateExampleOrg,
+			`private.example.org. 300 A 10.0.1.9
+private.example.org. 300 TXT heritage=mate,mate/record-group-id=test`,
+			"",
+		},
+	} {
+		change := changes[test.zone]
+		if change == nil {
+			t.Errorf("expected a change for %s", test.zone)
+			continue
+		}
+		if additions := dumpGoogleRecordSets(change.Additions); additions != test.additions {
+			t.Errorf("unexpected additions in %s\n got: %s\nwant: %s", test.zone, additions, test.additions)
+		}
+		if deletions := dumpGoogleRecordSets(change.Deletions); deletions != test.deletions {
+			t.Errorf("unexpected deletions in %s\n got: %s\nwant: %s", test.zone, deletions, test.deletions)
+		}
+	}
+
+	// records in place don't cause any changes
+	change := consumer.syncChange(current, []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "same.example.org", IP: "10.0.0.2"},
+		{DNSName: "changed.example.org", IP: "10.0.0.3"},
+		{DNSName: "ttl.example.org", IP: "10.0.0.4"},
+		{DNSName: "gone.example.org", IP: "10.0.0.5", TTL: 60},
+	})[exampleOrg]
+	if len(change.Additions) != 0 || len(change.Deletions) != 1 || change.Deletions[0].Name != "lonely.example.org." {
+		t.Errorf("expected only the lonely owner record to be deleted, got %s\n%s", dumpGoogleRecordSets(change.Additions), dumpGoogleRecordSets(change.Deletions))
+	}
+}
+
+func TestGoogleConsumerSync(t *testing.T) {
+	for _, test := range []struct {
+		title     string
+		endpoints []*pkg.Endpoint
+		expected  map[string][]string
+		changes   int
+	}{
+		{
+			title: "unchanged records",
+			endpoints: []*pkg.Endpoint{
+				{DNSName: "owned.example.org", IP: "10.0.0.1"},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.2", TTL: 60},
+				{DNSName: "owned.sub.example.org.", IP: "10.0.1.1", TTL: 60},
+			},
+			expected: testGoogleRecords,
+		},
+		{
+			title: "new records",
+			endpoints: []*pkg.Endpoint{
+				{DNSName: "owned.example.org", IP: "10.0.0.1"},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.1", TTL: 60},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.2", TTL: 60},
+				{DNSName: "new.example.org", IP: "10.0.2.1"},
+				{DNSName: "new.example.org", IP: "10.0.2.2"},
+				{DNSName: "new.sub.example.org", IP: "10.0.2.3", TTL: 30},
+			},
+			expected: map[string][]string{
+				"example-org": append([]string{
+					"new.example.org. 300 A 10.0.2.1 10.0.2.2",
+					"new.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+				}, testGoogleRecords["example-org"]...),
+				"sub-example-org": append([]string{
+					"new.sub.example.org. 30 A 10.0.2.3",
+					"new.sub.example.org. 30 TXT heritage=mate mate/record-group-id=test",
+				}, testGoogleRecords["sub-example-org"]...),
+			},
+			changes: 2,
+		},
+		{
+			title: "changed records",
+			endpoints: []*pkg.Endpoint{
+				{DNSName: "owned.example.org", IP: "10.0.0.1", TTL: 60},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.1", TTL: 60},
+			},
+			expected: map[string][]string{
+				"example-org": {
+					"foreign.example.org. 300 A 10.0.0.2",
+					`foreign.example.org. 300 TXT "heritage=mate" "mate/record-group-id=other"`,
+					"manual.example.org. 300 A 10.0.0.3",
+					"owned.example.org. 60 A 10.0.0.1",
+					`owned.example.org. 300 TXT "heritage=mate" "mate/record-group-id=test"`,
+				},
+				"sub-example-org": {
+					"owned.sub.example.org. 60 A 10.0.1.1",
+					`owned.sub.example.org. 60 TXT "heritage=mate" "mate/record-group-id=test"`,
+				},
+			},
+			changes: 2,
+		},
+		{
+			title:     "removed records",
+			endpoints: []*pkg.Endpoint{},
+			expected: map[string][]string{
+				"example-org": {
+					"foreign.example.org. 300 A 10.0.0.2",
+					`foreign.example.org. 300 TXT "heritage=mate" "mate/record-group-id=other"`,
+					"manual.example.org. 300 A 10.0.0.3",
+				},
+			},
+			changes: 2,
+		},
+		{
+			title: "records of others",
+			endpoints: []*pkg.Endpoint{
+				{DNSName: "owned.example.org", IP: "10.0.0.1"},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.1", TTL: 60},
+				{DNSName: "owned.sub.example.org", IP: "10.0.1.2", TTL: 60},
+				{DNSName: "foreign.example.org", IP: "10.0.3.1"},
+				{DNSName: "manual.example.org", IP: "10.0.3.2"},
+				{DNSName: "private.example.org", IP: "10.0.3.3", Private: true},
+				{DNSName: "other.example.net", IP: "10.0.3.4"},
+			},
+			expected: testGoogleRecords,
+		},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			server := newFakeGoogle(t)
+			defer server.Close()
+
+			consumer := newFakeGoogleConsumer(t, server)
+			if err := consumer.Sync(test.endpoints); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checkGoogleRecords(t, server, test.expected)
+
+			changes := 0
+			for _, c := range server.Changes {
+				changes += len(c)
+			}
+			if changes != test.changes {
+				t.Errorf("expected %d changes, got %d", test.changes, changes)
+			}
+		})
+	}
+}
+
+func TestGoogleConsumerSyncZoneErrors(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	consumer := newFakeGoogleConsumer(t, server)
+
+	// someone else creates the record in the meantime
+	server.BeforeChange = func(project, zone string, change *dns.Change) {
+		if zone == "sub-example-org" {
+			server.AddRecordSet(project, zone, &dns.ResourceRecordSet{Name: "new.sub.example.org.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.9.9"}})
+		}
+	}
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "new.example.org", IP: "10.0.2.1"},
+		{DNSName: "new.sub.example.org", IP: "10.0.2.2"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "test-project/sub-example-org") || !strings.Contains(err.Error(), "alreadyExists") {
+		t.Errorf("expected the conflict in sub-example-org, got %v", err)
+	}
+	if strings.Contains(err.Error(), "test-project/example-org") {
+		t.Errorf("expected example-org to succeed, got %v", err)
+	}
+
+	records := strings.Join(server.RecordSets(testGoogleProject, "example-org"), "\n")
+	if !strings.Contains(records, "new.example.org. 300 A 10.0.2.1") || strings.Contains(records, "owned.example.org.") {
+		t.Errorf("expected the change of example-org to be applied, got %s", records)
+	}
+}
+
+func TestGoogleConsumerProcess(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.AddRecordSet(testGoogleProject, "example-org", &dns.ResourceRecordSet{Name: "alias.example.org.", Type: "CNAME", Ttl: 300, Rrdatas: []string{"lb.example.net."}})
+
+	consumer := newFakeGoogleConsumer(t, server)
+
+	for _, test := range []struct {
+		endpoint *pkg.Endpoint
+		err      string
+	}{
+		{&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.2.1"}, ""},
+		{&pkg.Endpoint{DNSName: "owned.example.org", IP: "10.0.2.2", TTL: 60}, ""},
+		{&pkg.Endpoint{DNSName: "owned.sub.example.org", IP: "10.0.2.3"}, ""},
+		{&pkg.Endpoint{DNSName: "private.example.org", IP: "10.0.2.4", Private: true}, ""},
+		{&pkg.Endpoint{DNSName: "other.example.net", IP: "10.0.2.5"}, ""},
+		{&pkg.Endpoint{DNSName: "foreign.example.org", IP: "10.0.2.6"}, "Conflict for foreign.example.org.: the records are not owned by group test"},
+		{&pkg.Endpoint{DNSName: "manual.example.org", IP: "10.0.2.7"}, "Conflict for manual.example.org.: the records are not owned by group test"},
+		{&pkg.Endpoint{DNSName: "alias.example.org", IP: "10.0.2.8"}, "Conflict for alias.example.org.: the name is a CNAME"},
+	} {
+		err := consumer.Process(test.endpoint)
+		if test.err == "" && err != nil {
+			t.Errorf("unexpected error processing %s: %v", test.endpoint.DNSName, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("expected error %q processing %s, got %v", test.err, test.endpoint.DNSName, err)
+		}
+	}
+
+	expected := map[string][]string{
+		"example-org": {
+			"alias.example.org. 300 CNAME lb.example.net.",
+			"foreign.example.org. 300 A 10.0.0.2",
+			`foreign.example.org. 300 TXT "heritage=mate" "mate/record-group-id=other"`,
+			"manual.example.org. 300 A 10.0.0.3",
+			"new.example.org. 300 A 10.0.2.1",
+			"new.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+			"owned.example.org. 60 A 10.0.0.1 10.0.2.2",
+			`owned.example.org. 300 TXT "heritage=mate" "mate/record-group-id=test"`,
+		},
+		"sub-example-org": {
+			"owned.sub.example.org. 300 A 10.0.1.1 10.0.1.2 10.0.2.3",
+			`owned.sub.example.org. 60 TXT "heritage=mate" "mate/record-group-id=test"`,
+		},
+	}
+	checkGoogleRecords(t, server, expected)
+
+	// records already in place don't cause a change, not even as one of
+	// several addresses
+	changes := len(server.Changes["example-org"]) + len(server.Changes["sub-example-org"])
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "new.example.org", IP: "10.0.2.1"},
+		{DNSName: "owned.sub.example.org", IP: "10.0.1.2"},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if n := len(server.Changes["example-org"]) + len(server.Changes["sub-example-org"]); n != changes {
+		t.Errorf("expected no further change, got %d", n-changes)
+	}
+}
+
+func TestGoogleConsumerPagination(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.PageSize = 1
+	server.AddZone(testGoogleProject, "example-com", "example.com.")
+	server.AddRecordSet(testGoogleProject, "example-com", &dns.ResourceRecordSet{Name: "owned.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"10.0.0.9"}})
+	server.AddRecordSet(testGoogleProject, "example-com", &dns.ResourceRecordSet{Name: "owned.example.com.", Type: "TXT", Ttl: 300, Rrdatas: testGoogleOwner})
+
+	consumer := newFakeGoogleConsumer(t, server)
+	if len(consumer.managedZones()) != 3 {
+		t.Errorf("expected all three zones, got %v", consumer.managedZones())
+	}
+
+	records, err := consumer.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := make([]string, 0, len(records))
+	for _, ep := range records {
+		dump = append(dump, fmt.Sprintf("%s %s %d", ep.DNSName, ep.IP, ep.TTL))
+	}
+	sort.Strings(dump)
+	expected := []string{
+		"owned.example.com. 10.0.0.9 300",
+		"owned.example.org. 10.0.0.1 300",
+		"owned.sub.example.org. 10.0.1.1 60",
+		"owned.sub.example.org. 10.0.1.2 60",
+	}
+	if strings.Join(dump, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", dump, expected)
+	}
+}
+
+func TestGoogleConsumerZoneRefresh(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	consumer := newFakeGoogleConsumer(t, server)
+	server.AddZone(testGoogleProject, "example-com", "example.com.")
+
+	endpoints := []*pkg.Endpoint{{DNSName: "new.example.com", IP: "10.0.2.1"}}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if records := server.RecordSets(testGoogleProject, "example-com"); len(records) != 0 {
+		t.Errorf("expected the new zone to be unknown before the refresh, got %v", records)
+	}
+
+	consumer.zonesUpdated = time.Now().Add(-2 * time.Hour)
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if records := server.RecordSets(testGoogleProject, "example-com"); len(records) != 2 {
+		t.Errorf("expected the records in the new zone after the refresh, got %v", records)
+	}
+
+	// a failing refresh keeps the known zones
+	server.Close()
+	consumer.zonesUpdated = time.Now().Add(-2 * time.Hour)
+	consumer.refreshZones()
+	if len(consumer.managedZones()) != 3 {
+		t.Errorf("expected the known zones to be kept, got %v", consumer.managedZones())
+	}
+}
+
+func TestNewGoogleConsumerMissingProject(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	if _, err := withGoogleClient(newFakeGoogleClient(t, server), &GoogleOptions{Projects: []string{testGoogleProject, "missing"}, GroupID: "test"}); err == nil {
+		t.Error("expected an error for a missing project")
+	}
+}
+
+func TestGoogleConsumerZoneSelection(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.AddZone("other-project", "example-com", "example.com.")
+	server.AddPrivateZone("other-project", "internal-example-org", "internal.example.org.")
+	// the name of the zone is taken by the first project
+	server.AddZone("other-project", "example-org", "example.org.")
+
+	for _, test := range []struct {
+		title    string
+		options  GoogleOptions
+		expected []string
+	}{
+		{
+			"all zones of the project",
+			GoogleOptions{Projects: []string{testGoogleProject}},
+			[]string{"test-project/example-org", "test-project/sub-example-org"},
+		},
+		{
+			"all zones of several projects",
+			GoogleOptions{Projects: []string{testGoogleProject, "other-project"}},
+			[]string{"other-project/example-com", "other-project/example-net", "other-project/internal-example-org", "test-project/example-org", "test-project/sub-example-org"},
+		},
+		{
+			"zone names",
+			GoogleOptions{Projects: []string{testGoogleProject, "other-project"}, ZoneNames: []string{"sub-example-org", "example-com"}},
+			[]string{"other-project/example-com", "test-project/sub-example-org"},
+		},
+		{
+			"domains",
+			GoogleOptions{Projects: []string{testGoogleProject, "other-project"}, Domains: []string{"sub.example.org", "example.com."}},
+			[]string{"other-project/example-com", "test-project/sub-example-org"},
+		},
+		{
+			"public zones",
+			GoogleOptions{Projects: []string{"other-project"}, ZoneVisibility: "public"},
+			[]string{"other-project/example-com", "other-project/example-net", "other-project/example-org"},
+		},
+		{
+			"private zones",
+			GoogleOptions{Projects: []string{testGoogleProject, "other-project"}, ZoneVisibility: "private"},
+			[]string{"other-project/internal-example-org"},
+		},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			consumer := newFakeGoogleConsumerWith(t, server, &test.options)
+
+			zones := make([]string, 0)
+			for _, z := range consumer.managedZones() {
+				zones = append(zones, z.String())
+			}
+			sort.Strings(zones)
+			if strings.Join(zones, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("unexpected zones\n got: %v\nwant: %v", zones, test.expected)
+			}
+		})
+	}
+}
+
+func TestGoogleConsumerSyncProjects(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	consumer := newFakeGoogleConsumerWith(t, server, &GoogleOptions{Projects: []string{testGoogleProject, "other-project"}})
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "new.example.org", IP: "10.0.2.1"},
+		{DNSName: "new.example.net", IP: "10.0.2.2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"new.example.net. 300 A 10.0.2.2",
+		"new.example.net. 300 TXT heritage=mate mate/record-group-id=test",
+	}
+	if records := server.RecordSets("other-project", "example-net"); strings.Join(records, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records in other-project\n got: %v\nwant: %v", records, expected)
+	}
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "new.example.net", IP: "10.0.2.3"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if records := server.RecordSets("other-project", "example-net"); records[0] != "new.example.net. 300 A 10.0.2.2 10.0.2.3" {
+		t.Errorf("expected the address to be added, got %v", records)
+	}
+}
+
+func TestGoogleConsumerSyncEscapedProject(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.AddZone("example project", "example-net", "example.net.")
+
+	consumer := newFakeGoogleConsumerWith(t, server, &GoogleOptions{Projects: []string{"example project"}})
+
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.net", IP: "10.0.2.1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"new.example.net. 300 A 10.0.2.1",
+		"new.example.net. 300 TXT heritage=mate mate/record-group-id=test",
+	}
+	if records := server.RecordSets("example project", "example-net"); strings.Join(records, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestGoogleConsumerSyncForeignCNAME(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.AddRecordSet(testGoogleProject, "example-org", &dns.ResourceRecordSet{Name: "alias.example.org.", Type: "CNAME", Ttl: 300, Rrdatas: []string{"lb.example.net."}})
+
+	consumer := newFakeGoogleConsumer(t, server)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "example.org", IP: "10.0.2.1"},
+		{DNSName: "alias.example.org", IP: "10.0.2.2"},
+		{DNSName: "new.example.org", IP: "10.0.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the name of the CNAME is skipped, the records of the apex and the
+	// unrelated name are created in the same change
+	checkGoogleRecords(t, server, map[string][]string{
+		"example-org": append(append([]string{}, testGoogleRecords["example-org"][:2]...),
+			"alias.example.org. 300 CNAME lb.example.net.",
+			"example.org. 300 A 10.0.2.1",
+			"example.org. 300 TXT heritage=mate mate/record-group-id=test",
+			"manual.example.org. 300 A 10.0.0.3",
+			"new.example.org. 300 A 10.0.2.3",
+			"new.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+		),
+	})
+}
+
+func TestGoogleConsumerPrivateZones(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	server.AddPrivateZone(testGoogleProject, "private-example-org", "example.org.")
+
+	consumer := newFakeGoogleConsumer(t, server)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.0.1"},
+		{DNSName: "internal.example.org", IP: "10.0.2.1", Private: true},
+		{DNSName: "internal.sub.example.org", IP: "10.0.2.2", Private: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the records of sub.example.org are deleted, its private endpoint goes
+	// to the private example.org zone
+	checkGoogleRecords(t, server, map[string][]string{"example-org": testGoogleRecords["example-org"]})
+
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "process.example.org", IP: "10.0.2.3", Private: true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"internal.example.org. 300 A 10.0.2.1",
+		"internal.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+		"internal.sub.example.org. 300 A 10.0.2.2",
+		"internal.sub.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+		"process.example.org. 300 A 10.0.2.3",
+		"process.example.org. 300 TXT heritage=mate mate/record-group-id=test",
+	}
+	if records := server.RecordSets(testGoogleProject, "private-example-org"); strings.Join(records, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records in the private zone\n got: %v\nwant: %v", records, expected)
+	}
+
+	records, err := consumer.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := make([]string, 0, len(records))
+	for _, ep := range records {
+		dump = append(dump, fmt.Sprintf("%s %s %t", ep.DNSName, ep.IP, ep.Private))
+	}
+	sort.Strings(dump)
+	expected = []string{
+		"internal.example.org. 10.0.2.1 true",
+		"internal.sub.example.org. 10.0.2.2 true",
+		"owned.example.org. 10.0.0.1 false",
+		"process.example.org. 10.0.2.3 true",
+	}
+	if strings.Join(dump, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", dump, expected)
+	}
+}
+
+func TestGoogleConsumerWaitForChanges(t *testing.T) {
+	server := newFakeGoogle(t)
+	defer server.Close()
+
+	consumer := newFakeGoogleConsumer(t, server)
+
+	server.PendingPolls = 3
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.2.1"}}); err != nil {
+		t.Errorf("expected the change to be done eventually, got %v", err)
+	}
+
+	// a change stuck in pending is reported once the timeout is reached
+	server.PendingPolls = -1
+	consumer.changeTimeout = 20 * time.Millisecond
+
+	err := consumer.Sync([]*pkg.Endpoint{})
+	if err == nil || !strings.Contains(err.Error(), "test-project/example-org is still pending after 20ms") {
+		t.Errorf("expected the change to time out, got %v", err)
+	}
+}
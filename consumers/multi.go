@@ -0,0 +1,119 @@
+package consumers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+type multiConsumer struct {
+	names     []string
+	consumers map[string]Consumer
+}
+
+// NewMultiConsumer provides a consumer that applies every operation to all
+// of the given consumers, e.g. to keep records in sync across several DNS
+// providers. A failure in one of the consumers doesn't stop the others, but
+// every operation waits for all of them, so a slow consumer delays the next
+// operation of the others.
+func NewMultiConsumer(consumers map[string]Consumer) (Consumer, error) {
+	if len(consumers) == 0 {
+		return nil, errors.New("please provide at least one consumer")
+	}
+
+	names := make([]string, 0, len(consumers))
+	for name := range consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &multiConsumer{
+		names:     names,
+		consumers: consumers,
+	}, nil
+}
+
+func (d *multiConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	return combineErrors(d.each(func(consumer Consumer) error {
+		return consumer.Sync(endpoints)
+	}))
+}
+
+func (d *multiConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Multi] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Multi] channel closed")
+				return
+			}
+
+			log.Infof("[Multi] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			// report the failures of each consumer separately
+			for _, err := range d.each(func(consumer Consumer) error {
+				return consumer.Process(e)
+			}) {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Multi] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+func (d *multiConsumer) Process(endpoint *pkg.Endpoint) error {
+	return combineErrors(d.each(func(consumer Consumer) error {
+		return consumer.Process(endpoint)
+	}))
+}
+
+// each concurrently applies f to all consumers, waits for all of them and
+// returns the errors of the failed ones, prefixed by the consumer's name.
+func (d *multiConsumer) each(f func(Consumer) error) []error {
+	results := make([]error, len(d.names))
+
+	var wg sync.WaitGroup
+	for i, name := range d.names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			if err := f(d.consumers[name]); err != nil {
+				results[i] = fmt.Errorf("[%s] %v", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	errs := make([]error, 0)
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func combineErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
@@ -0,0 +1,99 @@
+package consumers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+// recordingConsumer remembers the endpoints it was given and fails with err
+type recordingConsumer struct {
+	sync.Mutex
+	synced    []*pkg.Endpoint
+	processed []*pkg.Endpoint
+	err       error
+}
+
+func (d *recordingConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	d.Lock()
+	defer d.Unlock()
+	d.synced = endpoints
+	return d.err
+}
+
+func (d *recordingConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+}
+
+func (d *recordingConsumer) Process(endpoint *pkg.Endpoint) error {
+	d.Lock()
+	defer d.Unlock()
+	d.processed = append(d.processed, endpoint)
+	return d.err
+}
+
+func TestMultiConsumerSync(t *testing.T) {
+	healthy := &recordingConsumer{}
+	broken := &recordingConsumer{err: errors.New("unavailable")}
+
+	consumer, err := NewMultiConsumer(map[string]Consumer{"healthy": healthy, "broken": broken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*pkg.Endpoint{{DNSName: "example.com.", IP: "10.0.0.1"}}
+
+	err = consumer.Sync(endpoints)
+	if err == nil || !strings.Contains(err.Error(), "[broken] unavailable") || strings.Contains(err.Error(), "healthy") {
+		t.Errorf("expected error of the broken consumer only, got %v", err)
+	}
+
+	if len(healthy.synced) != 1 || len(broken.synced) != 1 {
+		t.Error("expected endpoints to be synced to all consumers")
+	}
+}
+
+func TestMultiConsumerConsume(t *testing.T) {
+	first := &recordingConsumer{err: errors.New("first failed")}
+	second := &recordingConsumer{err: errors.New("second failed")}
+	third := &recordingConsumer{}
+
+	consumer, err := NewMultiConsumer(map[string]Consumer{"first": first, "second": second, "third": third})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := make(chan *pkg.Endpoint)
+	errors := make(chan error)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go consumer.Consume(endpoints, errors, done, wg)
+
+	endpoints <- &pkg.Endpoint{DNSName: "example.com.", IP: "10.0.0.1"}
+
+	// each failing consumer reports its own error
+	if err := <-errors; err.Error() != "[first] first failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := <-errors; err.Error() != "[second] second failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	close(done)
+	wg.Wait()
+
+	for _, c := range []*recordingConsumer{first, second, third} {
+		if len(c.processed) != 1 {
+			t.Errorf("expected endpoint to be processed by all consumers, got %v", c.processed)
+		}
+	}
+}
+
+func TestMultiConsumerWithoutConsumers(t *testing.T) {
+	if _, err := NewMultiConsumer(map[string]Consumer{}); err == nil {
+		t.Error("expected error for missing consumers")
+	}
+}
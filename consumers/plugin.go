@@ -0,0 +1,325 @@
+package consumers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/zalando-incubator/mate/pkg"
+	"github.com/zalando-incubator/mate/pkg/plugin"
+)
+
+const (
+	defaultPluginTimeout = 30 * time.Second
+	// pluginUnixPrefix marks the address of a plugin listening on a unix socket
+	pluginUnixPrefix = "unix:"
+)
+
+type pluginConsumer struct {
+	client  plugin.ConsumerClient
+	address string
+	groupID string
+	timeout time.Duration
+}
+
+// PluginOptions configures the consumer for a plugin listening on a TCP
+// address or on a unix socket given as unix:<path>
+type PluginOptions struct {
+	Address string
+	GroupID string
+	Timeout time.Duration
+}
+
+// NewPluginConsumer creates a consumer which leaves the records to an
+// external plugin implementing the Consumer service of pkg/plugin. mate
+// computes the changes from the records the plugin lists as owned by the
+// group, the plugin applies them.
+func NewPluginConsumer(cfg *PluginOptions) (Consumer, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("please provide the plugin address as --consumer=plugin:<addr>")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --plugin-record-group-id")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPluginTimeout
+	}
+
+	// the connection is established in the background and retried, so that
+	// mate can start before the plugin
+	conn, err := grpc.Dial(cfg.Address, grpc.WithInsecure(), grpc.WithDialer(dialPlugin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to plugin %s: %v", cfg.Address, err)
+	}
+
+	return &pluginConsumer{
+		client:  plugin.NewConsumerClient(conn),
+		address: cfg.Address,
+		groupID: cfg.GroupID,
+		timeout: cfg.Timeout,
+	}, nil
+}
+
+// dialPlugin connects to unix sockets as well as to TCP addresses
+func dialPlugin(address string, timeout time.Duration) (net.Conn, error) {
+	if strings.HasPrefix(address, pluginUnixPrefix) {
+		return net.DialTimeout("unix", strings.TrimPrefix(address, pluginUnixPrefix), timeout)
+	}
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+// Sync lists the owned records and applies the difference to the endpoints
+func (d *pluginConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	current, err := d.client.List(ctx, &plugin.ListRequest{GroupId: d.groupID})
+	if err != nil {
+		return fmt.Errorf("failed to list records of plugin %s: %v", d.address, err)
+	}
+
+	existing := make(map[string]bool, len(current.Endpoints))
+	for _, ep := range current.Endpoints {
+		existing[endpointKey(fromPluginEndpoint(ep))] = true
+	}
+
+	changes := &plugin.ApplyRequest{GroupId: d.groupID}
+
+	desired := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		key := endpointKey(ep)
+		if desired[key] {
+			continue
+		}
+		desired[key] = true
+
+		if !existing[key] {
+			changes.Create = append(changes.Create, toPluginEndpoint(ep))
+		}
+	}
+
+	for _, ep := range current.Endpoints {
+		if !desired[endpointKey(fromPluginEndpoint(ep))] {
+			changes.Delete = append(changes.Delete, ep)
+		}
+	}
+
+	if len(changes.Create) == 0 && len(changes.Delete) == 0 {
+		log.Infof("[Plugin] No changes for plugin %s", d.address)
+		return nil
+	}
+
+	log.Debugln("[Plugin] Records to be created: ", changes.Create)
+	log.Debugln("[Plugin] Records to be deleted: ", changes.Delete)
+
+	response, err := d.client.Apply(ctx, changes)
+	if err != nil {
+		return fmt.Errorf("failed to apply changes with plugin %s: %v", d.address, err)
+	}
+
+	return combineErrors(pluginFailures(response.Failures))
+}
+
+func (d *pluginConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Plugin] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Plugin] channel closed")
+				return
+			}
+
+			log.Infof("[Plugin] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			// report the failures of each record separately
+			for _, err := range d.process(e) {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Plugin] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process hands the endpoint to the plugin
+func (d *pluginConsumer) Process(endpoint *pkg.Endpoint) error {
+	return combineErrors(d.process(endpoint))
+}
+
+func (d *pluginConsumer) process(endpoint *pkg.Endpoint) []error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	response, err := d.client.Process(ctx, &plugin.ProcessRequest{
+		GroupId:  d.groupID,
+		Endpoint: toPluginEndpoint(endpoint),
+	})
+	if err != nil {
+		return []error{fmt.Errorf("failed to process endpoint %s with plugin %s: %v", endpoint.DNSName, d.address, err)}
+	}
+
+	return pluginFailures(response.Failures)
+}
+
+// pluginFailures turns the failures reported by a plugin into errors
+func pluginFailures(failures []*plugin.Failure) []error {
+	errs := make([]error, 0, len(failures))
+	for _, failure := range failures {
+		errs = append(errs, fmt.Errorf("failed to apply record %s: %s", failure.DnsName, failure.Error))
+	}
+	return errs
+}
+
+// endpointKey identifies the records of an endpoint independent of the
+// spelling of its names. The TTL of hostname endpoints is ignored since
+// alias records, e.g. in Route53, don't have one.
+func endpointKey(ep *pkg.Endpoint) string {
+	target := ep.IP
+	recordTTL := strconv.FormatInt(ttl(ep), 10)
+	if ep.Hostname != "" {
+		target = canonicalName(ep.Hostname)
+		recordTTL = "-"
+	}
+	return strings.Join([]string{
+		canonicalName(ep.DNSName),
+		target,
+		recordTTL,
+		strconv.FormatBool(ep.Private),
+		strconv.FormatBool(ep.Proxied),
+	}, " ")
+}
+
+func toPluginEndpoint(ep *pkg.Endpoint) *plugin.Endpoint {
+	return &plugin.Endpoint{
+		DnsName:  ep.DNSName,
+		Ip:       ep.IP,
+		Hostname: ep.Hostname,
+		Ttl:      ep.TTL,
+		Private:  ep.Private,
+		Proxied:  ep.Proxied,
+	}
+}
+
+func fromPluginEndpoint(ep *plugin.Endpoint) *pkg.Endpoint {
+	return &pkg.Endpoint{
+		DNSName:  ep.DnsName,
+		IP:       ep.Ip,
+		Hostname: ep.Hostname,
+		TTL:      ep.Ttl,
+		Private:  ep.Private,
+		Proxied:  ep.Proxied,
+	}
+}
+
+// recordLister is implemented by the consumers able to serve as a plugin.
+// Records returns the endpoints of the records owned by the group.
+type recordLister interface {
+	Consumer
+	Records() ([]*pkg.Endpoint, error)
+}
+
+type pluginServer struct {
+	consumer recordLister
+	groupID  string
+}
+
+// NewPluginServer exposes a built-in consumer through the plugin protocol,
+// serving as a reference implementation for plugins. The AWS and Google
+// consumers are supported. Changes are applied by synchronizing the owned
+// records with the changes applied to them.
+func NewPluginServer(consumer Consumer, groupID string) (plugin.ConsumerServer, error) {
+	lister, ok := consumer.(recordLister)
+	if !ok {
+		return nil, fmt.Errorf("consumer %T can't serve as a plugin", consumer)
+	}
+	return &pluginServer{consumer: lister, groupID: groupID}, nil
+}
+
+func (s *pluginServer) List(ctx context.Context, req *plugin.ListRequest) (*plugin.ListResponse, error) {
+	if err := s.checkGroup(req.GroupId); err != nil {
+		return nil, err
+	}
+
+	records, err := s.consumer.Records()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "failed to list records: %v", err)
+	}
+
+	response := &plugin.ListResponse{}
+	for _, ep := range records {
+		response.Endpoints = append(response.Endpoints, toPluginEndpoint(ep))
+	}
+	return response, nil
+}
+
+func (s *pluginServer) Apply(ctx context.Context, req *plugin.ApplyRequest) (*plugin.ApplyResponse, error) {
+	if err := s.checkGroup(req.GroupId); err != nil {
+		return nil, err
+	}
+
+	records, err := s.consumer.Records()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "failed to list records: %v", err)
+	}
+
+	deleted := make(map[string]bool, len(req.Delete))
+	for _, ep := range req.Delete {
+		deleted[endpointKey(fromPluginEndpoint(ep))] = true
+	}
+
+	endpoints := make([]*pkg.Endpoint, 0, len(records)+len(req.Create))
+	for _, ep := range records {
+		if !deleted[endpointKey(ep)] {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	for _, ep := range req.Create {
+		endpoints = append(endpoints, fromPluginEndpoint(ep))
+	}
+
+	if err := s.consumer.Sync(endpoints); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "failed to apply changes: %v", err)
+	}
+	return &plugin.ApplyResponse{}, nil
+}
+
+func (s *pluginServer) Process(ctx context.Context, req *plugin.ProcessRequest) (*plugin.ProcessResponse, error) {
+	if err := s.checkGroup(req.GroupId); err != nil {
+		return nil, err
+	}
+	if req.Endpoint == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing endpoint")
+	}
+
+	response := &plugin.ProcessResponse{}
+	if err := s.consumer.Process(fromPluginEndpoint(req.Endpoint)); err != nil {
+		response.Failures = append(response.Failures, &plugin.Failure{
+			DnsName: req.Endpoint.DnsName,
+			Error:   err.Error(),
+		})
+	}
+	return response, nil
+}
+
+// checkGroup rejects requests for other groups than the one of the consumer
+func (s *pluginServer) checkGroup(groupID string) error {
+	if groupID != s.groupID {
+		return grpc.Errorf(codes.InvalidArgument, "plugin serves record group id %q, not %q", s.groupID, groupID)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package consumers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/zalando-incubator/mate/pkg"
+	awstest "github.com/zalando-incubator/mate/pkg/aws/test"
+	"github.com/zalando-incubator/mate/pkg/plugin"
+)
+
+// fakePlugin lists the configured records, remembers the requested changes
+// and reports failures for the names in fail
+type fakePlugin struct {
+	sync.Mutex
+	records   []*plugin.Endpoint
+	fail      map[string]string
+	applied   []*plugin.ApplyRequest
+	processed []*plugin.Endpoint
+}
+
+func (f *fakePlugin) List(ctx context.Context, req *plugin.ListRequest) (*plugin.ListResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	return &plugin.ListResponse{Endpoints: f.records}, nil
+}
+
+func (f *fakePlugin) Apply(ctx context.Context, req *plugin.ApplyRequest) (*plugin.ApplyResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.applied = append(f.applied, req)
+
+	response := &plugin.ApplyResponse{}
+	for _, ep := range req.Create {
+		response.Failures = append(response.Failures, f.failures(ep)...)
+	}
+	return response, nil
+}
+
+func (f *fakePlugin) Process(ctx context.Context, req *plugin.ProcessRequest) (*plugin.ProcessResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.processed = append(f.processed, req.Endpoint)
+	return &plugin.ProcessResponse{Failures: f.failures(req.Endpoint)}, nil
+}
+
+func (f *fakePlugin) failures(ep *plugin.Endpoint) []*plugin.Failure {
+	var failures []*plugin.Failure
+	if message, ok := f.fail[ep.DnsName]; ok {
+		for _, m := range strings.Split(message, ",") {
+			failures = append(failures, &plugin.Failure{DnsName: ep.DnsName, Error: m})
+		}
+	}
+	return failures
+}
+
+// servePlugin serves the plugin on the listener until the returned function
+// is called
+func servePlugin(t *testing.T, network, address string, srv plugin.ConsumerServer) (string, func()) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	plugin.RegisterConsumerServer(server, srv)
+	go server.Serve(listener)
+
+	if network == "unix" {
+		return pluginUnixPrefix + address, server.Stop
+	}
+	return listener.Addr().String(), server.Stop
+}
+
+func newTestPluginConsumer(t *testing.T, address string) *pluginConsumer {
+	consumer, err := NewPluginConsumer(&PluginOptions{Address: address, GroupID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer.(*pluginConsumer)
+}
+
+func dumpPluginEndpoints(endpoints []*plugin.Endpoint) []string {
+	dump := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		dump = append(dump, strings.TrimSpace(fmt.Sprintf("%s %s%s %d", ep.DnsName, ep.Ip, ep.Hostname, ep.Ttl)))
+	}
+	sort.Strings(dump)
+	return dump
+}
+
+func TestPluginConsumer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mate-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := &fakePlugin{
+		records: []*plugin.Endpoint{
+			{DnsName: "a.example.org", Ip: "10.0.0.1"},
+			{DnsName: "b.example.org", Hostname: "lb.example.net"},
+			{DnsName: "ttl.example.org", Ip: "10.0.0.2", Ttl: 60},
+		},
+		fail: map[string]string{"c.example.org": "zone not found", "d.example.org": "one,two"},
+	}
+	address, stop := servePlugin(t, "unix", filepath.Join(dir, "plugin.sock"), fake)
+	defer stop()
+
+	consumer := newTestPluginConsumer(t, address)
+
+	err = consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "A.example.org.", IP: "10.0.0.1", TTL: 300},
+		{DNSName: "ttl.example.org", IP: "10.0.0.2", TTL: 120},
+		{DNSName: "c.example.org", IP: "10.0.0.3"},
+		{DNSName: "c.example.org", IP: "10.0.0.3"},
+	})
+	if err == nil || err.Error() != "failed to apply record c.example.org: zone not found" {
+		t.Errorf("expected the failure of the plugin, got %v", err)
+	}
+
+	if len(fake.applied) != 1 {
+		t.Fatalf("expected one change, got %d", len(fake.applied))
+	}
+	if fake.applied[0].GroupId != "test" {
+		t.Errorf("expected group id test, got %s", fake.applied[0].GroupId)
+	}
+	expected := []string{"c.example.org 10.0.0.3 0", "ttl.example.org 10.0.0.2 120"}
+	if created := dumpPluginEndpoints(fake.applied[0].Create); strings.Join(created, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records to create\n got: %v\nwant: %v", created, expected)
+	}
+	expected = []string{"b.example.org lb.example.net 0", "ttl.example.org 10.0.0.2 60"}
+	if deleted := dumpPluginEndpoints(fake.applied[0].Delete); strings.Join(deleted, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records to delete\n got: %v\nwant: %v", deleted, expected)
+	}
+
+	// the records in place don't cause any changes
+	if err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "a.example.org", IP: "10.0.0.1"},
+		{DNSName: "b.example.org", Hostname: "lb.example.net."},
+		{DNSName: "ttl.example.org", IP: "10.0.0.2", TTL: 60},
+	}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(fake.applied) != 1 {
+		t.Errorf("expected no further changes, got %d", len(fake.applied))
+	}
+
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "e.example.org", IP: "10.0.0.5"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(fake.processed) != 1 || fake.processed[0].DnsName != "e.example.org" || fake.processed[0].Ip != "10.0.0.5" {
+		t.Errorf("expected the endpoint to be processed, got %v", fake.processed)
+	}
+}
+
+func TestPluginConsume(t *testing.T) {
+	fake := &fakePlugin{fail: map[string]string{"d.example.org": "one,two"}}
+	address, stop := servePlugin(t, "tcp", "127.0.0.1:0", fake)
+	defer stop()
+
+	consumer := newTestPluginConsumer(t, address)
+
+	endpoints := make(chan *pkg.Endpoint)
+	errors := make(chan error, 4)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go consumer.Consume(endpoints, errors, done, wg)
+
+	endpoints <- &pkg.Endpoint{DNSName: "d.example.org", IP: "10.0.0.1"}
+	// the unbuffered channel is only read again once the endpoint is processed
+	endpoints <- &pkg.Endpoint{DNSName: "e.example.org", IP: "10.0.0.2"}
+
+	close(done)
+	wg.Wait()
+	close(errors)
+
+	messages := make([]string, 0)
+	for err := range errors {
+		messages = append(messages, err.Error())
+	}
+	expected := []string{"failed to apply record d.example.org: one", "failed to apply record d.example.org: two"}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected errors\n got: %v\nwant: %v", messages, expected)
+	}
+}
+
+func TestPluginServerAWS(t *testing.T) {
+	groupID := "test"
+	client := awstest.NewClient(groupID, awstest.GetOriginalState(fmt.Sprintf("\"mate:%s\"", groupID)), awstest.GetHostedZones())
+
+	srv, err := NewPluginServer(withClient(client, groupID), groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, stop := servePlugin(t, "tcp", "127.0.0.1:0", srv)
+	defer stop()
+
+	consumer := newTestPluginConsumer(t, address)
+
+	current, err := consumer.client.List(context.Background(), &plugin.ListRequest{GroupId: groupID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"public-ip.foo.com. 127.0.0.1 0",
+		"test.example.com. 404.eu-central-1.elb.amazonaws.com 0",
+		"update.example.com. 302.eu-central-1.elb.amazonaws.com 0",
+		"update.foo.com. 404.eu-central-1.elb.amazonaws.com 0",
+	}
+	if records := dumpPluginEndpoints(current.Endpoints); strings.Join(records, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+
+	err = consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "test.example.com", Hostname: "404.eu-central-1.elb.amazonaws.com"},
+		{DNSName: "update.example.com", Hostname: "302.eu-central-1.elb.amazonaws.com"},
+		{DNSName: "update.foo.com", Hostname: "404.eu-central-1.elb.amazonaws.com"},
+		{DNSName: "new.foo.com", IP: "10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if upsert := client.LastUpsert["foo.com."]; len(upsert) != 2 || aws.StringValue(upsert[0].Name) != "new.foo.com." {
+		t.Errorf("expected new.foo.com to be created, got %v", upsert)
+	}
+	if del := client.LastDelete["foo.com."]; len(del) != 2 || aws.StringValue(del[0].Name) != "public-ip.foo.com." {
+		t.Errorf("expected public-ip.foo.com to be deleted, got %v", del)
+	}
+	if len(client.LastUpsert["example.com."]) != 0 || len(client.LastDelete["example.com."]) != 0 {
+		t.Errorf("expected no changes in example.com, got %v and %v", client.LastUpsert["example.com."], client.LastDelete["example.com."])
+	}
+
+	if _, err := consumer.client.List(context.Background(), &plugin.ListRequest{GroupId: "other"}); err == nil {
+		t.Error("expected an error for another group id")
+	}
+}
+
+// applyCountingServer counts the Apply calls of the plugin server
+type applyCountingServer struct {
+	plugin.ConsumerServer
+	sync.Mutex
+	applies int
+}
+
+func (s *applyCountingServer) Apply(ctx context.Context, req *plugin.ApplyRequest) (*plugin.ApplyResponse, error) {
+	s.Lock()
+	s.applies++
+	s.Unlock()
+	return s.ConsumerServer.Apply(ctx, req)
+}
+
+func TestPluginServerAWSAliasTTL(t *testing.T) {
+	groupID := "test"
+	client := awstest.NewClient(groupID, awstest.GetOriginalState(fmt.Sprintf("\"mate:%s\"", groupID)), awstest.GetHostedZones())
+
+	server, err := NewPluginServer(withClient(client, groupID), groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &applyCountingServer{ConsumerServer: server}
+	address, stop := servePlugin(t, "tcp", "127.0.0.1:0", srv)
+	defer stop()
+
+	consumer := newTestPluginConsumer(t, address)
+
+	// alias records are listed without TTL, the TTL of their endpoints
+	// doesn't cause any changes
+	err = consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "public-ip.foo.com", IP: "127.0.0.1", TTL: 300},
+		{DNSName: "test.example.com", Hostname: "404.eu-central-1.elb.amazonaws.com", TTL: 60},
+		{DNSName: "update.example.com", Hostname: "302.eu-central-1.elb.amazonaws.com", TTL: 60},
+		{DNSName: "update.foo.com", Hostname: "404.eu-central-1.elb.amazonaws.com", TTL: 60},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv.Lock()
+	defer srv.Unlock()
+	if srv.applies != 0 {
+		t.Errorf("expected no changes to be applied, got %d calls", srv.applies)
+	}
+}
+
+func TestNewPluginServer(t *testing.T) {
+	if _, err := NewPluginServer(&stdoutConsumer{}, "test"); err == nil {
+		t.Error("expected an error for a consumer unable to list its records")
+	}
+}
+
+func TestNewPluginConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options PluginOptions
+		valid   bool
+	}{
+		{"valid", PluginOptions{Address: "localhost:5000", GroupID: "test"}, true},
+		{"unix socket", PluginOptions{Address: "unix:/run/mate/plugin.sock", GroupID: "test"}, true},
+		{"missing address", PluginOptions{GroupID: "test"}, false},
+		{"missing group id", PluginOptions{Address: "localhost:5000"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewPluginConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
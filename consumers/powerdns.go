@@ -0,0 +1,512 @@
+package consumers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultPowerDNSServerID   = "localhost"
+	powerDNSTimeout           = 30 * time.Second
+	powerDNSChangeTypeReplace = "REPLACE"
+	powerDNSChangeTypeDelete  = "DELETE"
+)
+
+type powerDNSZone struct {
+	ID     string           `json:"id"`
+	Name   string           `json:"name"`
+	RRSets []*powerDNSRRSet `json:"rrsets,omitempty"`
+}
+
+type powerDNSRRSet struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	TTL        int64             `json:"ttl,omitempty"`
+	ChangeType string            `json:"changetype,omitempty"`
+	Records    []*powerDNSRecord `json:"records"`
+}
+
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type powerDNSPatch struct {
+	RRSets []*powerDNSRRSet `json:"rrsets"`
+}
+
+// powerDNSName holds the rrsets of a single name in a zone
+type powerDNSName struct {
+	owner  string
+	rrsets map[string]*powerDNSRRSet
+}
+
+type powerDNSConsumer struct {
+	client   *http.Client
+	baseURL  string
+	apiKey   string
+	serverID string
+	groupID  string
+}
+
+// PowerDNSOptions configures the consumer for the PowerDNS Authoritative
+// HTTP API.
+type PowerDNSOptions struct {
+	ServerURL string
+	APIKey    string
+	ServerID  string
+	GroupID   string
+}
+
+// NewPowerDNSConsumer creates a consumer which manages records through the
+// HTTP API of a PowerDNS Authoritative server. Ownership of records is tracked
+// by a TXT record, see ownerName.
+func NewPowerDNSConsumer(cfg *PowerDNSOptions) (Consumer, error) {
+	if cfg.ServerURL == "" {
+		return nil, errors.New("please provide --powerdns-server")
+	}
+	if _, err := url.Parse(cfg.ServerURL); err != nil {
+		return nil, fmt.Errorf("invalid --powerdns-server %s: %v", cfg.ServerURL, err)
+	}
+	if cfg.APIKey == "" {
+		return nil, errors.New("please provide --powerdns-api-key")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --powerdns-record-group-id")
+	}
+	if cfg.ServerID == "" {
+		cfg.ServerID = defaultPowerDNSServerID
+	}
+
+	return &powerDNSConsumer{
+		client:   &http.Client{Timeout: powerDNSTimeout},
+		baseURL:  strings.TrimSuffix(cfg.ServerURL, "/"),
+		apiKey:   cfg.APIKey,
+		serverID: cfg.ServerID,
+		groupID:  cfg.GroupID,
+	}, nil
+}
+
+func (d *powerDNSConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		log.Warnln("[PowerDNS] No zones found. At least one zone should be created to create DNS records...")
+		return nil
+	}
+
+	desired := make(map[string]map[string]*powerDNSRRSet)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[PowerDNS] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		zone := powerDNSZoneFor(zones, ep.DNSName)
+		if zone == nil {
+			log.Warnf("[PowerDNS] Zone for endpoint %s was not found. Skipping record...", ep.DNSName)
+			continue
+		}
+
+		if desired[zone.ID] == nil {
+			desired[zone.ID] = make(map[string]*powerDNSRRSet)
+		}
+		if err := powerDNSAddEndpoint(desired[zone.ID], ep); err != nil {
+			log.Warnf("[PowerDNS] Skipping record %s: %v", ep.DNSName, err)
+		}
+	}
+
+	errs := make([]error, 0)
+	for _, zone := range zones {
+		if err := d.syncZone(zone, desired[zone.ID]); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %v", zone.Name, err))
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// syncZone brings the records of the zone in line with the desired ones
+// using a single PATCH request.
+func (d *powerDNSConsumer) syncZone(zone *powerDNSZone, desired map[string]*powerDNSRRSet) error {
+	current, err := d.currentRecords(zone)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]*powerDNSRRSet, 0)
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rrset := desired[name]
+
+		existing, exists := current[name]
+		switch {
+		case !exists:
+			changes = append(changes, powerDNSReplace(rrset), powerDNSReplace(d.ownerRRSet(name, rrset.TTL)))
+		case existing.owner != d.owner():
+			log.Warnf("[PowerDNS] Skipping record %s: with a group ID: %s", name, existing.owner)
+		case !powerDNSSameRRSet(existing.rrsets[rrset.Type], rrset):
+			changes = append(changes, powerDNSReplace(rrset))
+			for _, other := range powerDNSManagedTypes {
+				if other != rrset.Type && existing.rrsets[other] != nil {
+					changes = append(changes, powerDNSRemove(existing.rrsets[other]))
+				}
+			}
+		}
+	}
+
+	for name, existing := range current {
+		if existing.owner != d.owner() || desired[name] != nil {
+			continue
+		}
+		for _, rrtype := range powerDNSManagedTypes {
+			if existing.rrsets[rrtype] != nil {
+				changes = append(changes, powerDNSRemove(existing.rrsets[rrtype]))
+			}
+		}
+		changes = append(changes, powerDNSRemove(d.ownerRRSet(name, 0)))
+	}
+
+	if len(changes) == 0 {
+		log.Infoln("[PowerDNS] No changes submitted for zone: ", zone.Name)
+		return nil
+	}
+
+	log.Debugln("[PowerDNS] Changes for zone:", zone.Name, changes)
+
+	return d.patch(zone, changes)
+}
+
+func (d *powerDNSConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[PowerDNS] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[PowerDNS] channel closed")
+				return
+			}
+
+			log.Infof("[PowerDNS] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[PowerDNS] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint to a name that is either owned or
+// not in use at all.
+func (d *powerDNSConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[PowerDNS] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	zones, err := d.zones()
+	if err != nil {
+		return err
+	}
+
+	zone := powerDNSZoneFor(zones, endpoint.DNSName)
+	if zone == nil {
+		log.Warnf("[PowerDNS] Zone for endpoint %s was not found. Skipping record...", endpoint.DNSName)
+		return nil
+	}
+
+	current, err := d.currentRecords(zone)
+	if err != nil {
+		return err
+	}
+
+	name := pkg.SanitizeDNSName(endpoint.DNSName)
+	existing, exists := current[name]
+
+	if exists && existing.owner != d.owner() {
+		log.Warnf("[PowerDNS] Record [name=%s] could not be created, another record with same name already exists", name)
+		return nil
+	}
+
+	desired := make(map[string]*powerDNSRRSet)
+	if exists && endpoint.IP != "" && existing.rrsets["A"] != nil {
+		// keep the other addresses of the name
+		desired[name] = &powerDNSRRSet{Name: name, Type: "A", TTL: ttl(endpoint), Records: existing.rrsets["A"].Records}
+	}
+	if err := powerDNSAddEndpoint(desired, endpoint); err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", name, err)
+	}
+	rrset := desired[name]
+
+	changes := []*powerDNSRRSet{powerDNSReplace(rrset)}
+	if !exists {
+		changes = append(changes, powerDNSReplace(d.ownerRRSet(name, rrset.TTL)))
+	} else {
+		for _, other := range powerDNSManagedTypes {
+			if other != rrset.Type && existing.rrsets[other] != nil {
+				changes = append(changes, powerDNSRemove(existing.rrsets[other]))
+			}
+		}
+	}
+
+	return d.patch(zone, changes)
+}
+
+// zones returns the zones of the server
+func (d *powerDNSConsumer) zones() ([]*powerDNSZone, error) {
+	var zones []*powerDNSZone
+	if err := d.do("GET", d.zonesURL(), nil, &zones); err != nil {
+		return nil, fmt.Errorf("failed to list zones: %v", err)
+	}
+	return zones, nil
+}
+
+// currentRecords returns the names of the zone with their owner and their
+// rrsets. Owner records are assigned to the name they belong to.
+func (d *powerDNSConsumer) currentRecords(zone *powerDNSZone) (map[string]*powerDNSName, error) {
+	var details powerDNSZone
+	if err := d.do("GET", d.zoneURL(zone), nil, &details); err != nil {
+		return nil, fmt.Errorf("failed to list records: %v", err)
+	}
+
+	names := make(map[string]*powerDNSName)
+	for _, rrset := range details.RRSets {
+		name := pkg.SanitizeDNSName(rrset.Name)
+
+		if rrset.Type == "TXT" && isOwnerName(name) {
+			for _, record := range rrset.Records {
+				if strings.HasPrefix(strings.Trim(record.Content, `"`), ownerPrefix) {
+					powerDNSEntry(names, ownedName(name)).owner = record.Content
+				}
+			}
+			continue
+		}
+
+		powerDNSEntry(names, name).rrsets[rrset.Type] = rrset
+	}
+
+	return names, nil
+}
+
+func powerDNSEntry(names map[string]*powerDNSName, name string) *powerDNSName {
+	current, exists := names[name]
+	if !exists {
+		current = &powerDNSName{rrsets: make(map[string]*powerDNSRRSet)}
+		names[name] = current
+	}
+	return current
+}
+
+func (d *powerDNSConsumer) patch(zone *powerDNSZone, changes []*powerDNSRRSet) error {
+	if err := d.do("PATCH", d.zoneURL(zone), &powerDNSPatch{RRSets: changes}, nil); err != nil {
+		return fmt.Errorf("failed to change records: %v", err)
+	}
+	return nil
+}
+
+// do sends the request to the API and decodes the response into result
+// unless it is nil
+func (d *powerDNSConsumer) do(method, target string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", d.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiError) == nil && apiError.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, target, apiError.Error)
+		}
+		return fmt.Errorf("%s %s: unexpected status %s", method, target, resp.Status)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (d *powerDNSConsumer) zonesURL() string {
+	return fmt.Sprintf("%s/api/v1/servers/%s/zones", d.baseURL, url.QueryEscape(d.serverID))
+}
+
+func (d *powerDNSConsumer) zoneURL(zone *powerDNSZone) string {
+	return d.zonesURL() + "/" + url.QueryEscape(zone.ID)
+}
+
+// owner returns the identifier for records as stored in TXT records
+func (d *powerDNSConsumer) owner() string {
+	return fmt.Sprintf("\"%s%s\"", ownerPrefix, d.groupID)
+}
+
+// ownerRRSet returns the TXT rrset which accompanies the records of a name
+func (d *powerDNSConsumer) ownerRRSet(name string, ttl int64) *powerDNSRRSet {
+	return &powerDNSRRSet{
+		Name:    ownerName(name),
+		Type:    "TXT",
+		TTL:     ttl,
+		Records: []*powerDNSRecord{{Content: d.owner()}},
+	}
+}
+
+// powerDNSManagedTypes are the types of the rrsets created for endpoints
+var powerDNSManagedTypes = []string{"A", "CNAME"}
+
+// powerDNSAddEndpoint adds the endpoint to the rrset of its name, an A rrset for IPs
+// and a CNAME rrset for hostnames
+func powerDNSAddEndpoint(rrsets map[string]*powerDNSRRSet, ep *pkg.Endpoint) error {
+	name := pkg.SanitizeDNSName(ep.DNSName)
+
+	var rrtype, content string
+	switch {
+	case ep.IP != "":
+		if ip := net.ParseIP(ep.IP); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid IPv4 address %s", ep.IP)
+		}
+		rrtype, content = "A", ep.IP
+	case ep.Hostname != "":
+		rrtype, content = "CNAME", pkg.SanitizeDNSName(ep.Hostname)
+	default:
+		return errors.New("neither IP nor hostname given")
+	}
+
+	rrset, exists := rrsets[name]
+	if !exists {
+		rrsets[name] = &powerDNSRRSet{
+			Name:    name,
+			Type:    rrtype,
+			TTL:     ttl(ep),
+			Records: []*powerDNSRecord{{Content: content}},
+		}
+		return nil
+	}
+
+	if rrset.Type != rrtype || rrtype == "CNAME" {
+		return errors.New("a CNAME can't be combined with other records")
+	}
+	for _, record := range rrset.Records {
+		if record.Content == content {
+			return nil
+		}
+	}
+	rrset.Records = append(rrset.Records, &powerDNSRecord{Content: content})
+	return nil
+}
+
+// powerDNSZoneFor returns the zone with the longest name matching the dns name
+func powerDNSZoneFor(zones []*powerDNSZone, dnsName string) *powerDNSZone {
+	name := pkg.SanitizeDNSName(dnsName)
+
+	var match *powerDNSZone
+	var matchName string
+	for _, zone := range zones {
+		zoneName := pkg.SanitizeDNSName(zone.Name)
+		if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+			continue
+		}
+		if len(zoneName) > len(matchName) { //get the longest match for the dns name
+			match = zone
+			matchName = zoneName
+		}
+	}
+	return match
+}
+
+// powerDNSSameRRSet compares the TTL and records of two rrsets ignoring the order
+func powerDNSSameRRSet(x, y *powerDNSRRSet) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	if x.TTL != y.TTL || len(x.Records) != len(y.Records) {
+		return false
+	}
+
+	contents := make(map[string]bool, len(x.Records))
+	for _, record := range x.Records {
+		contents[record.Content] = true
+	}
+	for _, record := range y.Records {
+		if !contents[record.Content] {
+			return false
+		}
+	}
+	return true
+}
+
+// powerDNSReplace returns the change replacing the rrset
+func powerDNSReplace(rrset *powerDNSRRSet) *powerDNSRRSet {
+	return &powerDNSRRSet{
+		Name:       rrset.Name,
+		Type:       rrset.Type,
+		TTL:        rrset.TTL,
+		ChangeType: powerDNSChangeTypeReplace,
+		Records:    rrset.Records,
+	}
+}
+
+// powerDNSRemove returns the change deleting the rrset
+func powerDNSRemove(rrset *powerDNSRRSet) *powerDNSRRSet {
+	return &powerDNSRRSet{
+		Name:       rrset.Name,
+		Type:       rrset.Type,
+		ChangeType: powerDNSChangeTypeDelete,
+		Records:    []*powerDNSRecord{},
+	}
+}
@@ -0,0 +1,361 @@
+package consumers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const testPowerDNSAPIKey = "secret"
+
+// fakePowerDNS is a stand-in for the zone endpoints of the PowerDNS
+// Authoritative HTTP API.
+type fakePowerDNS struct {
+	zones   map[string]*powerDNSZone
+	patches map[string]int
+	sync.Mutex
+}
+
+func newFakePowerDNS(zones ...*powerDNSZone) (*fakePowerDNS, *httptest.Server) {
+	api := &fakePowerDNS{
+		zones:   make(map[string]*powerDNSZone),
+		patches: make(map[string]int),
+	}
+	for _, zone := range zones {
+		api.zones[zone.ID] = zone
+	}
+	return api, httptest.NewServer(api)
+}
+
+func (f *fakePowerDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("X-API-Key") != testPowerDNSAPIKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	const prefix = "/api/v1/servers/localhost/zones"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if id == "" && r.Method == "GET" {
+		zones := make([]*powerDNSZone, 0, len(f.zones))
+		for _, zone := range f.zones {
+			zones = append(zones, &powerDNSZone{ID: zone.ID, Name: zone.Name})
+		}
+		json.NewEncoder(w).Encode(zones)
+		return
+	}
+
+	zone, exists := f.zones[id]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Could not find domain"})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(zone)
+	case "PATCH":
+		var patch powerDNSPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := f.apply(zone, patch.RRSets); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		f.patches[id]++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakePowerDNS) apply(zone *powerDNSZone, changes []*powerDNSRRSet) error {
+	current := zone.RRSets
+
+	for _, change := range changes {
+		if !strings.HasSuffix(change.Name, zone.Name) {
+			return fmt.Errorf("name %s is out of zone", change.Name)
+		}
+
+		rrsets := make([]*powerDNSRRSet, 0, len(current))
+		for _, rrset := range current {
+			if rrset.Name != change.Name || rrset.Type != change.Type {
+				rrsets = append(rrsets, rrset)
+			}
+		}
+
+		switch change.ChangeType {
+		case powerDNSChangeTypeReplace:
+			rrsets = append(rrsets, &powerDNSRRSet{Name: change.Name, Type: change.Type, TTL: change.TTL, Records: change.Records})
+		case powerDNSChangeTypeDelete:
+		default:
+			return fmt.Errorf("unknown changetype %s", change.ChangeType)
+		}
+
+		current = rrsets
+	}
+
+	// a CNAME can't have siblings
+	types := make(map[string]map[string]bool)
+	for _, rrset := range current {
+		if types[rrset.Name] == nil {
+			types[rrset.Name] = make(map[string]bool)
+		}
+		types[rrset.Name][rrset.Type] = true
+	}
+	for name, t := range types {
+		if t["CNAME"] && len(t) > 1 {
+			return fmt.Errorf("RRset %s IN CNAME: Conflicts with pre-existing RRset", name)
+		}
+	}
+
+	zone.RRSets = current
+	return nil
+}
+
+// dump returns the rrsets of the zone as "name type ttl content,content"
+func (f *fakePowerDNS) dump(id string) []string {
+	f.Lock()
+	defer f.Unlock()
+
+	result := make([]string, 0)
+	for _, rrset := range f.zones[id].RRSets {
+		contents := make([]string, 0, len(rrset.Records))
+		for _, record := range rrset.Records {
+			contents = append(contents, record.Content)
+		}
+		sort.Strings(contents)
+		result = append(result, fmt.Sprintf("%s %s %d %s", rrset.Name, rrset.Type, rrset.TTL, strings.Join(contents, ",")))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func testRRSet(name, rrtype string, contents ...string) *powerDNSRRSet {
+	records := make([]*powerDNSRecord, 0, len(contents))
+	for _, content := range contents {
+		records = append(records, &powerDNSRecord{Content: content})
+	}
+	return &powerDNSRRSet{Name: name, Type: rrtype, TTL: 300, Records: records}
+}
+
+func newTestPowerDNSConsumer(t *testing.T, serverURL string) Consumer {
+	consumer, err := NewPowerDNSConsumer(&PowerDNSOptions{
+		ServerURL: serverURL,
+		APIKey:    testPowerDNSAPIKey,
+		GroupID:   "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestPowerDNSSync(t *testing.T) {
+	api, server := newFakePowerDNS(
+		&powerDNSZone{ID: "example.org.", Name: "example.org.", RRSets: []*powerDNSRRSet{
+			testRRSet("example.org.", "SOA", "ns.example.org. admin.example.org. 1 3600 600 86400 300"),
+			testRRSet("same.example.org.", "A", "10.0.0.1"),
+			testRRSet("_mate.same.example.org.", "TXT", `"mate:test"`),
+			testRRSet("changed.example.org.", "A", "10.0.0.2"),
+			testRRSet("_mate.changed.example.org.", "TXT", `"mate:test"`),
+			testRRSet("gone.example.org.", "A", "10.0.0.3"),
+			testRRSet("_mate.gone.example.org.", "TXT", `"mate:test"`),
+			testRRSet("foreign.example.org.", "A", "10.0.0.4"),
+			testRRSet("_mate.foreign.example.org.", "TXT", `"mate:other"`),
+			testRRSet("manual.example.org.", "A", "10.0.0.5"),
+		}},
+		&powerDNSZone{ID: "sub.example.org.", Name: "sub.example.org.", RRSets: []*powerDNSRRSet{
+			testRRSet("sub.example.org.", "SOA", "ns.example.org. admin.example.org. 1 3600 600 86400 300"),
+		}},
+		&powerDNSZone{ID: "example.net.", Name: "example.net."},
+	)
+	defer server.Close()
+
+	consumer := newTestPowerDNSConsumer(t, server.URL)
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "changed.example.org", IP: "10.0.1.2"},
+		{DNSName: "changed.example.org", Hostname: "lb.example.com"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.4"},
+		{DNSName: "manual.example.org", IP: "10.0.1.5"},
+		{DNSName: "new.example.org", IP: "10.0.1.6", TTL: 60},
+		{DNSName: "new.example.org", IP: "10.0.1.7", TTL: 60},
+		{DNSName: "foo.sub.example.org", Hostname: "lb.example.com"},
+		{DNSName: "other.example.com", IP: "10.0.1.8"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`_mate.changed.example.org. TXT 300 "mate:test"`,
+		`_mate.foreign.example.org. TXT 300 "mate:other"`,
+		`_mate.new.example.org. TXT 60 "mate:test"`,
+		`_mate.same.example.org. TXT 300 "mate:test"`,
+		`changed.example.org. A 300 10.0.1.2`,
+		`example.org. SOA 300 ns.example.org. admin.example.org. 1 3600 600 86400 300`,
+		`foreign.example.org. A 300 10.0.0.4`,
+		`manual.example.org. A 300 10.0.0.5`,
+		`new.example.org. A 60 10.0.1.6,10.0.1.7`,
+		`same.example.org. A 300 10.0.0.1`,
+	}
+	if records := api.dump("example.org."); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+
+	expected = []string{
+		`_mate.foo.sub.example.org. TXT 300 "mate:test"`,
+		`foo.sub.example.org. CNAME 300 lb.example.com.`,
+		`sub.example.org. SOA 300 ns.example.org. admin.example.org. 1 3600 600 86400 300`,
+	}
+	if records := api.dump("sub.example.org."); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+
+	expectedPatches := map[string]int{"example.org.": 1, "sub.example.org.": 1}
+	if !reflect.DeepEqual(api.patches, expectedPatches) {
+		t.Errorf("expected one patch per changed zone, got %v", api.patches)
+	}
+
+	// a second sync doesn't change anything
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(api.patches, expectedPatches) {
+		t.Errorf("expected no patch for unchanged zones, got %v", api.patches)
+	}
+}
+
+func TestPowerDNSProcess(t *testing.T) {
+	api, server := newFakePowerDNS(
+		&powerDNSZone{ID: "example.org.", Name: "example.org.", RRSets: []*powerDNSRRSet{
+			testRRSet("owned.example.org.", "A", "10.0.0.1"),
+			testRRSet("_mate.owned.example.org.", "TXT", `"mate:test"`),
+			testRRSet("cname.example.org.", "A", "10.0.0.2"),
+			testRRSet("_mate.cname.example.org.", "TXT", `"mate:test"`),
+			testRRSet("foreign.example.org.", "A", "10.0.0.3"),
+			testRRSet("_mate.foreign.example.org.", "TXT", `"mate:other"`),
+		}},
+	)
+	defer server.Close()
+
+	consumer := newTestPowerDNSConsumer(t, server.URL)
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.com"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.3"},
+		{DNSName: "new.example.org", IP: "10.0.1.4"},
+		{DNSName: "other.example.com", IP: "10.0.1.5"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := []string{
+		`_mate.cname.example.org. TXT 300 "mate:test"`,
+		`_mate.foreign.example.org. TXT 300 "mate:other"`,
+		`_mate.new.example.org. TXT 300 "mate:test"`,
+		`_mate.owned.example.org. TXT 300 "mate:test"`,
+		`cname.example.org. CNAME 300 lb.example.com.`,
+		`foreign.example.org. A 300 10.0.0.3`,
+		`new.example.org. A 300 10.0.1.4`,
+		`owned.example.org. A 300 10.0.0.1,10.0.1.1`,
+	}
+	if records := api.dump("example.org."); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestPowerDNSErrors(t *testing.T) {
+	_, server := newFakePowerDNS(&powerDNSZone{ID: "example.org.", Name: "example.org."})
+	defer server.Close()
+
+	consumer, err := NewPowerDNSConsumer(&PowerDNSOptions{
+		ServerURL: server.URL,
+		APIKey:    "wrong",
+		GroupID:   "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}})
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+
+	err = consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"})
+	if err == nil {
+		t.Error("expected process to fail")
+	}
+}
+
+func TestNewPowerDNSConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options PowerDNSOptions
+		valid   bool
+	}{
+		{"valid", PowerDNSOptions{ServerURL: "http://localhost:8081", APIKey: "key", GroupID: "test"}, true},
+		{"missing server", PowerDNSOptions{APIKey: "key", GroupID: "test"}, false},
+		{"missing api key", PowerDNSOptions{ServerURL: "http://localhost:8081", GroupID: "test"}, false},
+		{"missing group id", PowerDNSOptions{ServerURL: "http://localhost:8081", APIKey: "key"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewPowerDNSConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPowerDNSZoneFor(t *testing.T) {
+	zones := []*powerDNSZone{
+		{ID: "example.org.", Name: "example.org."},
+		{ID: "sub.example.org.", Name: "sub.example.org."},
+	}
+
+	for name, zone := range map[string]string{
+		"foo.example.org":     "example.org.",
+		"foo.sub.example.org": "sub.example.org.",
+		"sub.example.org":     "sub.example.org.",
+		"fooexample.org":      "",
+		"foo.example.com":     "",
+	} {
+		match := powerDNSZoneFor(zones, name)
+		if zone == "" && match != nil || zone != "" && (match == nil || match.ID != zone) {
+			t.Errorf("zone for %s: expected %q, got %v", name, zone, match)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package consumers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	rfc2136Timeout   = 10 * time.Second
+	rfc2136TSIGFudge = 300
+)
+
+var rfc2136TSIGAlgorithms = map[string]string{
+	"hmac-md5":    dns.HmacMD5,
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+type rfc2136Consumer struct {
+	server        string
+	zones         []string
+	groupID       string
+	tsigKeyName   string
+	tsigSecret    string
+	tsigAlgorithm string
+}
+
+// RFC2136Options configures the consumer for DNS servers supporting dynamic
+// updates, e.g. BIND or Knot.
+type RFC2136Options struct {
+	// Server is the host:port of the primary server of the zones
+	Server string
+	// Zones are the zones to manage, each must allow zone transfers
+	Zones   []string
+	GroupID string
+	// TSIGKeyName and TSIGSecret (base64) sign the updates and transfers,
+	// both are optional
+	TSIGKeyName   string
+	TSIGSecret    string
+	TSIGAlgorithm string
+}
+
+// rfc2136Name holds the records of a single name in a zone
+type rfc2136Name struct {
+	owner   string
+	records []dns.RR
+}
+
+// NewRFC2136Consumer creates a consumer which reads the current records via
+// AXFR and changes them with DNS UPDATE messages (RFC 2136). Ownership of
+// records is tracked by a TXT record, see ownerName.
+func NewRFC2136Consumer(cfg *RFC2136Options) (Consumer, error) {
+	if cfg.Server == "" {
+		return nil, errors.New("please provide --rfc2136-server")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+		return nil, fmt.Errorf("invalid --rfc2136-server %s: %v", cfg.Server, err)
+	}
+	if len(cfg.Zones) == 0 {
+		return nil, errors.New("please provide --rfc2136-zone")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --rfc2136-record-group-id")
+	}
+	if (cfg.TSIGKeyName == "") != (cfg.TSIGSecret == "") {
+		return nil, errors.New("please provide both --rfc2136-tsig-keyname and --rfc2136-tsig-secret")
+	}
+
+	algorithm := ""
+	if cfg.TSIGKeyName != "" {
+		if cfg.TSIGAlgorithm == "" {
+			cfg.TSIGAlgorithm = "hmac-sha256"
+		}
+		var ok bool
+		algorithm, ok = rfc2136TSIGAlgorithms[cfg.TSIGAlgorithm]
+		if !ok {
+			return nil, fmt.Errorf("unknown TSIG algorithm %s", cfg.TSIGAlgorithm)
+		}
+	}
+
+	zones := make([]string, 0, len(cfg.Zones))
+	for _, zone := range cfg.Zones {
+		zones = append(zones, canonicalName(zone))
+	}
+
+	return &rfc2136Consumer{
+		server:        cfg.Server,
+		zones:         zones,
+		groupID:       cfg.GroupID,
+		tsigKeyName:   dns.Fqdn(cfg.TSIGKeyName),
+		tsigSecret:    cfg.TSIGSecret,
+		tsigAlgorithm: algorithm,
+	}, nil
+}
+
+func (d *rfc2136Consumer) Sync(endpoints []*pkg.Endpoint) error {
+	desired := make(map[string]map[string][]dns.RR)
+	for _, zone := range d.zones {
+		desired[zone] = make(map[string][]dns.RR)
+	}
+
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[RFC2136] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		name := canonicalName(ep.DNSName)
+
+		zone := d.zoneFor(name)
+		if zone == "" {
+			log.Warnf("[RFC2136] Zone for endpoint %s was not found. Skipping record...", name)
+			continue
+		}
+
+		record, err := endpointToRR(ep)
+		if err != nil {
+			log.Warnf("[RFC2136] Skipping record %s: %v", name, err)
+			continue
+		}
+
+		if !canAddRR(desired[zone][name], record) {
+			log.Warnf("[RFC2136] Skipping record %s: a CNAME can't be combined with other records", name)
+			continue
+		}
+		desired[zone][name] = append(desired[zone][name], record)
+	}
+
+	errs := make([]error, 0)
+	for _, zone := range d.zones {
+		if err := d.syncZone(zone, desired[zone]); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %v", zone, err))
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *rfc2136Consumer) syncZone(zone string, desired map[string][]dns.RR) error {
+	current, err := d.currentRecords(zone)
+	if err != nil {
+		return err
+	}
+
+	m := d.newUpdate(zone)
+
+	for _, name := range sortedRRNames(desired) {
+		records := desired[name]
+
+		existing, exists := current[name]
+		switch {
+		case !exists:
+			m.Insert(append(records, d.ownerRecord(name, records[0].Header().Ttl)))
+		case existing.owner != d.owner():
+			log.Warnf("[RFC2136] Skipping record %s: with a group ID: %q", name, existing.owner)
+		case !sameRRs(existing.records, records):
+			m.RemoveRRset(rfc2136Placeholders(name))
+			m.Insert(records)
+		}
+	}
+
+	for name, existing := range current {
+		if existing.owner == d.owner() && desired[name] == nil {
+			m.RemoveRRset(rfc2136Placeholders(name))
+			m.Remove([]dns.RR{d.ownerRecord(name, 0)})
+		}
+	}
+
+	if len(m.Ns) == 0 {
+		log.Infoln("[RFC2136] No changes submitted for zone: ", zone)
+		return nil
+	}
+
+	log.Debugln("[RFC2136] Update for zone:", zone, m.Ns)
+
+	rcode, err := d.exchange(m)
+	if err != nil {
+		return err
+	}
+	if rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update rejected: %s", dns.RcodeToString[rcode])
+	}
+
+	return nil
+}
+
+func (d *rfc2136Consumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[RFC2136] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[RFC2136] channel closed")
+				return
+			}
+
+			log.Infof("[RFC2136] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[RFC2136] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint if the name is either owned or
+// not in use at all. Both conditions are sent as prerequisites of the
+// update so that the server checks them atomically.
+func (d *rfc2136Consumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[RFC2136] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	name := canonicalName(endpoint.DNSName)
+
+	zone := d.zoneFor(name)
+	if zone == "" {
+		log.Warnf("[RFC2136] Zone for endpoint %s was not found. Skipping record...", name)
+		return nil
+	}
+
+	record, err := endpointToRR(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", name, err)
+	}
+
+	// the name is owned: add the record, a CNAME replaces everything else
+	m := d.newUpdate(zone)
+	m.Used([]dns.RR{d.ownerRecord(name, 0)})
+	if record.Header().Rrtype == dns.TypeCNAME {
+		m.RemoveRRset(rfc2136Placeholders(name))
+	} else {
+		m.RemoveRRset([]dns.RR{rfc2136Placeholder(name, dns.TypeCNAME)})
+	}
+	m.Insert([]dns.RR{record})
+
+	rcode, err := d.exchange(m)
+	if err != nil {
+		return err
+	}
+	if rcode == dns.RcodeSuccess {
+		return nil
+	}
+	if rcode != dns.RcodeNXRrset {
+		return fmt.Errorf("update of %s rejected: %s", name, dns.RcodeToString[rcode])
+	}
+
+	// the name isn't owned: create it if neither it nor its owner record is in use
+	m = d.newUpdate(zone)
+	m.NameNotUsed([]dns.RR{rfc2136Placeholder(name, dns.TypeANY)})
+	m.RRsetNotUsed([]dns.RR{rfc2136Placeholder(ownerName(name), dns.TypeTXT)})
+	m.Insert([]dns.RR{record, d.ownerRecord(name, record.Header().Ttl)})
+
+	rcode, err = d.exchange(m)
+	if err != nil {
+		return err
+	}
+	if rcode == dns.RcodeYXDomain || rcode == dns.RcodeYXRrset {
+		log.Warnf("[RFC2136] Record [name=%s] could not be created, another record with same name already exists", name)
+		return nil
+	}
+	if rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update of %s rejected: %s", name, dns.RcodeToString[rcode])
+	}
+
+	return nil
+}
+
+// currentRecords transfers the zone and returns its names with their owner
+// and their A and CNAME records. Owner records are assigned to the name they
+// belong to.
+func (d *rfc2136Consumer) currentRecords(zone string) (map[string]*rfc2136Name, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+	d.sign(m)
+
+	t := &dns.Transfer{
+		DialTimeout:  rfc2136Timeout,
+		ReadTimeout:  rfc2136Timeout,
+		WriteTimeout: rfc2136Timeout,
+		TsigSecret:   d.secrets(),
+	}
+
+	envelopes, err := t.In(m, d.server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer zone: %v", err)
+	}
+
+	names := make(map[string]*rfc2136Name)
+
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("failed to transfer zone: %v", envelope.Error)
+		}
+
+		for _, rr := range envelope.RR {
+			name := canonicalName(rr.Header().Name)
+
+			if r, ok := rr.(*dns.TXT); ok && isOwnerName(name) {
+				if len(r.Txt) == 1 && strings.HasPrefix(r.Txt[0], ownerPrefix) {
+					rfc2136Entry(names, ownedName(name)).owner = r.Txt[0]
+				}
+				continue
+			}
+
+			current := rfc2136Entry(names, name)
+
+			switch rr.(type) {
+			case *dns.A, *dns.CNAME:
+				current.records = append(current.records, rr)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func rfc2136Entry(names map[string]*rfc2136Name, name string) *rfc2136Name {
+	current, exists := names[name]
+	if !exists {
+		current = &rfc2136Name{}
+		names[name] = current
+	}
+	return current
+}
+
+// exchange sends the update to the server and returns its response code
+func (d *rfc2136Consumer) exchange(m *dns.Msg) (int, error) {
+	d.sign(m)
+
+	c := &dns.Client{
+		Net:          "tcp",
+		DialTimeout:  rfc2136Timeout,
+		ReadTimeout:  rfc2136Timeout,
+		WriteTimeout: rfc2136Timeout,
+		TsigSecret:   d.secrets(),
+	}
+
+	r, _, err := c.Exchange(m, d.server)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send update to %s: %v", d.server, err)
+	}
+
+	return r.Rcode, nil
+}
+
+func (d *rfc2136Consumer) newUpdate(zone string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	return m
+}
+
+func (d *rfc2136Consumer) sign(m *dns.Msg) {
+	if d.tsigSecret != "" {
+		m.SetTsig(d.tsigKeyName, d.tsigAlgorithm, rfc2136TSIGFudge, time.Now().Unix())
+	}
+}
+
+func (d *rfc2136Consumer) secrets() map[string]string {
+	if d.tsigSecret == "" {
+		return nil
+	}
+	return map[string]string{d.tsigKeyName: d.tsigSecret}
+}
+
+// zoneFor returns the longest configured zone containing the name
+func (d *rfc2136Consumer) zoneFor(name string) string {
+	var match string
+	for _, zone := range d.zones {
+		if dns.IsSubDomain(zone, name) && len(zone) > len(match) {
+			match = zone
+		}
+	}
+	return match
+}
+
+// owner returns the identifier for records as stored in TXT records
+func (d *rfc2136Consumer) owner() string {
+	return ownerPrefix + d.groupID
+}
+
+// ownerRecord returns the TXT record which accompanies the records of a name
+func (d *rfc2136Consumer) ownerRecord(name string, ttl uint32) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: ownerName(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+		Txt: []string{d.owner()},
+	}
+}
+
+// placeholders returns the RRsets managed for a name, used to remove them
+func rfc2136Placeholders(name string) []dns.RR {
+	return []dns.RR{rfc2136Placeholder(name, dns.TypeA), rfc2136Placeholder(name, dns.TypeCNAME)}
+}
+
+func rfc2136Placeholder(name string, rrtype uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET}}
+}
@@ -0,0 +1,423 @@
+package consumers
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	testTSIGKey    = "mate."
+	testTSIGSecret = "bWF0ZS10ZXN0LXNlY3JldA=="
+)
+
+// fakeDNSServer is an authoritative server for a single zone which supports
+// TSIG signed zone transfers and dynamic updates.
+type fakeDNSServer struct {
+	zone    string
+	soa     dns.RR
+	records []dns.RR
+	server  *dns.Server
+	sync.Mutex
+}
+
+func startFakeDNSServer(t *testing.T, zone string, records ...string) *fakeDNSServer {
+	soa, _ := dns.NewRR(zone + " 3600 IN SOA ns." + zone + " admin." + zone + " 1 3600 600 86400 300")
+
+	s := &fakeDNSServer{zone: zone, soa: soa}
+	for _, r := range records {
+		s.records = append(s.records, mustRR(t, r))
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	s.server = &dns.Server{
+		Listener:          listener,
+		Handler:           s,
+		TsigSecret:        map[string]string{testTSIGKey: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go s.server.ActivateAndServe()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake DNS server didn't start")
+	}
+
+	return s
+}
+
+func (s *fakeDNSServer) addr() string {
+	return s.server.Listener.Addr().String()
+}
+
+func (s *fakeDNSServer) stop() {
+	s.server.Shutdown()
+}
+
+func (s *fakeDNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.Lock()
+	defer s.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.Rcode = dns.RcodeNotAuth
+		w.WriteMsg(m)
+		return
+	}
+
+	switch {
+	case r.Opcode == dns.OpcodeUpdate:
+		m.Rcode = s.update(r)
+	case len(r.Question) == 1 && r.Question[0].Qtype == dns.TypeAXFR:
+		m.Answer = append([]dns.RR{s.soa}, s.records...)
+		m.Answer = append(m.Answer, s.soa)
+	default:
+		m.Rcode = dns.RcodeNotImplemented
+	}
+
+	m.SetTsig(testTSIGKey, dns.HmacSHA256, 300, time.Now().Unix())
+	w.WriteMsg(m)
+}
+
+// update checks the prerequisites and applies the updates, see RFC 2136
+// section 3.2 and 3.4.
+func (s *fakeDNSServer) update(r *dns.Msg) int {
+	for _, rr := range r.Answer {
+		hdr := rr.Header()
+		switch {
+		case hdr.Class == dns.ClassANY && hdr.Rrtype == dns.TypeANY:
+			if !s.nameUsed(hdr.Name) {
+				return dns.RcodeNameError
+			}
+		case hdr.Class == dns.ClassANY:
+			if !s.rrsetUsed(hdr.Name, hdr.Rrtype) {
+				return dns.RcodeNXRrset
+			}
+		case hdr.Class == dns.ClassNONE && hdr.Rrtype == dns.TypeANY:
+			if s.nameUsed(hdr.Name) {
+				return dns.RcodeYXDomain
+			}
+		case hdr.Class == dns.ClassNONE:
+			if s.rrsetUsed(hdr.Name, hdr.Rrtype) {
+				return dns.RcodeYXRrset
+			}
+		default:
+			if s.index(rr) < 0 {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+
+	for _, rr := range r.Ns {
+		hdr := rr.Header()
+		switch hdr.Class {
+		case dns.ClassANY:
+			s.remove(func(x dns.RR) bool {
+				return strings.EqualFold(x.Header().Name, hdr.Name) &&
+					(hdr.Rrtype == dns.TypeANY || x.Header().Rrtype == hdr.Rrtype)
+			})
+		case dns.ClassNONE:
+			key := rrKey(rr)
+			s.remove(func(x dns.RR) bool { return rrKey(x) == key })
+		default:
+			// a CNAME can't have siblings, conflicting additions are
+			// silently ignored (RFC 2136 section 3.4.2.2)
+			if s.conflicts(rr) {
+				continue
+			}
+			if s.index(rr) < 0 {
+				s.records = append(s.records, dns.Copy(rr))
+			}
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+func (s *fakeDNSServer) nameUsed(name string) bool {
+	for _, x := range s.records {
+		if strings.EqualFold(x.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeDNSServer) rrsetUsed(name string, rrtype uint16) bool {
+	for _, x := range s.records {
+		if strings.EqualFold(x.Header().Name, name) && x.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeDNSServer) conflicts(rr dns.RR) bool {
+	for _, x := range s.records {
+		if strings.EqualFold(x.Header().Name, rr.Header().Name) &&
+			(x.Header().Rrtype == dns.TypeCNAME) != (rr.Header().Rrtype == dns.TypeCNAME) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeDNSServer) index(rr dns.RR) int {
+	key := rrKey(rr)
+	for i, x := range s.records {
+		if rrKey(x) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *fakeDNSServer) remove(matches func(dns.RR) bool) {
+	records := make([]dns.RR, 0, len(s.records))
+	for _, x := range s.records {
+		if !matches(x) {
+			records = append(records, x)
+		}
+	}
+	s.records = records
+}
+
+// dump returns the records of the zone in presentation format
+func (s *fakeDNSServer) dump() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	result := make([]string, 0, len(s.records))
+	for _, r := range s.records {
+		result = append(result, r.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// rrKey identifies a record by its name, type and data
+func rrKey(rr dns.RR) string {
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	c.Header().Class = dns.ClassINET
+	return strings.ToLower(c.String())
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", s, err)
+	}
+	return rr
+}
+
+func normalizedRecords(t *testing.T, records ...string) []string {
+	result := make([]string, 0, len(records))
+	for _, r := range records {
+		result = append(result, mustRR(t, r).String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newTestRFC2136Consumer(t *testing.T, server, secret string) Consumer {
+	consumer, err := NewRFC2136Consumer(&RFC2136Options{
+		Server:      server,
+		Zones:       []string{"example.org"},
+		GroupID:     "test",
+		TSIGKeyName: "mate",
+		TSIGSecret:  secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestRFC2136Sync(t *testing.T) {
+	server := startFakeDNSServer(t, "example.org.",
+		// owned and up to date
+		`same.example.org. 300 IN A 10.0.0.1`,
+		`_mate.same.example.org. 300 IN TXT "mate:test"`,
+		// owned, but pointing to an outdated target
+		`changed.example.org. 300 IN A 10.0.0.2`,
+		`_mate.changed.example.org. 300 IN TXT "mate:test"`,
+		// owned, but no longer desired
+		`gone.example.org. 300 IN A 10.0.0.3`,
+		`_mate.gone.example.org. 300 IN TXT "mate:test"`,
+		// owned by another group
+		`foreign.example.org. 300 IN A 10.0.0.4`,
+		`_mate.foreign.example.org. 300 IN TXT "mate:other"`,
+		// created by hand
+		`manual.example.org. 300 IN A 10.0.0.5`,
+	)
+	defer server.stop()
+
+	consumer := newTestRFC2136Consumer(t, server.addr(), testTSIGSecret)
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "same.example.org", IP: "10.0.0.1"},
+		{DNSName: "changed.example.org", IP: "10.0.1.2"},
+		{DNSName: "changed.example.org", IP: "10.0.1.3"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.4"},
+		{DNSName: "manual.example.org", IP: "10.0.1.5"},
+		{DNSName: "new.example.org", IP: "10.0.1.6", TTL: 60},
+		{DNSName: "alias.example.org", Hostname: "lb.example.com"},
+		{DNSName: "other.example.com", IP: "10.0.1.7"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := normalizedRecords(t,
+		`same.example.org. 300 IN A 10.0.0.1`,
+		`_mate.same.example.org. 300 IN TXT "mate:test"`,
+		`changed.example.org. 300 IN A 10.0.1.2`,
+		`changed.example.org. 300 IN A 10.0.1.3`,
+		`_mate.changed.example.org. 300 IN TXT "mate:test"`,
+		`foreign.example.org. 300 IN A 10.0.0.4`,
+		`_mate.foreign.example.org. 300 IN TXT "mate:other"`,
+		`manual.example.org. 300 IN A 10.0.0.5`,
+		`new.example.org. 60 IN A 10.0.1.6`,
+		`_mate.new.example.org. 60 IN TXT "mate:test"`,
+		`alias.example.org. 300 IN CNAME lb.example.com.`,
+		`_mate.alias.example.org. 300 IN TXT "mate:test"`,
+	)
+
+	if records := server.dump(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestRFC2136Process(t *testing.T) {
+	server := startFakeDNSServer(t, "example.org.",
+		`owned.example.org. 300 IN A 10.0.0.1`,
+		`_mate.owned.example.org. 300 IN TXT "mate:test"`,
+		`cname.example.org. 300 IN A 10.0.0.2`,
+		`_mate.cname.example.org. 300 IN TXT "mate:test"`,
+		`foreign.example.org. 300 IN A 10.0.0.3`,
+		`_mate.foreign.example.org. 300 IN TXT "mate:other"`,
+		// owner record left behind by another group
+		`_mate.stale.example.org. 300 IN TXT "mate:other"`,
+	)
+	defer server.stop()
+
+	consumer := newTestRFC2136Consumer(t, server.addr(), testTSIGSecret)
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.com"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.3"},
+		{DNSName: "new.example.org", IP: "10.0.1.4"},
+		{DNSName: "stale.example.org", IP: "10.0.1.6"},
+		{DNSName: "other.example.com", IP: "10.0.1.5"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := normalizedRecords(t,
+		`owned.example.org. 300 IN A 10.0.0.1`,
+		`owned.example.org. 300 IN A 10.0.1.1`,
+		`_mate.owned.example.org. 300 IN TXT "mate:test"`,
+		`cname.example.org. 300 IN CNAME lb.example.com.`,
+		`_mate.cname.example.org. 300 IN TXT "mate:test"`,
+		`foreign.example.org. 300 IN A 10.0.0.3`,
+		`_mate.foreign.example.org. 300 IN TXT "mate:other"`,
+		`new.example.org. 300 IN A 10.0.1.4`,
+		`_mate.new.example.org. 300 IN TXT "mate:test"`,
+		`_mate.stale.example.org. 300 IN TXT "mate:other"`,
+	)
+
+	if records := server.dump(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestRFC2136InvalidTSIG(t *testing.T) {
+	server := startFakeDNSServer(t, "example.org.",
+		`owned.example.org. 300 IN A 10.0.0.1`,
+		`_mate.owned.example.org. 300 IN TXT "mate:test"`,
+	)
+	defer server.stop()
+
+	consumer := newTestRFC2136Consumer(t, server.addr(), "d3Jvbmctc2VjcmV0")
+
+	if err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}}); err == nil {
+		t.Error("expected sync to fail with an invalid TSIG secret")
+	}
+
+	if err := consumer.Process(&pkg.Endpoint{DNSName: "new.example.org", IP: "10.0.1.1"}); err == nil {
+		t.Error("expected process to fail with an invalid TSIG secret")
+	}
+
+	expected := normalizedRecords(t,
+		`owned.example.org. 300 IN A 10.0.0.1`,
+		`_mate.owned.example.org. 300 IN TXT "mate:test"`,
+	)
+
+	if records := server.dump(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records\n got: %v\nwant: %v", records, expected)
+	}
+}
+
+func TestNewRFC2136Consumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options RFC2136Options
+		valid   bool
+	}{
+		{"valid", RFC2136Options{Server: "127.0.0.1:53", Zones: []string{"example.org"}, GroupID: "test"}, true},
+		{"valid with tsig", RFC2136Options{Server: "127.0.0.1:53", Zones: []string{"example.org"}, GroupID: "test", TSIGKeyName: "mate", TSIGSecret: testTSIGSecret, TSIGAlgorithm: "hmac-sha512"}, true},
+		{"missing server", RFC2136Options{Zones: []string{"example.org"}, GroupID: "test"}, false},
+		{"missing port", RFC2136Options{Server: "127.0.0.1", Zones: []string{"example.org"}, GroupID: "test"}, false},
+		{"missing zone", RFC2136Options{Server: "127.0.0.1:53", GroupID: "test"}, false},
+		{"missing group id", RFC2136Options{Server: "127.0.0.1:53", Zones: []string{"example.org"}}, false},
+		{"missing tsig secret", RFC2136Options{Server: "127.0.0.1:53", Zones: []string{"example.org"}, GroupID: "test", TSIGKeyName: "mate"}, false},
+		{"unknown tsig algorithm", RFC2136Options{Server: "127.0.0.1:53", Zones: []string{"example.org"}, GroupID: "test", TSIGKeyName: "mate", TSIGSecret: testTSIGSecret, TSIGAlgorithm: "hmac-foo"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewRFC2136Consumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRFC2136ZoneFor(t *testing.T) {
+	consumer := &rfc2136Consumer{zones: []string{"example.org.", "sub.example.org."}}
+
+	for name, zone := range map[string]string{
+		"foo.example.org.":     "example.org.",
+		"foo.sub.example.org.": "sub.example.org.",
+		"fooexample.org.":      "",
+		"foo.example.com.":     "",
+	} {
+		if got := consumer.zoneFor(name); got != zone {
+			t.Errorf("zone for %s: expected %q, got %q", name, zone, got)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package consumers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultServerAddress = ":53"
+	// serverMaxCNAMEs limits the CNAME chain followed within the zones
+	serverMaxCNAMEs = 8
+)
+
+type serverConsumer struct {
+	zones       []string
+	nameServers []string
+	groupID     string
+	udp         *dns.Server
+	tcp         *dns.Server
+	shutdown    sync.Once
+
+	// records holds the A, AAAA and CNAME records by name, serial is
+	// increased whenever they change
+	records map[string][]dns.RR
+	serial  uint32
+	sync.RWMutex
+}
+
+// ServerOptions configures the built-in DNS server. Without name servers
+// the zones are served with ns.<zone> as their name server.
+type ServerOptions struct {
+	Address     string
+	Zones       []string
+	NameServers []string
+	GroupID     string
+}
+
+// NewServerConsumer creates a consumer which answers DNS queries for the
+// zones itself from the endpoints held in memory. It listens on the address
+// over UDP and TCP right away. Ownership is announced with TXT records like
+// the other consumers do, see ownerName.
+func NewServerConsumer(cfg *ServerOptions) (Consumer, error) {
+	if len(cfg.Zones) == 0 {
+		return nil, errors.New("please provide --server-zone")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --server-record-group-id")
+	}
+	if cfg.Address == "" {
+		cfg.Address = defaultServerAddress
+	}
+
+	d := &serverConsumer{
+		groupID: cfg.GroupID,
+		records: make(map[string][]dns.RR),
+		serial:  uint32(time.Now().Unix()),
+	}
+	for _, zone := range cfg.Zones {
+		d.zones = append(d.zones, canonicalName(zone))
+	}
+	for _, ns := range cfg.NameServers {
+		d.nameServers = append(d.nameServers, canonicalName(ns))
+	}
+
+	if err := d.listen(cfg.Address); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// listen binds the address over UDP and TCP, the TCP port follows the UDP
+// one if the port is chosen by the system, and starts serving
+func (d *serverConsumer) listen(address string) error {
+	packetConn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s/udp: %v", address, err)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		packetConn.Close()
+		return fmt.Errorf("invalid --server-address %s: %v", address, err)
+	}
+	if port == "0" {
+		_, port, _ = net.SplitHostPort(packetConn.LocalAddr().String())
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		packetConn.Close()
+		return fmt.Errorf("failed to listen on %s/tcp: %v", address, err)
+	}
+
+	started := &sync.WaitGroup{}
+	d.udp = &dns.Server{PacketConn: packetConn, Handler: d, NotifyStartedFunc: started.Done}
+	d.tcp = &dns.Server{Listener: listener, Handler: d, NotifyStartedFunc: started.Done}
+
+	for _, server := range []*dns.Server{d.udp, d.tcp} {
+		started.Add(1)
+		go func(server *dns.Server) {
+			if err := server.ActivateAndServe(); err != nil {
+				log.Debugf("[Server] Stopped serving: %v", err)
+			}
+		}(server)
+	}
+	started.Wait()
+
+	log.Infof("[Server] Serving %s on %s", strings.Join(d.zones, ", "), packetConn.LocalAddr())
+	return nil
+}
+
+// Sync replaces all records with the ones of the endpoints
+func (d *serverConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	records := make(map[string][]dns.RR)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[Server] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		if d.zoneFor(ep.DNSName) == "" {
+			log.Warnf("[Server] Zone for endpoint %s was not found. Skipping record...", ep.DNSName)
+			continue
+		}
+
+		record, err := endpointToServerRR(ep)
+		if err != nil {
+			log.Warnf("[Server] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		name := record.Header().Name
+		if !canAddRR(records[name], record) {
+			log.Warnf("[Server] Skipping record %s: a CNAME can't be combined with other records", ep.DNSName)
+			continue
+		}
+		if !containsRR(records[name], record) {
+			records[name] = append(records[name], record)
+		}
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if !sameServerRecords(d.records, records) {
+		d.records = records
+		d.serial++
+	}
+	return nil
+}
+
+func (d *serverConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Server] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Server] channel closed")
+				return
+			}
+
+			log.Infof("[Server] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			d.stop()
+			log.Info("[Server] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint, a CNAME replaces all other
+// records of the name and vice versa.
+func (d *serverConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[Server] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	if d.zoneFor(endpoint.DNSName) == "" {
+		log.Warnf("[Server] Zone for endpoint %s was not found. Skipping record...", endpoint.DNSName)
+		return nil
+	}
+
+	record, err := endpointToServerRR(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", endpoint.DNSName, err)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	name := record.Header().Name
+	if containsRR(d.records[name], record) {
+		return nil
+	}
+
+	records := []dns.RR{record}
+	if canAddRR(d.records[name], record) {
+		records = append(d.records[name], record)
+	}
+	d.records[name] = records
+	d.serial++
+	return nil
+}
+
+// ServeDNS answers a query for the zones
+func (d *serverConsumer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+
+	switch {
+	case r.Opcode != dns.OpcodeQuery:
+		m.SetRcode(r, dns.RcodeNotImplemented)
+	case len(r.Question) != 1:
+		m.SetRcode(r, dns.RcodeFormatError)
+	default:
+		q := r.Question[0]
+		zone := d.zoneFor(q.Name)
+		if zone == "" {
+			m.SetRcode(r, dns.RcodeRefused)
+			break
+		}
+
+		m.SetReply(r)
+		m.Authoritative = true
+
+		d.RLock()
+		d.answer(m, zone, strings.ToLower(q.Name), q.Qtype)
+		d.RUnlock()
+	}
+
+	// over UDP only the header is sent if the answer doesn't fit, the
+	// client retries over TCP
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		size := dns.MinMsgSize
+		if opt := r.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		if m.Len() > size {
+			m.Truncated = true
+			m.Answer, m.Ns, m.Extra = nil, nil, nil
+		}
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		log.Debugf("[Server] Failed to answer %s: %v", w.RemoteAddr(), err)
+	}
+}
+
+// answer fills in the records of the name, following CNAMEs within the zones
+func (d *serverConsumer) answer(m *dns.Msg, zone, name string, qtype uint16) {
+	for i := 0; i < serverMaxCNAMEs; i++ {
+		records := d.lookup(zone, name)
+		if len(records) == 0 {
+			if !d.isEmptyNonTerminal(name) {
+				m.Rcode = dns.RcodeNameError
+			}
+			m.Ns = append(m.Ns, d.soa(zone))
+			return
+		}
+
+		// records are copied as packing the answer modifies their headers
+		matched := false
+		var cname *dns.CNAME
+		for _, r := range records {
+			if r.Header().Rrtype == qtype || qtype == dns.TypeANY {
+				m.Answer = append(m.Answer, dns.Copy(r))
+				matched = true
+			}
+			if c, ok := r.(*dns.CNAME); ok {
+				cname = c
+			}
+		}
+
+		switch {
+		case matched:
+			if qtype == dns.TypeNS && name == zone {
+				m.Extra = append(m.Extra, d.glue(zone)...)
+			}
+			return
+		case cname != nil:
+			m.Answer = append(m.Answer, dns.Copy(cname))
+			name = cname.Target
+			if zone = d.zoneFor(name); zone == "" {
+				// the resolver follows targets outside of the zones
+				return
+			}
+		default:
+			m.Ns = append(m.Ns, d.soa(zone))
+			return
+		}
+	}
+}
+
+// lookup returns all records of the name including the SOA and NS records
+// of the zone apex and the ownership records
+func (d *serverConsumer) lookup(zone, name string) []dns.RR {
+	records := append([]dns.RR{}, d.records[name]...)
+
+	if name == zone {
+		records = append(records, d.soa(zone))
+		for _, ns := range d.zoneNameServers(zone) {
+			records = append(records, &dns.NS{
+				Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: uint32(defaultTTL)},
+				Ns:  ns,
+			})
+		}
+	}
+
+	if isOwnerName(name) && len(d.records[ownedName(name)]) > 0 {
+		records = append(records, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(defaultTTL)},
+			Txt: []string{ownerPrefix + d.groupID},
+		})
+	}
+
+	return records
+}
+
+// isEmptyNonTerminal returns whether the name has no records but names
+// below it do
+func (d *serverConsumer) isEmptyNonTerminal(name string) bool {
+	for _, zone := range d.zones {
+		if strings.HasSuffix(zone, "."+name) {
+			return true
+		}
+	}
+	for other := range d.records {
+		if strings.HasSuffix(other, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *serverConsumer) soa(zone string) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(defaultTTL)},
+		Ns:      d.zoneNameServers(zone)[0],
+		Mbox:    "hostmaster." + zone,
+		Serial:  d.serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  60,
+	}
+}
+
+// glue returns the addresses of the name servers of the zone
+func (d *serverConsumer) glue(zone string) []dns.RR {
+	glue := make([]dns.RR, 0)
+	for _, ns := range d.zoneNameServers(zone) {
+		for _, r := range d.records[ns] {
+			if r.Header().Rrtype == dns.TypeA || r.Header().Rrtype == dns.TypeAAAA {
+				glue = append(glue, dns.Copy(r))
+			}
+		}
+	}
+	return glue
+}
+
+func (d *serverConsumer) zoneNameServers(zone string) []string {
+	if len(d.nameServers) > 0 {
+		return d.nameServers
+	}
+	return []string{"ns." + zone}
+}
+
+// zoneFor returns the zone with the longest name matching the dns name
+func (d *serverConsumer) zoneFor(dnsName string) string {
+	name := canonicalName(dnsName)
+
+	match := ""
+	for _, zone := range d.zones {
+		if dns.IsSubDomain(zone, name) && len(zone) > len(match) {
+			match = zone
+		}
+	}
+	return match
+}
+
+// stop shuts the UDP and TCP servers down
+func (d *serverConsumer) stop() {
+	d.shutdown.Do(func() {
+		for _, server := range []*dns.Server{d.udp, d.tcp} {
+			if err := server.Shutdown(); err != nil {
+				log.Warnf("[Server] Failed to shut down: %v", err)
+			}
+		}
+	})
+}
+
+// endpointToServerRR converts the endpoint to an A or AAAA record for IPs and
+// a CNAME record for hostnames
+func endpointToServerRR(ep *pkg.Endpoint) (dns.RR, error) {
+	hdr := dns.RR_Header{
+		Name:  canonicalName(ep.DNSName),
+		Class: dns.ClassINET,
+		Ttl:   uint32(ttl(ep)),
+	}
+
+	switch {
+	case ep.IP != "":
+		ip := net.ParseIP(ep.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", ep.IP)
+		}
+		if ip.To4() != nil {
+			hdr.Rrtype = dns.TypeA
+			return &dns.A{Hdr: hdr, A: ip.To4()}, nil
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case ep.Hostname != "":
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: canonicalName(ep.Hostname)}, nil
+	}
+
+	return nil, errors.New("neither IP nor hostname given")
+}
+
+// containsRR returns whether the record is one of the records
+func containsRR(records []dns.RR, record dns.RR) bool {
+	for _, r := range records {
+		if sameRRs([]dns.RR{r}, []dns.RR{record}) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameServerRecords(x, y map[string][]dns.RR) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for name, records := range x {
+		if !sameRRs(records, y[name]) {
+			return false
+		}
+	}
+	return true
+}
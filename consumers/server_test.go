@@ -0,0 +1,300 @@
+package consumers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+func newTestServerConsumer(t *testing.T, nameServers ...string) *serverConsumer {
+	consumer, err := NewServerConsumer(&ServerOptions{
+		Address:     "127.0.0.1:0",
+		Zones:       []string{"example.org", "sub.example.org."},
+		NameServers: nameServers,
+		GroupID:     "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer.(*serverConsumer)
+}
+
+// query asks the server and returns the rcode and flags as well as the
+// records of all sections with the SOA serial set to 0
+func query(t *testing.T, d *serverConsumer, network, name string, qtype uint16) (string, []string) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+
+	address := d.udp.PacketConn.LocalAddr().String()
+	if network == "tcp" {
+		address = d.tcp.Listener.Addr().String()
+	}
+
+	client := &dns.Client{Net: network}
+	r, _, err := client.Exchange(m, address)
+	// truncated answers are returned along with the error
+	if err != nil && err != dns.ErrTruncated {
+		t.Fatalf("query %s %s over %s failed: %v", name, dns.TypeToString[qtype], network, err)
+	}
+
+	records := make([]string, 0)
+	for _, section := range [][]dns.RR{r.Answer, r.Ns, r.Extra} {
+		for _, rr := range section {
+			if soa, ok := rr.(*dns.SOA); ok {
+				soa.Serial = 0
+			}
+			records = append(records, strings.Replace(rr.String(), "\t", " ", -1))
+		}
+	}
+	sort.Strings(records)
+
+	rcode := dns.RcodeToString[r.Rcode]
+	if r.Truncated {
+		rcode += " truncated"
+	}
+	if r.Authoritative {
+		rcode += " aa"
+	}
+	return rcode, records
+}
+
+func TestServerQueries(t *testing.T) {
+	consumer := newTestServerConsumer(t)
+	defer consumer.stop()
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "www.example.org", IP: "10.0.0.1"},
+		{DNSName: "www.example.org", IP: "10.0.0.2"},
+		{DNSName: "www.example.org", IP: "2001:db8::1", TTL: 60},
+		{DNSName: "alias.example.org", Hostname: "www.example.org"},
+		{DNSName: "external.example.org", Hostname: "lb.example.net"},
+		{DNSName: "a.b.example.org", IP: "10.0.0.3"},
+		{DNSName: "ns.sub.example.org", IP: "10.0.0.4"},
+		{DNSName: "other.example.io", IP: "10.0.0.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	soa := "example.org. 300 IN SOA ns.example.org. hostmaster.example.org. 0 3600 600 86400 60"
+
+	for _, test := range []struct {
+		name     string
+		qtype    uint16
+		rcode    string
+		expected []string
+	}{
+		{"www.example.org.", dns.TypeA, "NOERROR aa", []string{
+			"www.example.org. 300 IN A 10.0.0.1",
+			"www.example.org. 300 IN A 10.0.0.2",
+		}},
+		{"WWW.Example.org.", dns.TypeAAAA, "NOERROR aa", []string{
+			"www.example.org. 60 IN AAAA 2001:db8::1",
+		}},
+		{"www.example.org.", dns.TypeMX, "NOERROR aa", []string{soa}},
+		{"alias.example.org.", dns.TypeA, "NOERROR aa", []string{
+			"alias.example.org. 300 IN CNAME www.example.org.",
+			"www.example.org. 300 IN A 10.0.0.1",
+			"www.example.org. 300 IN A 10.0.0.2",
+		}},
+		{"alias.example.org.", dns.TypeCNAME, "NOERROR aa", []string{
+			"alias.example.org. 300 IN CNAME www.example.org.",
+		}},
+		{"external.example.org.", dns.TypeA, "NOERROR aa", []string{
+			"external.example.org. 300 IN CNAME lb.example.net.",
+		}},
+		{"_mate.www.example.org.", dns.TypeTXT, "NOERROR aa", []string{
+			`_mate.www.example.org. 300 IN TXT "mate:test"`,
+		}},
+		{"_mate.missing.example.org.", dns.TypeTXT, "NXDOMAIN aa", []string{soa}},
+		{"b.example.org.", dns.TypeA, "NOERROR aa", []string{soa}},
+		{"missing.example.org.", dns.TypeA, "NXDOMAIN aa", []string{soa}},
+		{"example.org.", dns.TypeSOA, "NOERROR aa", []string{soa}},
+		{"example.org.", dns.TypeNS, "NOERROR aa", []string{
+			"example.org. 300 IN NS ns.example.org.",
+		}},
+		{"sub.example.org.", dns.TypeNS, "NOERROR aa", []string{
+			"ns.sub.example.org. 300 IN A 10.0.0.4",
+			"sub.example.org. 300 IN NS ns.sub.example.org.",
+		}},
+		{"other.example.io.", dns.TypeA, "REFUSED", []string{}},
+	} {
+		for _, network := range []string{"udp", "tcp"} {
+			t.Run(fmt.Sprintf("%s %s %s", test.name, dns.TypeToString[test.qtype], network), func(t *testing.T) {
+				rcode, records := query(t, consumer, network, test.name, test.qtype)
+				if rcode != test.rcode {
+					t.Errorf("expected rcode %s, got %s", test.rcode, rcode)
+				}
+				if strings.Join(records, "\n") != strings.Join(test.expected, "\n") {
+					t.Errorf("unexpected records\n got: %v\nwant: %v", records, test.expected)
+				}
+			})
+		}
+	}
+}
+
+func TestServerSyncAndProcess(t *testing.T) {
+	consumer := newTestServerConsumer(t, "ns1.example.org")
+	defer consumer.stop()
+
+	if err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "www.example.org", IP: "10.0.0.1"},
+		{DNSName: "gone.example.org", IP: "10.0.0.2"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "cname.example.org", IP: "10.0.0.3"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	serial := consumer.serial
+
+	// the same endpoints don't change the serial
+	if err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "www.example.org.", IP: "10.0.0.1"},
+		{DNSName: "gone.example.org", IP: "10.0.0.2"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if consumer.serial != serial {
+		t.Errorf("expected serial %d to stay, got %d", serial, consumer.serial)
+	}
+
+	if err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "www.example.org", IP: "10.0.0.1"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "www.example.org", IP: "10.0.1.1"},
+		{DNSName: "www.example.org", IP: "10.0.1.1"},
+		{DNSName: "cname.example.org", IP: "10.0.1.2"},
+		{DNSName: "new.example.org", Hostname: "www.example.org"},
+		{DNSName: "other.example.io", IP: "10.0.1.3"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	if consumer.serial != serial+4 {
+		t.Errorf("expected serial %d, got %d", serial+4, consumer.serial)
+	}
+
+	for _, test := range []struct {
+		name     string
+		rcode    string
+		expected []string
+	}{
+		{"www.example.org.", "NOERROR aa", []string{
+			"www.example.org. 300 IN A 10.0.0.1",
+			"www.example.org. 300 IN A 10.0.1.1",
+		}},
+		{"cname.example.org.", "NOERROR aa", []string{
+			"cname.example.org. 300 IN A 10.0.1.2",
+		}},
+		{"new.example.org.", "NOERROR aa", []string{
+			"new.example.org. 300 IN CNAME www.example.org.",
+			"www.example.org. 300 IN A 10.0.0.1",
+			"www.example.org. 300 IN A 10.0.1.1",
+		}},
+		{"gone.example.org.", "NXDOMAIN aa", []string{
+			"example.org. 300 IN SOA ns1.example.org. hostmaster.example.org. 0 3600 600 86400 60",
+		}},
+	} {
+		rcode, records := query(t, consumer, "udp", test.name, dns.TypeA)
+		if rcode != test.rcode {
+			t.Errorf("%s: expected rcode %s, got %s", test.name, test.rcode, rcode)
+		}
+		if strings.Join(records, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: unexpected records\n got: %v\nwant: %v", test.name, records, test.expected)
+		}
+	}
+}
+
+func TestServerTruncation(t *testing.T) {
+	consumer := newTestServerConsumer(t)
+	defer consumer.stop()
+
+	endpoints := make([]*pkg.Endpoint, 0)
+	for i := 0; i < 100; i++ {
+		endpoints = append(endpoints, &pkg.Endpoint{DNSName: "many.example.org", IP: fmt.Sprintf("10.0.%d.%d", i/250, i%250)})
+	}
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	if rcode, records := query(t, consumer, "udp", "many.example.org.", dns.TypeA); rcode != "NOERROR truncated aa" || len(records) != 0 {
+		t.Errorf("expected a truncated answer over UDP, got %s with %d records", rcode, len(records))
+	}
+	if rcode, records := query(t, consumer, "tcp", "many.example.org.", dns.TypeA); rcode != "NOERROR aa" || len(records) != 100 {
+		t.Errorf("expected the full answer over TCP, got %s with %d records", rcode, len(records))
+	}
+}
+
+func TestServerConsume(t *testing.T) {
+	consumer := newTestServerConsumer(t)
+
+	endpoints := make(chan *pkg.Endpoint)
+	errors := make(chan error)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go consumer.Consume(endpoints, errors, done, wg)
+
+	endpoints <- &pkg.Endpoint{DNSName: "live.example.org", IP: "10.0.0.1"}
+	// the unbuffered channel is only read again once the endpoint is processed
+	endpoints <- &pkg.Endpoint{DNSName: "other.example.io", IP: "10.0.0.2"}
+
+	if _, records := query(t, consumer, "tcp", "live.example.org.", dns.TypeA); len(records) != 1 {
+		t.Errorf("expected the processed record, got %v", records)
+	}
+
+	close(done)
+	wg.Wait()
+
+	m := new(dns.Msg)
+	m.SetQuestion("live.example.org.", dns.TypeA)
+	if _, _, err := (&dns.Client{Net: "tcp"}).Exchange(m, consumer.tcp.Listener.Addr().String()); err == nil {
+		t.Error("expected the server to be shut down")
+	}
+}
+
+func TestNewServerConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options ServerOptions
+	}{
+		{"missing zones", ServerOptions{Address: "127.0.0.1:0", GroupID: "test"}},
+		{"missing group id", ServerOptions{Address: "127.0.0.1:0", Zones: []string{"example.org"}}},
+		{"invalid address", ServerOptions{Address: "127.0.0.1", Zones: []string{"example.org"}, GroupID: "test"}},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			if _, err := NewServerConsumer(&test.options); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	consumer := newTestServerConsumer(t)
+	defer consumer.stop()
+
+	// the address is in use by now
+	_, err := NewServerConsumer(&ServerOptions{
+		Address: consumer.udp.PacketConn.LocalAddr().String(),
+		Zones:   []string{"example.org"},
+		GroupID: "test",
+	})
+	if err == nil {
+		t.Error("expected an error for an address in use")
+	}
+}
@@ -0,0 +1,257 @@
+package consumers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultWebhookTimeout       = 10 * time.Second
+	defaultWebhookRetries       = 3
+	defaultWebhookRetryInterval = time.Second
+	// webhookSignatureHeader carries the hex encoded HMAC-SHA256 of the body
+	webhookSignatureHeader = "X-Mate-Signature"
+	webhookEventHeader     = "X-Mate-Event"
+	// webhookMaxResponse limits how much of a response is read
+	webhookMaxResponse = 1 << 20
+)
+
+// webhookEvent is the body posted to the webhook. Sync events hold all
+// desired endpoints, process events a single new one.
+type webhookEvent struct {
+	Type      string             `json:"type"`
+	GroupID   string             `json:"groupId"`
+	Timestamp time.Time          `json:"timestamp"`
+	Endpoints []*webhookEndpoint `json:"endpoints"`
+}
+
+type webhookEndpoint struct {
+	DNSName  string `json:"dnsName"`
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	TTL      int64  `json:"ttl,omitempty"`
+	Private  bool   `json:"private,omitempty"`
+	Proxied  bool   `json:"proxied,omitempty"`
+}
+
+// webhookResponse is the optional body of a successful response reporting
+// the records the receiver failed to apply
+type webhookResponse struct {
+	Failures []struct {
+		DNSName string `json:"dnsName"`
+		Error   string `json:"error"`
+	} `json:"failures"`
+}
+
+type webhookConsumer struct {
+	client        *http.Client
+	url           string
+	secret        []byte
+	groupID       string
+	retries       int
+	retryInterval time.Duration
+	now           func() time.Time
+}
+
+// WebhookOptions configures the consumer for a webhook. Failed requests are
+// retried the given number of times with an exponential backoff.
+type WebhookOptions struct {
+	URL     string
+	Secret  string
+	GroupID string
+	Timeout time.Duration
+	Retries int
+}
+
+// NewWebhookConsumer creates a consumer which posts the desired endpoints on
+// every sync and every new endpoint as JSON to the URL, leaving it to the
+// receiver to apply them. With a secret the body is signed with HMAC-SHA256
+// in the X-Mate-Signature header.
+func NewWebhookConsumer(cfg *WebhookOptions) (Consumer, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("please provide --webhook-url")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --webhook-record-group-id")
+	}
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid --webhook-url %s: must be an http or https URL", cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultWebhookTimeout
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("invalid --webhook-retries %d: must not be negative", cfg.Retries)
+	}
+	if cfg.Secret == "" {
+		log.Warnln("[Webhook] No secret given, requests won't be signed")
+	}
+
+	return &webhookConsumer{
+		client:        &http.Client{Timeout: cfg.Timeout},
+		url:           cfg.URL,
+		secret:        []byte(cfg.Secret),
+		groupID:       cfg.GroupID,
+		retries:       cfg.Retries,
+		retryInterval: defaultWebhookRetryInterval,
+		now:           time.Now,
+	}, nil
+}
+
+// Sync posts all endpoints, the receiver is expected to replace the records
+// of the group with them
+func (d *webhookConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	return combineErrors(d.send("sync", endpoints, nil))
+}
+
+func (d *webhookConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Webhook] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Webhook] channel closed")
+				return
+			}
+
+			log.Infof("[Webhook] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			// report the failures of each record separately
+			for _, err := range d.send("process", []*pkg.Endpoint{e}, done) {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Webhook] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process posts the single endpoint
+func (d *webhookConsumer) Process(endpoint *pkg.Endpoint) error {
+	return combineErrors(d.send("process", []*pkg.Endpoint{endpoint}, nil))
+}
+
+// send posts the event, retrying on connection errors and server side
+// failures until done is closed, and returns the failed request or the
+// failures reported for single records
+func (d *webhookConsumer) send(eventType string, endpoints []*pkg.Endpoint, done <-chan struct{}) []error {
+	event := &webhookEvent{
+		Type:      eventType,
+		GroupID:   d.groupID,
+		Timestamp: d.now().UTC(),
+		Endpoints: make([]*webhookEndpoint, 0, len(endpoints)),
+	}
+	for _, ep := range endpoints {
+		event.Endpoints = append(event.Endpoints, &webhookEndpoint{
+			DNSName:  strings.TrimSuffix(ep.DNSName, "."),
+			IP:       ep.IP,
+			Hostname: strings.TrimSuffix(ep.Hostname, "."),
+			TTL:      ep.TTL,
+			Private:  ep.Private,
+			Proxied:  ep.Proxied,
+		})
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return []error{err}
+	}
+
+	var response *webhookResponse
+	interval := d.retryInterval
+retries:
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		response, retry, err = d.post(eventType, body)
+		if err == nil || !retry || attempt >= d.retries {
+			break
+		}
+
+		log.Warnf("[Webhook] Sending %s event failed, retrying in %s: %v", eventType, interval, err)
+		select {
+		case <-time.After(interval):
+		case <-done:
+			log.Infof("[Webhook] Stopped retrying %s event.", eventType)
+			break retries
+		}
+		interval *= 2
+	}
+	if err != nil {
+		return []error{fmt.Errorf("failed to send %s event: %v", eventType, err)}
+	}
+
+	errs := make([]error, 0, len(response.Failures))
+	for _, failure := range response.Failures {
+		errs = append(errs, fmt.Errorf("failed to apply record %s: %s", failure.DNSName, failure.Error))
+	}
+	return errs
+}
+
+// post sends the body once and reports whether a failure is worth a retry
+func (d *webhookConsumer) post(eventType string, body []byte) (*webhookResponse, bool, error) {
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, eventType)
+	if len(d.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+d.sign(body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: webhookMaxResponse})
+	if err != nil {
+		return nil, true, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		message := strings.TrimSpace(string(data))
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		return nil, retry, fmt.Errorf("request failed (%s): %s", resp.Status, message)
+	}
+
+	response := &webhookResponse{}
+	if len(bytes.TrimSpace(data)) > 0 && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(data, response); err != nil {
+			return nil, false, fmt.Errorf("unexpected response (%s): %v", resp.Status, err)
+		}
+	}
+	return response, false, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body
+func (d *webhookConsumer) sign(body []byte) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,305 @@
+package consumers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+// fakeWebhook records the events it receives and answers with the
+// configured responses in order, repeating the last one
+type fakeWebhook struct {
+	sync.Mutex
+	t         *testing.T
+	secret    string
+	events    []*webhookEvent
+	responses []fakeWebhookResponse
+}
+
+type fakeWebhookResponse struct {
+	status int
+	body   string
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	if f.secret != "" {
+		mac := hmac.New(sha256.New, []byte(f.secret))
+		mac.Write(body)
+		if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get(webhookSignatureHeader) != expected {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	event := &webhookEvent{}
+	if err := json.Unmarshal(body, event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get(webhookEventHeader) != event.Type {
+		http.Error(w, "event type mismatch", http.StatusBadRequest)
+		return
+	}
+	f.events = append(f.events, event)
+
+	response := fakeWebhookResponse{status: http.StatusNoContent}
+	if len(f.responses) > 0 {
+		response = f.responses[0]
+		if len(f.responses) > 1 {
+			f.responses = f.responses[1:]
+		}
+	}
+	if response.body != "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(response.status)
+	w.Write([]byte(response.body))
+}
+
+func newTestWebhookConsumer(t *testing.T, url, secret string) *webhookConsumer {
+	consumer, err := NewWebhookConsumer(&WebhookOptions{
+		URL:     url,
+		Secret:  secret,
+		GroupID: "test",
+		Retries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := consumer.(*webhookConsumer)
+	webhook.retryInterval = time.Millisecond
+	webhook.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) }
+	return webhook
+}
+
+func TestWebhookSync(t *testing.T) {
+	fake := &fakeWebhook{t: t, secret: "s3cr3t"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consumer := newTestWebhookConsumer(t, server.URL, "s3cr3t")
+
+	err := consumer.Sync([]*pkg.Endpoint{
+		{DNSName: "www.example.org.", IP: "10.0.0.1", TTL: 60},
+		{DNSName: "alias.example.org", Hostname: "lb.example.net.", Proxied: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.events) != 1 {
+		t.Fatalf("expected one event, got %d", len(fake.events))
+	}
+	data, _ := json.Marshal(fake.events[0])
+	expected := `{"type":"sync","groupId":"test","timestamp":"2026-10-19T12:00:00Z","endpoints":[` +
+		`{"dnsName":"www.example.org","ip":"10.0.0.1","ttl":60},` +
+		`{"dnsName":"alias.example.org","hostname":"lb.example.net","proxied":true}]}`
+	if string(data) != expected {
+		t.Errorf("unexpected event\n got: %s\nwant: %s", data, expected)
+	}
+
+	// an empty sync still tells the receiver to remove all records
+	if err := consumer.Sync(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.events) != 2 || fake.events[1].Endpoints == nil || len(fake.events[1].Endpoints) != 0 {
+		t.Errorf("expected an event without endpoints, got %v", fake.events)
+	}
+}
+
+func TestWebhookResponses(t *testing.T) {
+	failures := `{"failures":[{"dnsName":"www.example.org","error":"zone not found"},{"dnsName":"alias.example.org","error":"conflict"}]}`
+
+	for _, test := range []struct {
+		title     string
+		secret    string
+		responses []fakeWebhookResponse
+		attempts  int
+		expected  []string
+	}{
+		{
+			title:     "success without body",
+			responses: []fakeWebhookResponse{{http.StatusOK, ""}},
+			attempts:  1,
+		},
+		{
+			title:     "per-record failures",
+			responses: []fakeWebhookResponse{{http.StatusOK, failures}},
+			attempts:  1,
+			expected: []string{
+				"failed to apply record www.example.org: zone not found",
+				"failed to apply record alias.example.org: conflict",
+			},
+		},
+		{
+			title:     "retried server errors",
+			responses: []fakeWebhookResponse{{http.StatusBadGateway, ""}, {http.StatusTooManyRequests, ""}, {http.StatusOK, ""}},
+			attempts:  3,
+		},
+		{
+			title:     "exhausted retries",
+			responses: []fakeWebhookResponse{{http.StatusServiceUnavailable, "maintenance"}},
+			attempts:  3,
+			expected:  []string{"failed to send process event: request failed (503 Service Unavailable): maintenance"},
+		},
+		{
+			title:     "client errors are not retried",
+			secret:    "other",
+			responses: []fakeWebhookResponse{{http.StatusOK, ""}},
+			attempts:  0,
+			expected:  []string{"failed to send process event: request failed (401 Unauthorized): invalid signature"},
+		},
+		{
+			title:     "invalid response",
+			responses: []fakeWebhookResponse{{http.StatusOK, "{"}},
+			attempts:  1,
+			expected:  []string{"failed to send process event: unexpected response (200 OK): unexpected end of JSON input"},
+		},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			fake := &fakeWebhook{t: t, secret: "s3cr3t", responses: test.responses}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			secret := test.secret
+			if secret == "" {
+				secret = "s3cr3t"
+			}
+			consumer := newTestWebhookConsumer(t, server.URL, secret)
+
+			errs := consumer.send("process", []*pkg.Endpoint{{DNSName: "www.example.org", IP: "10.0.0.1"}}, nil)
+
+			messages := make([]string, 0, len(errs))
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("unexpected errors\n got: %v\nwant: %v", messages, test.expected)
+			}
+			if len(fake.events) != test.attempts {
+				t.Errorf("expected %d accepted attempts, got %d", test.attempts, len(fake.events))
+			}
+		})
+	}
+}
+
+func TestWebhookConsume(t *testing.T) {
+	fake := &fakeWebhook{t: t, responses: []fakeWebhookResponse{
+		{http.StatusOK, `{"failures":[{"dnsName":"a.example.org","error":"one"},{"dnsName":"a.example.org","error":"two"}]}`},
+		{http.StatusOK, ""},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consumer := newTestWebhookConsumer(t, server.URL, "")
+
+	endpoints := make(chan *pkg.Endpoint)
+	errors := make(chan error, 4)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go consumer.Consume(endpoints, errors, done, wg)
+
+	endpoints <- &pkg.Endpoint{DNSName: "a.example.org", IP: "10.0.0.1"}
+	// the unbuffered channel is only read again once the endpoint is processed
+	endpoints <- &pkg.Endpoint{DNSName: "b.example.org", IP: "10.0.0.2"}
+
+	close(done)
+	wg.Wait()
+	close(errors)
+
+	messages := make([]string, 0)
+	for err := range errors {
+		messages = append(messages, err.Error())
+	}
+	expected := []string{"failed to apply record a.example.org: one", "failed to apply record a.example.org: two"}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected errors\n got: %v\nwant: %v", messages, expected)
+	}
+	if len(fake.events) != 2 || fake.events[1].Type != "process" {
+		t.Errorf("expected two process events, got %v", fake.events)
+	}
+}
+
+func TestWebhookConsumeStopsRetrying(t *testing.T) {
+	fake := &fakeWebhook{t: t, responses: []fakeWebhookResponse{{http.StatusServiceUnavailable, ""}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consumer := newTestWebhookConsumer(t, server.URL, "")
+	consumer.retryInterval = time.Hour
+
+	endpoints := make(chan *pkg.Endpoint)
+	errors := make(chan error, 1)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go consumer.Consume(endpoints, errors, done, wg)
+
+	endpoints <- &pkg.Endpoint{DNSName: "a.example.org", IP: "10.0.0.1"}
+	close(done)
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the backoff to stop once done is closed")
+	}
+
+	select {
+	case err := <-errors:
+		if !strings.HasPrefix(err.Error(), "failed to send process event") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	default:
+		t.Error("expected an error for the event that wasn't sent")
+	}
+}
+
+func TestNewWebhookConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options WebhookOptions
+		valid   bool
+	}{
+		{"valid", WebhookOptions{URL: "https://hooks.example.org/dns", GroupID: "test"}, true},
+		{"missing url", WebhookOptions{GroupID: "test"}, false},
+		{"missing group id", WebhookOptions{URL: "https://hooks.example.org/dns"}, false},
+		{"invalid url", WebhookOptions{URL: "hooks.example.org/dns", GroupID: "test"}, false},
+		{"negative retries", WebhookOptions{URL: "https://hooks.example.org/dns", GroupID: "test", Retries: -1}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewWebhookConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package consumers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	// zonefileBegin and zonefileEnd are the comments enclosing the records
+	// of a group in a zone file
+	zonefileBegin = "; mate:begin "
+	zonefileEnd   = "; mate:end "
+	// zonefileDateSerial is the smallest serial taken for a date based one
+	// in the format YYYYMMDDnn
+	zonefileDateSerial = 1970010100
+)
+
+// zonefile is a zone file split into the block of records owned by the
+// group and the hand-written content around it
+type zonefile struct {
+	origin string
+	path   string
+	before string
+	after  string
+	// block is whether the file contains records of the group yet
+	block bool
+	// hand holds the records outside the block, owned the ones inside
+	hand  []dns.RR
+	owned []dns.RR
+}
+
+type zonefileConsumer struct {
+	directory string
+	origins   []string
+	groupID   string
+	command   string
+	now       func() time.Time
+
+	// pending holds the zone files written without the command succeeding
+	// afterwards, the command is run again on the next write even if the
+	// records are unchanged
+	pendingMu sync.Mutex
+	pending   map[string]bool
+}
+
+// ZonefileOptions configures the consumer for zone files. The file of an
+// origin is db.<origin> in the directory.
+type ZonefileOptions struct {
+	Directory string
+	Origins   []string
+	GroupID   string
+	Command   string
+}
+
+// NewZonefileConsumer creates a consumer which renders records into RFC 1035
+// zone files, e.g. for BIND. The files must exist and contain the SOA
+// record of the zone. The records of the group are kept in a block enclosed
+// by comments, everything else in the file is left as is.
+func NewZonefileConsumer(cfg *ZonefileOptions) (Consumer, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("please provide --zonefile-dir")
+	}
+	if len(cfg.Origins) == 0 {
+		return nil, errors.New("please provide --zonefile-origin")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("please provide --zonefile-record-group-id")
+	}
+	if strings.ContainsAny(cfg.GroupID, " \t\r\n") {
+		return nil, fmt.Errorf("invalid --zonefile-record-group-id %s: must not contain whitespace", cfg.GroupID)
+	}
+
+	origins := make([]string, 0, len(cfg.Origins))
+	for _, origin := range cfg.Origins {
+		origins = append(origins, canonicalName(origin))
+	}
+
+	return &zonefileConsumer{
+		directory: cfg.Directory,
+		origins:   origins,
+		groupID:   cfg.GroupID,
+		command:   cfg.Command,
+		now:       time.Now,
+		pending:   make(map[string]bool),
+	}, nil
+}
+
+func (d *zonefileConsumer) Sync(endpoints []*pkg.Endpoint) error {
+	desired := make(map[string]map[string][]dns.RR)
+	for _, ep := range endpoints {
+		if ep.Private {
+			log.Warnf("[Zonefile] Skipping private endpoint %s (private endpoints are not supported)", ep.DNSName)
+			continue
+		}
+
+		origin := d.originFor(ep.DNSName)
+		if origin == "" {
+			log.Warnf("[Zonefile] Zone for endpoint %s was not found. Skipping record...", ep.DNSName)
+			continue
+		}
+
+		record, err := endpointToRR(ep)
+		if err != nil {
+			log.Warnf("[Zonefile] Skipping record %s: %v", ep.DNSName, err)
+			continue
+		}
+
+		name := record.Header().Name
+		if desired[origin] == nil {
+			desired[origin] = make(map[string][]dns.RR)
+		}
+		if !canAddRR(desired[origin][name], record) {
+			log.Warnf("[Zonefile] Skipping record %s: a CNAME can't be combined with other records", ep.DNSName)
+			continue
+		}
+		desired[origin][name] = append(desired[origin][name], record)
+	}
+
+	errs := make([]error, 0)
+	for _, origin := range d.origins {
+		if err := d.syncZone(origin, desired[origin]); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %v", origin, err))
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (d *zonefileConsumer) syncZone(origin string, desired map[string][]dns.RR) error {
+	zone, err := d.read(origin)
+	if err != nil {
+		return err
+	}
+
+	used := zone.handNames()
+	owned := make([]dns.RR, 0)
+	for _, name := range sortedRRNames(desired) {
+		if used[name] {
+			log.Warnf("[Zonefile] Skipping record %s: not owned by group ID %s", name, d.groupID)
+			continue
+		}
+		owned = append(owned, desired[name]...)
+	}
+
+	return d.write(zone, owned)
+}
+
+func (d *zonefileConsumer) Consume(endpoints <-chan *pkg.Endpoint, errors chan<- error, done <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	log.Infoln("[Zonefile] Listening for events...")
+
+	for {
+		select {
+		case e, ok := <-endpoints:
+			if !ok {
+				log.Info("[Zonefile] channel closed")
+				return
+			}
+
+			log.Infof("[Zonefile] Processing (%s, %s, %s)\n", e.DNSName, e.IP, e.Hostname)
+
+			err := d.Process(e)
+			if err != nil {
+				errors <- err
+			}
+		case <-done:
+			log.Info("[Zonefile] Exited consuming loop.")
+			return
+		}
+	}
+}
+
+// Process adds the record of the endpoint to a name that is either owned or
+// not in use at all.
+func (d *zonefileConsumer) Process(endpoint *pkg.Endpoint) error {
+	if endpoint.Private {
+		log.Warnf("[Zonefile] Skipping private endpoint %s (private endpoints are not supported)", endpoint.DNSName)
+		return nil
+	}
+
+	origin := d.originFor(endpoint.DNSName)
+	if origin == "" {
+		log.Warnf("[Zonefile] Zone for endpoint %s was not found. Skipping record...", endpoint.DNSName)
+		return nil
+	}
+
+	record, err := endpointToRR(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to process endpoint %s: %v", endpoint.DNSName, err)
+	}
+
+	zone, err := d.read(origin)
+	if err != nil {
+		return fmt.Errorf("zone %s: %v", origin, err)
+	}
+
+	name := record.Header().Name
+	if zone.handNames()[name] {
+		log.Warnf("[Zonefile] Record [name=%s] could not be created, another record with same name already exists", name)
+		return nil
+	}
+
+	// keep the records of other names and the other addresses of the name
+	owned := make([]dns.RR, 0, len(zone.owned)+1)
+	for _, r := range zone.owned {
+		if r.Header().Name != name {
+			owned = append(owned, r)
+			continue
+		}
+		if r.Header().Rrtype == dns.TypeA && record.Header().Rrtype == dns.TypeA && !sameRRs([]dns.RR{r}, []dns.RR{record}) {
+			owned = append(owned, r)
+		}
+	}
+	owned = append(owned, record)
+
+	if err := d.write(zone, owned); err != nil {
+		return fmt.Errorf("zone %s: %v", origin, err)
+	}
+	return nil
+}
+
+// read loads and splits the zone file of the origin
+func (d *zonefileConsumer) read(origin string) (*zonefile, error) {
+	path := d.path(origin)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+
+	zone := &zonefile{origin: origin, path: path, before: content}
+	block := ""
+
+	begin := strings.Index(content, zonefileBegin+d.groupID+"\n")
+	if begin >= 0 {
+		end := strings.Index(content[begin:], zonefileEnd+d.groupID+"\n")
+		if end < 0 {
+			return nil, fmt.Errorf("%s: missing end of the records of group ID %s", path, d.groupID)
+		}
+		end += begin + len(zonefileEnd+d.groupID+"\n")
+
+		zone.before, block, zone.after = content[:begin], content[begin:end], content[end:]
+		zone.block = true
+	}
+
+	if zone.hand, err = parseZone(zone.before+zone.after, origin, path); err != nil {
+		return nil, err
+	}
+	if zone.owned, err = parseZone(block, origin, path); err != nil {
+		return nil, err
+	}
+
+	return zone, nil
+}
+
+// write replaces the records of the group in the zone file if they changed.
+// The SOA serial is increased, the file replaced atomically and the command
+// run afterwards. A command that failed before is run again even if the
+// records didn't change.
+func (d *zonefileConsumer) write(zone *zonefile, owned []dns.RR) error {
+	if sameRRs(zone.owned, owned) {
+		if !d.isPending(zone) {
+			return nil
+		}
+		log.Infof("[Zonefile] Running the command for %s again", zone.path)
+		return d.runCommand(zone)
+	}
+
+	before := zone.before
+	if !zone.block && before != "" && !strings.HasSuffix(before, "\n\n") {
+		// the block is appended to the end of the file
+		before = strings.TrimSuffix(before, "\n") + "\n\n"
+	}
+
+	content, err := d.bumpSerial(before+d.render(owned)+zone.after, zone)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceFile(zone.path, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", zone.path, err)
+	}
+	log.Infof("[Zonefile] Wrote %d records to %s", len(owned), zone.path)
+
+	d.setPending(zone, true)
+	return d.runCommand(zone)
+}
+
+// render returns the block of the records of the group
+func (d *zonefileConsumer) render(records []dns.RR) string {
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, r.String())
+	}
+	sort.Strings(lines)
+
+	return zonefileBegin + d.groupID + "\n" +
+		"; records of group ID " + d.groupID + " are managed by mate, changes will be overwritten\n" +
+		strings.Join(append(lines, ""), "\n") +
+		zonefileEnd + d.groupID + "\n"
+}
+
+// bumpSerial increases the serial of the SOA record in the hand-written part
+// of the zone file. Date based serials are moved to the current day.
+func (d *zonefileConsumer) bumpSerial(content string, zone *zonefile) (string, error) {
+	var soa *dns.SOA
+	for _, r := range zone.hand {
+		if s, ok := r.(*dns.SOA); ok && s.Hdr.Name == zone.origin {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		return "", fmt.Errorf("%s: no SOA record found for %s", zone.path, zone.origin)
+	}
+
+	start, end := soaSerialPosition(content)
+	if start < 0 || content[start:end] != strconv.FormatUint(uint64(soa.Serial), 10) {
+		return "", fmt.Errorf("%s: failed to locate the serial of the SOA record", zone.path)
+	}
+
+	serial := soa.Serial + 1
+	if soa.Serial >= zonefileDateSerial {
+		now := d.now()
+		today := uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100)
+		if serial < today {
+			serial = today
+		}
+	}
+
+	return content[:start] + strconv.FormatUint(uint64(serial), 10) + content[end:], nil
+}
+
+// runCommand runs the command, if any, with the origin and path of the zone
+// file in the environment and clears the pending state of the zone file once
+// it succeeds
+func (d *zonefileConsumer) runCommand(zone *zonefile) error {
+	if d.command == "" {
+		d.setPending(zone, false)
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", d.command)
+	cmd.Env = append(os.Environ(),
+		"MATE_ZONE="+strings.TrimSuffix(zone.origin, "."),
+		"MATE_ZONE_FILE="+zone.path,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %q failed: %v: %s", d.command, err, strings.TrimSpace(string(output)))
+	}
+	d.setPending(zone, false)
+	return nil
+}
+
+// isPending returns whether the command has to be run for the zone file
+func (d *zonefileConsumer) isPending(zone *zonefile) bool {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	return d.pending[zone.path]
+}
+
+func (d *zonefileConsumer) setPending(zone *zonefile, pending bool) {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if pending {
+		d.pending[zone.path] = true
+	} else {
+		delete(d.pending, zone.path)
+	}
+}
+
+// originFor returns the origin with the longest name matching the dns name
+func (d *zonefileConsumer) originFor(dnsName string) string {
+	name := canonicalName(dnsName)
+
+	match := ""
+	for _, origin := range d.origins {
+		if dns.IsSubDomain(origin, name) && len(origin) > len(match) {
+			match = origin
+		}
+	}
+	return match
+}
+
+func (d *zonefileConsumer) path(origin string) string {
+	return filepath.Join(d.directory, "db."+strings.TrimSuffix(origin, "."))
+}
+
+// handNames returns the names used by records outside the block of the group
+func (z *zonefile) handNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, r := range z.hand {
+		names[strings.ToLower(r.Header().Name)] = true
+	}
+	return names
+}
+
+// parseZone returns the records of the zone file content
+func parseZone(content, origin, path string) ([]dns.RR, error) {
+	records := make([]dns.RR, 0)
+
+	var err error
+	for token := range dns.ParseZone(strings.NewReader(content), origin, path) {
+		if token.Error != nil {
+			if err == nil {
+				err = token.Error
+			}
+			continue
+		}
+		records = append(records, token.RR)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// soaSerialPosition returns the start and end of the serial of the first SOA
+// record in the zone file content, or -1 if there is none. The serial is the
+// third field following the SOA type, with comments and parentheses skipped.
+func soaSerialPosition(content string) (int, int) {
+	fields := -1
+	for i := 0; i < len(content); {
+		switch c := content[i]; {
+		case c == ';':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '(' || c == ')':
+			i++
+		default:
+			start := i
+			if c == '"' {
+				for i++; i < len(content) && content[i] != '"'; i++ {
+					if content[i] == '\\' {
+						i++
+					}
+				}
+				i++
+			} else {
+				for i < len(content) && !strings.ContainsRune(" \t\r\n();", rune(content[i])) {
+					i++
+				}
+			}
+			if i > len(content) {
+				i = len(content)
+			}
+
+			switch {
+			case fields < 0 && strings.EqualFold(content[start:i], "SOA"):
+				fields = 0
+			case fields >= 0:
+				fields++
+				if fields == 3 {
+					return start, i
+				}
+			}
+		}
+	}
+	return -1, -1
+}
+
+// replaceFile writes the data to a temporary file next to the file and
+// renames it, keeping the mode of the file
+func replaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
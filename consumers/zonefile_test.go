@@ -0,0 +1,306 @@
+package consumers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const testZonefile = `$ORIGIN example.org.
+$TTL 3600
+@	IN	SOA	ns1.example.org. hostmaster.example.org. (
+		2026101801	; serial
+		7200		; refresh
+		3600		; retry
+		1209600		; expire
+		300 )		; minimum
+	IN	NS	ns1.example.org.
+ns1	IN	A	192.0.2.1
+www	IN	A	192.0.2.2 ; hand-written
+
+; mate:begin other
+foreign.example.org.	300	IN	A	10.0.0.5
+; mate:end other
+`
+
+func newTestZonefileConsumer(t *testing.T, dir, command string, origins ...string) *zonefileConsumer {
+	consumer, err := NewZonefileConsumer(&ZonefileOptions{
+		Directory: dir,
+		Origins:   origins,
+		GroupID:   "test",
+		Command:   command,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zonefiles := consumer.(*zonefileConsumer)
+	zonefiles.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) }
+	return zonefiles
+}
+
+func writeTestZonefile(t *testing.T, dir, origin, content string) string {
+	path := filepath.Join(dir, "db."+origin)
+	if err := ioutil.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readTestZonefile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestZonefileSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mate-zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestZonefile(t, dir, "example.org", testZonefile)
+	subPath := writeTestZonefile(t, dir, "sub.example.org", "sub.example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 7 7200 3600 1209600 300\n")
+
+	log := filepath.Join(dir, "commands")
+	consumer := newTestZonefileConsumer(t, dir, `echo "$MATE_ZONE $MATE_ZONE_FILE" >> `+log, "example.org", "sub.example.org.")
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "new.example.org", IP: "10.0.1.1"},
+		{DNSName: "new.example.org", IP: "10.0.1.2", TTL: 60},
+		{DNSName: "alias.example.org", Hostname: "lb.example.net"},
+		{DNSName: "www.example.org", IP: "10.0.1.3"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.4"},
+		{DNSName: "www.sub.example.org", IP: "10.0.1.5"},
+		{DNSName: "other.example.io", IP: "10.0.1.6"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	}
+
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := strings.Replace(testZonefile, "2026101801", "2026101900", 1) + `
+; mate:begin test
+; records of group ID test are managed by mate, changes will be overwritten
+alias.example.org.	300	IN	CNAME	lb.example.net.
+new.example.org.	300	IN	A	10.0.1.1
+new.example.org.	60	IN	A	10.0.1.2
+; mate:end test
+`
+	if content := readTestZonefile(t, path); content != expected {
+		t.Errorf("unexpected zone file\n got: %s\nwant: %s", content, expected)
+	}
+
+	expected = `sub.example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 8 7200 3600 1209600 300
+
+; mate:begin test
+; records of group ID test are managed by mate, changes will be overwritten
+www.sub.example.org.	300	IN	A	10.0.1.5
+; mate:end test
+`
+	if content := readTestZonefile(t, subPath); content != expected {
+		t.Errorf("unexpected zone file\n got: %s\nwant: %s", content, expected)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("expected the mode of the zone file to be kept, got %v (%v)", info.Mode(), err)
+	}
+
+	// unchanged records leave the files alone
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content := readTestZonefile(t, subPath); !strings.Contains(content, " 8 7200 ") {
+		t.Errorf("expected the serial to stay the same, got %s", content)
+	}
+
+	expected = "example.org " + path + "\nsub.example.org " + subPath + "\n"
+	if commands := readTestZonefile(t, log); commands != expected {
+		t.Errorf("unexpected commands\n got: %s\nwant: %s", commands, expected)
+	}
+
+	// removed endpoints remove their records
+	if err := consumer.Sync(endpoints[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected = `sub.example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 9 7200 3600 1209600 300
+
+; mate:begin test
+; records of group ID test are managed by mate, changes will be overwritten
+; mate:end test
+`
+	if content := readTestZonefile(t, subPath); content != expected {
+		t.Errorf("unexpected zone file\n got: %s\nwant: %s", content, expected)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected no temporary files to be left, got %d files", len(files))
+	}
+}
+
+func TestZonefileProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mate-zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestZonefile(t, dir, "example.org", testZonefile)
+	consumer := newTestZonefileConsumer(t, dir, "", "example.org")
+
+	for _, ep := range []*pkg.Endpoint{
+		{DNSName: "owned.example.org", IP: "10.0.1.1"},
+		{DNSName: "owned.example.org", IP: "10.0.1.2"},
+		{DNSName: "owned.example.org", IP: "10.0.1.2"},
+		{DNSName: "cname.example.org", IP: "10.0.1.3"},
+		{DNSName: "cname.example.org", Hostname: "lb.example.net"},
+		{DNSName: "www.example.org", IP: "10.0.1.4"},
+		{DNSName: "foreign.example.org", IP: "10.0.1.5"},
+		{DNSName: "other.example.io", IP: "10.0.1.6"},
+		{DNSName: "private.example.org", IP: "10.0.2.1", Private: true},
+	} {
+		if err := consumer.Process(ep); err != nil {
+			t.Errorf("unexpected error processing %s: %v", ep.DNSName, err)
+		}
+	}
+
+	expected := strings.Replace(testZonefile, "2026101801", "2026101903", 1) + `
+; mate:begin test
+; records of group ID test are managed by mate, changes will be overwritten
+cname.example.org.	300	IN	CNAME	lb.example.net.
+owned.example.org.	300	IN	A	10.0.1.1
+owned.example.org.	300	IN	A	10.0.1.2
+; mate:end test
+`
+	if content := readTestZonefile(t, path); content != expected {
+		t.Errorf("unexpected zone file\n got: %s\nwant: %s", content, expected)
+	}
+}
+
+func TestZonefileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mate-zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestZonefile(t, dir, "example.org", "www.example.org. 300 IN A 192.0.2.1\n")
+	writeTestZonefile(t, dir, "example.net", "example.net. 300 IN SOA ns1 hostmaster 1 2 3 4 5\n")
+
+	for _, test := range []struct {
+		title    string
+		origin   string
+		command  string
+		expected string
+	}{
+		{"missing file", "example.com", "", "no such file"},
+		{"missing SOA", "example.org", "", "no SOA record"},
+		{"failing command", "example.net", "echo reload failed; exit 1", "reload failed"},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			consumer := newTestZonefileConsumer(t, dir, test.command, test.origin)
+
+			err := consumer.Sync([]*pkg.Endpoint{{DNSName: "new." + test.origin, IP: "10.0.1.1"}})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestZonefileCommandRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mate-zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestZonefile(t, dir, "example.org", testZonefile)
+
+	// the command fails on its first run only and counts its runs
+	runs := filepath.Join(dir, "runs")
+	command := "echo run >> " + runs + "; test -e " + dir + "/reloaded || { touch " + dir + "/reloaded; echo reload failed; exit 1; }"
+	consumer := newTestZonefileConsumer(t, dir, command, "example.org")
+
+	endpoints := []*pkg.Endpoint{{DNSName: "new.example.org", IP: "10.0.1.1"}}
+
+	if err := consumer.Sync(endpoints); err == nil || !strings.Contains(err.Error(), "reload failed") {
+		t.Fatalf("expected the command to fail, got %v", err)
+	}
+
+	// the records are in place already, but the command is run again
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := strings.Count(readTestZonefile(t, runs), "run"); count != 2 {
+		t.Errorf("expected the command to be run again, got %d runs", count)
+	}
+
+	// afterwards unchanged records don't run the command
+	if err := consumer.Sync(endpoints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count := strings.Count(readTestZonefile(t, runs), "run"); count != 2 {
+		t.Errorf("expected no more runs, got %d runs", count)
+	}
+}
+
+func TestNewZonefileConsumer(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		options ZonefileOptions
+		valid   bool
+	}{
+		{"valid", ZonefileOptions{Directory: "/etc/bind", Origins: []string{"example.org"}, GroupID: "test"}, true},
+		{"missing directory", ZonefileOptions{Origins: []string{"example.org"}, GroupID: "test"}, false},
+		{"missing origins", ZonefileOptions{Directory: "/etc/bind", GroupID: "test"}, false},
+		{"missing group id", ZonefileOptions{Directory: "/etc/bind", Origins: []string{"example.org"}}, false},
+		{"group id with whitespace", ZonefileOptions{Directory: "/etc/bind", Origins: []string{"example.org"}, GroupID: "a b"}, false},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewZonefileConsumer(&test.options)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSOASerialPosition(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		expected string
+	}{
+		{"@ IN SOA ns1 hostmaster 42 1 2 3 4\n", "42"},
+		{"@ IN soa ns1 hostmaster (\n\t42 ; serial\n\t1 2 3 4 )\n", "42"},
+		{"; SOA in a comment\n@ IN SOA ns1 hostmaster ( ; names\n 42 1 2 3 4 )\n", "42"},
+		{"txt IN TXT \"no SOA here\"\n@ IN SOA ns1 hostmaster 42 1 2 3 4\n", "42"},
+		{"www IN A 192.0.2.1\n", ""},
+	} {
+		start, end := soaSerialPosition(test.content)
+		serial := ""
+		if start >= 0 {
+			serial = test.content[start:end]
+		}
+		if serial != test.expected {
+			t.Errorf("soaSerialPosition(%q) => %q, want %q", test.content, serial, test.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Command plugin serves the AWS or Google consumer through the consumer
+// plugin protocol of mate. It is the reference implementation of the
+// protocol described in pkg/plugin/plugin.proto:
+//
+//	$ plugin --provider=aws --listen=unix:/run/mate/plugin.sock --record-group-id=foo
+//	$ mate --consumer=plugin:unix:/run/mate/plugin.sock --plugin-record-group-id=foo ...
+package main
+
+import (
+	"net"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/zalando-incubator/mate/consumers"
+	"github.com/zalando-incubator/mate/pkg/plugin"
+)
+
+func main() {
+	var provider, listen, groupID string
+	var googleProjects []string
+
+	kingpin.Flag("provider", "The built-in consumer to serve.").Required().EnumVar(&provider, "aws", "google")
+	kingpin.Flag("listen", "The TCP address or unix:<path> to listen on.").Default("127.0.0.1:7979").StringVar(&listen)
+	kingpin.Flag("record-group-id", "Identifier to filter mate created records").Required().StringVar(&groupID)
+	kingpin.Flag("google-project", "ID of a project whose managed zones to serve, can be given several times.").StringsVar(&googleProjects)
+	kingpin.Parse()
+
+	var consumer consumers.Consumer
+	var err error
+	switch provider {
+	case "aws":
+		consumer, err = consumers.NewAWSRoute53Consumer(&consumers.AWSOptions{GroupID: groupID})
+	case "google":
+		consumer, err = consumers.NewGoogleCloudDNSConsumer(&consumers.GoogleOptions{Projects: googleProjects, GroupID: groupID})
+	}
+	if err != nil {
+		log.Fatalf("Error creating consumer: %v", err)
+	}
+
+	srv, err := consumers.NewPluginServer(consumer, groupID)
+	if err != nil {
+		log.Fatalf("Error creating plugin: %v", err)
+	}
+
+	network, address := "tcp", listen
+	if strings.HasPrefix(listen, "unix:") {
+		network, address = "unix", strings.TrimPrefix(listen, "unix:")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", listen, err)
+	}
+
+	server := grpc.NewServer()
+	plugin.RegisterConsumerServer(server, srv)
+
+	log.Infof("Serving the %s consumer on %s", provider, listen)
+	if err := server.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -51,17 +52,145 @@ func main() {
 }
 
 func newSynchronizedConsumer(cfg *mateConfig) (consumers.Consumer, error) {
+	names := strings.Split(cfg.consumer, ",")
+	if len(names) == 1 {
+		return newSingleConsumer(cfg, names[0])
+	}
+
+	// every backend is synchronized on its own, the backends are applied
+	// concurrently but in lockstep: a slow one delays the others
+	backends := make(map[string]consumers.Consumer, len(names))
+	for _, name := range names {
+		if _, exists := backends[name]; exists {
+			return nil, fmt.Errorf("Consumer '%s' is given more than once.", name)
+		}
+
+		consumer, err := newSingleConsumer(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		backends[name] = consumer
+	}
+
+	return consumers.NewMultiConsumer(backends)
+}
+
+func newSingleConsumer(cfg *mateConfig, name string) (consumers.Consumer, error) {
 	var consumer consumers.Consumer
 	var err error
-	switch cfg.consumer {
+
+	// plugins are given along with their address as plugin:<addr>
+	kind, address := name, ""
+	if strings.HasPrefix(name, "plugin:") {
+		kind, address = "plugin", strings.TrimPrefix(name, "plugin:")
+	}
+
+	switch kind {
 	case "google":
-		consumer, err = consumers.NewGoogleCloudDNSConsumer(cfg.googleProject, cfg.googleRecordGroupID)
+		googleConfig := &consumers.GoogleOptions{
+			Projects:            cfg.googleProjects,
+			CredentialsFile:     cfg.googleCredentialsFile,
+			GroupID:             cfg.googleRecordGroupID,
+			ZoneNames:           cfg.googleZones,
+			Domains:             cfg.googleDomains,
+			ZoneVisibility:      cfg.googleZoneVisibility,
+			ZoneRefreshInterval: cfg.googleZoneRefreshInterval,
+			ChangeTimeout:       cfg.googleChangeTimeout,
+		}
+		consumer, err = consumers.NewGoogleCloudDNSConsumer(googleConfig)
 	case "aws":
-		consumer, err = consumers.NewAWSRoute53Consumer(cfg.awsRecordGroupID)
+		awsConfig := &consumers.AWSOptions{
+			GroupID:  cfg.awsRecordGroupID,
+			Domains:  cfg.awsDomains,
+			ZoneIDs:  cfg.awsZoneIDs,
+			ZoneType: cfg.awsZoneType,
+		}
+		consumer, err = consumers.NewAWSRoute53Consumer(awsConfig)
+	case "rfc2136":
+		rfc2136Config := &consumers.RFC2136Options{
+			Server:        cfg.rfc2136Server,
+			Zones:         cfg.rfc2136Zones,
+			GroupID:       cfg.rfc2136RecordGroupID,
+			TSIGKeyName:   cfg.rfc2136TSIGKeyName,
+			TSIGSecret:    cfg.rfc2136TSIGSecret,
+			TSIGAlgorithm: cfg.rfc2136TSIGAlgorithm,
+		}
+		consumer, err = consumers.NewRFC2136Consumer(rfc2136Config)
+	case "powerdns":
+		powerDNSConfig := &consumers.PowerDNSOptions{
+			ServerURL: cfg.powerDNSServer,
+			APIKey:    cfg.powerDNSAPIKey,
+			ServerID:  cfg.powerDNSServerID,
+			GroupID:   cfg.powerDNSRecordGroupID,
+		}
+		consumer, err = consumers.NewPowerDNSConsumer(powerDNSConfig)
+	case "cloudflare":
+		cloudflareConfig := &consumers.CloudflareOptions{
+			BaseURL:  cfg.cloudflareAPIURL,
+			APIToken: cfg.cloudflareAPIToken,
+			APIEmail: cfg.cloudflareAPIEmail,
+			APIKey:   cfg.cloudflareAPIKey,
+			GroupID:  cfg.cloudflareRecordGroupID,
+		}
+		consumer, err = consumers.NewCloudflareConsumer(cloudflareConfig)
+	case "azure":
+		azureConfig := &consumers.AzureOptions{
+			ARMEndpoint:    cfg.azureARMEndpoint,
+			AuthorityURL:   cfg.azureAuthorityURL,
+			SubscriptionID: cfg.azureSubscriptionID,
+			ResourceGroup:  cfg.azureResourceGroup,
+			TenantID:       cfg.azureTenantID,
+			ClientID:       cfg.azureClientID,
+			ClientSecret:   cfg.azureClientSecret,
+			GroupID:        cfg.azureRecordGroupID,
+		}
+		consumer, err = consumers.NewAzureConsumer(azureConfig)
+	case "etcd":
+		etcdConfig := &consumers.EtcdOptions{
+			Endpoints: cfg.etcdEndpoints,
+			Prefix:    cfg.etcdPrefix,
+			CertFile:  cfg.etcdCertFile,
+			KeyFile:   cfg.etcdKeyFile,
+			CAFile:    cfg.etcdCAFile,
+			GroupID:   cfg.etcdRecordGroupID,
+		}
+		consumer, err = consumers.NewEtcdConsumer(etcdConfig)
+	case "zonefile":
+		zonefileConfig := &consumers.ZonefileOptions{
+			Directory: cfg.zonefileDir,
+			Origins:   cfg.zonefileOrigins,
+			Command:   cfg.zonefileCommand,
+			GroupID:   cfg.zonefileRecordGroupID,
+		}
+		consumer, err = consumers.NewZonefileConsumer(zonefileConfig)
+	case "server":
+		serverConfig := &consumers.ServerOptions{
+			Address:     cfg.serverAddress,
+			Zones:       cfg.serverZones,
+			NameServers: cfg.serverNameServers,
+			GroupID:     cfg.serverRecordGroupID,
+		}
+		consumer, err = consumers.NewServerConsumer(serverConfig)
+	case "webhook":
+		webhookConfig := &consumers.WebhookOptions{
+			URL:     cfg.webhookURL,
+			Secret:  cfg.webhookSecret,
+			Timeout: cfg.webhookTimeout,
+			Retries: cfg.webhookRetries,
+			GroupID: cfg.webhookRecordGroupID,
+		}
+		consumer, err = consumers.NewWebhookConsumer(webhookConfig)
+	case "plugin":
+		pluginConfig := &consumers.PluginOptions{
+			Address: address,
+			Timeout: cfg.pluginTimeout,
+			GroupID: cfg.pluginRecordGroupID,
+		}
+		consumer, err = consumers.NewPluginConsumer(pluginConfig)
 	case "stdout":
 		consumer, err = consumers.NewStdoutConsumer()
 	default:
-		return nil, fmt.Errorf("Unknown consumer '%s'.", cfg.consumer)
+		return nil, fmt.Errorf("Unknown consumer '%s'.", name)
 	}
 	if err != nil {
 		return nil, err
@@ -70,15 +199,51 @@ func newSynchronizedConsumer(cfg *mateConfig) (consumers.Consumer, error) {
 }
 
 func newProducer(cfg *mateConfig) (producers.Producer, error) {
-	switch cfg.producer {
+	names := strings.Split(cfg.producer, ",")
+	if len(names) == 1 {
+		return newSingleProducer(cfg, names[0])
+	}
+
+	sources := make(map[string]producers.Producer, len(names))
+	for _, name := range names {
+		if _, exists := sources[name]; exists {
+			return nil, fmt.Errorf("Producer '%s' is given more than once.", name)
+		}
+
+		producer, err := newSingleProducer(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		sources[name] = producer
+	}
+
+	compositeConfig := &producers.CompositeProducerOptions{
+		FailurePolicy:      cfg.producerFailurePolicy,
+		MaxStartupFailures: cfg.producerStartupFailures,
+	}
+	return producers.NewCompositeProducer(sources, compositeConfig)
+}
+
+func newSingleProducer(cfg *mateConfig, name string) (producers.Producer, error) {
+	switch name {
 	case "kubernetes":
 		kubeConfig := &producers.KubernetesOptions{
-			Format:         cfg.kubernetesFormat,
-			APIServer:      cfg.kubernetesServer,
-			TrackNodePorts: cfg.kubernetesTrackNodePorts,
-			Filter:         cfg.kubernetesFilter,
+			Format:            cfg.kubernetesFormat,
+			APIServer:         cfg.kubernetesServer,
+			TrackNodePorts:    cfg.kubernetesTrackNodePorts,
+			TrackExternalName: cfg.kubernetesTrackExternalName,
+			TrackExternalIPs:  cfg.kubernetesTrackExternalIPs,
+			TrackClusterIP:    cfg.kubernetesTrackClusterIP,
+			TrackDNSEndpoints: cfg.kubernetesTrackDNSEndpoints,
+			Filter:            cfg.kubernetesFilter,
 		}
 		return producers.NewKubernetesProducer(kubeConfig)
+	case "crd":
+		crdConfig := &producers.KubernetesOptions{
+			APIServer: cfg.kubernetesServer,
+			Filter:    cfg.kubernetesFilter,
+		}
+		return producers.NewCRDProducer(crdConfig)
 	case "fake":
 		fakeConfig := &producers.FakeProducerOptions{
 			DNSName:       cfg.fakeDNSName,
@@ -89,8 +254,14 @@ func newProducer(cfg *mateConfig) (producers.Producer, error) {
 			TargetDomain:  cfg.fakeTargetDomain,
 		}
 		return producers.NewFakeProducer(fakeConfig)
+	case "file":
+		fileConfig := &producers.FileProducerOptions{
+			Path:         cfg.filePath,
+			PollInterval: cfg.filePollInterval,
+		}
+		return producers.NewFileProducer(fileConfig)
 	case "null":
 		return producers.NewNullProducer()
 	}
-	return nil, fmt.Errorf("Unknown producer '%s'.", cfg.producer)
+	return nil, fmt.Errorf("Unknown producer '%s'.", name)
 }
@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultLoadBalancerCacheTTL = 5 * time.Minute
+	// hostnames which aren't load balancers are looked up again sooner, so
+	// that new load balancers are found quickly
+	loadBalancerMissTTL = 30 * time.Second
+)
+
+// loadBalancerCache caches the canonical hosted zone IDs of load balancers
+// by their DNS name. Each entry expires on its own, the load balancers are
+// only described again when an expired or unknown DNS name is requested and
+// all load balancers found are merged into the cache.
+type loadBalancerCache struct {
+	mutex    sync.Mutex
+	entries  map[string]*loadBalancerEntry
+	ttl      time.Duration
+	describe func() ([]*LoadBalancer, error)
+	now      func() time.Time
+}
+
+type loadBalancerEntry struct {
+	canonicalZoneID string // empty if the DNS name isn't a load balancer
+	expires         time.Time
+}
+
+func newLoadBalancerCache(ttl time.Duration, describe func() ([]*LoadBalancer, error)) *loadBalancerCache {
+	return &loadBalancerCache{
+		entries:  map[string]*loadBalancerEntry{},
+		ttl:      ttl,
+		describe: describe,
+		now:      time.Now,
+	}
+}
+
+// canonicalZoneIDs returns the canonical hosted zone IDs of the DNS names
+// which are load balancers
+func (c *loadBalancerCache) canonicalZoneIDs(lbDNS []string) map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+
+	var stale []string
+	for _, dns := range lbDNS {
+		if entry, exists := c.entries[dns]; !exists || !now.Before(entry.expires) {
+			stale = append(stale, dns)
+		}
+	}
+
+	if len(stale) > 0 {
+		c.refresh(now, stale)
+	}
+
+	loadBalancersMap := map[string]string{} //map LB Dns to its canonical hosted zone id
+	for _, dns := range lbDNS {
+		if entry, exists := c.entries[dns]; exists && entry.canonicalZoneID != "" {
+			loadBalancersMap[dns] = entry.canonicalZoneID
+		}
+	}
+	return loadBalancersMap
+}
+
+// refresh describes the load balancers and merges them into the cache. The
+// stale DNS names not found are remembered as misses unless describing failed,
+// expired entries of other DNS names are dropped.
+func (c *loadBalancerCache) refresh(now time.Time, stale []string) {
+	log.Debugf("Describing load balancers for %d unknown or expired DNS names", len(stale))
+
+	loadBalancers, err := c.describe()
+	if err != nil {
+		log.Errorf("Error getting LBs: %v. Skipping...", err)
+	}
+
+	for dns, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, dns)
+		}
+	}
+
+	for _, lb := range loadBalancers {
+		c.entries[lb.DNSName] = &loadBalancerEntry{
+			canonicalZoneID: lb.CanonicalZoneID,
+			expires:         now.Add(c.ttl),
+		}
+	}
+
+	if err != nil {
+		return
+	}
+	missTTL := loadBalancerMissTTL
+	if c.ttl < missTTL {
+		missTTL = c.ttl
+	}
+	for _, dns := range stale {
+		if _, exists := c.entries[dns]; !exists {
+			c.entries[dns] = &loadBalancerEntry{expires: now.Add(missTTL)}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeDescriber struct {
+	calls         int
+	loadBalancers []*LoadBalancer
+	err           error
+}
+
+func (f *fakeDescriber) describe() ([]*LoadBalancer, error) {
+	f.calls++
+	return f.loadBalancers, f.err
+}
+
+func TestLoadBalancerCache(t *testing.T) {
+	describer := &fakeDescriber{loadBalancers: []*LoadBalancer{
+		{DNSName: "elb-1.eu-central-1.elb.amazonaws.com", CanonicalZoneID: "Z215JYRZR1TBD5"},
+		{DNSName: "alb-2.eu-central-1.elb.amazonaws.com", CanonicalZoneID: "Z215JYRZR1TBD5"},
+	}}
+	now := time.Now()
+	cache := newLoadBalancerCache(time.Minute, describer.describe)
+	cache.now = func() time.Time { return now }
+
+	zoneIDs := cache.canonicalZoneIDs([]string{"elb-1.eu-central-1.elb.amazonaws.com", "cdn.example.org"})
+	if len(zoneIDs) != 1 || zoneIDs["elb-1.eu-central-1.elb.amazonaws.com"] != "Z215JYRZR1TBD5" {
+		t.Errorf("unexpected zone ids: %v", zoneIDs)
+	}
+	if describer.calls != 1 {
+		t.Errorf("expected the load balancers to be described once, got %d", describer.calls)
+	}
+
+	// all load balancers found are cached, as well as misses
+	zoneIDs = cache.canonicalZoneIDs([]string{"alb-2.eu-central-1.elb.amazonaws.com", "cdn.example.org"})
+	if len(zoneIDs) != 1 || zoneIDs["alb-2.eu-central-1.elb.amazonaws.com"] != "Z215JYRZR1TBD5" {
+		t.Errorf("unexpected zone ids: %v", zoneIDs)
+	}
+	if describer.calls != 1 {
+		t.Errorf("expected the cached zone ids to be used, got %d calls", describer.calls)
+	}
+
+	// misses expire before the load balancers
+	describer.loadBalancers = append(describer.loadBalancers, &LoadBalancer{DNSName: "cdn.example.org", CanonicalZoneID: "Z2FDTNDATAQYW2"})
+	now = now.Add(loadBalancerMissTTL)
+	zoneIDs = cache.canonicalZoneIDs([]string{"cdn.example.org"})
+	if zoneIDs["cdn.example.org"] != "Z2FDTNDATAQYW2" || describer.calls != 2 {
+		t.Errorf("expected the miss to be looked up again, got %v after %d calls", zoneIDs, describer.calls)
+	}
+
+	// an expired load balancer is described again
+	now = now.Add(time.Minute)
+	describer.err = errors.New("throttled")
+	describer.loadBalancers = nil
+	zoneIDs = cache.canonicalZoneIDs([]string{"elb-1.eu-central-1.elb.amazonaws.com", "new.example.org"})
+	if len(zoneIDs) != 0 || describer.calls != 3 {
+		t.Errorf("expected the expired entry to be looked up again, got %v after %d calls", zoneIDs, describer.calls)
+	}
+
+	// failures aren't remembered as misses
+	describer.err = nil
+	describer.loadBalancers = []*LoadBalancer{{DNSName: "new.example.org", CanonicalZoneID: "Z215JYRZR1TBD5"}}
+	zoneIDs = cache.canonicalZoneIDs([]string{"new.example.org"})
+	if zoneIDs["new.example.org"] != "Z215JYRZR1TBD5" || describer.calls != 4 {
+		t.Errorf("expected the failed lookup to be retried, got %v after %d calls", zoneIDs, describer.calls)
+	}
+}
@@ -0,0 +1,141 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cloudFrontZoneID is the canonical hosted zone ID of all CloudFront
+// distributions, including edge-optimized API Gateway endpoints
+const cloudFrontZoneID = "Z2FDTNDATAQYW2"
+
+// canonicalHostedZone maps the hostnames of an AWS service matching the
+// pattern to the canonical hosted zone ID of the region they are in
+type canonicalHostedZone struct {
+	pattern *regexp.Regexp // the first group is the region
+	zoneIDs map[string]string
+}
+
+// canonicalHostedZones is the built-in table of the canonical hosted zones,
+// see https://docs.aws.amazon.com/general/latest/gr/rande.html. Load
+// balancers in regions missing here are looked up with the describe APIs.
+var canonicalHostedZones = []*canonicalHostedZone{
+	{
+		// classic ELBs and ALBs, e.g. name-1234.eu-central-1.elb.amazonaws.com
+		pattern: regexp.MustCompile(`\.([a-z]{2}(?:-[a-z]+)+-\d)\.elb\.amazonaws\.com\.?$`),
+		zoneIDs: map[string]string{
+			"us-east-1":      "Z35SXDOTRQ7X7K",
+			"us-east-2":      "Z3AADJGX6KTTL2",
+			"us-west-1":      "Z368ELLRRE2KJ0",
+			"us-west-2":      "Z1H1FL5HABSF5",
+			"ca-central-1":   "ZQSVJUPU6J1EY",
+			"eu-central-1":   "Z215JYRZR1TBD5",
+			"eu-west-1":      "Z32O12XQLNTSW2",
+			"eu-west-2":      "ZHURV8PSTC4K8",
+			"eu-west-3":      "Z3Q77PNBQS71R4",
+			"ap-south-1":     "ZP97RAFLXTNZK",
+			"ap-northeast-1": "Z14GRHDCWA56QT",
+			"ap-northeast-2": "ZWKZPGTI48KDX",
+			"ap-southeast-1": "Z1LMS91P8CMLE5",
+			"ap-southeast-2": "Z1GM3OXH4ZPM65",
+			"sa-east-1":      "Z2P70J7HTTTPLU",
+		},
+	},
+	{
+		// NLBs, e.g. name-1234.elb.eu-central-1.amazonaws.com
+		pattern: regexp.MustCompile(`\.elb\.([a-z]{2}(?:-[a-z]+)+-\d)\.amazonaws\.com\.?$`),
+		zoneIDs: map[string]string{
+			"us-east-1":      "Z26RNL4JYFTOTI",
+			"us-east-2":      "ZLMOA37VPKANP",
+			"us-west-1":      "Z24FKFUX50B4VW",
+			"us-west-2":      "Z18D5FSROUN65G",
+			"ca-central-1":   "Z2EPGBW3API2WT",
+			"eu-central-1":   "Z3F0SRJ5LGBH90",
+			"eu-west-1":      "Z2IFOLAFXWLO4F",
+			"eu-west-2":      "ZD4D7Y8KGAS4G",
+			"ap-south-1":     "ZVDDRBQ08TROA",
+			"ap-northeast-1": "Z31USIVHYNEOWT",
+			"ap-northeast-2": "ZIBE1TIR4HY56",
+			"ap-southeast-1": "ZKVM4W9LS7TM",
+			"ap-southeast-2": "ZCT6FZBF4DROD",
+			"sa-east-1":      "ZTK26PT1VY4CU",
+		},
+	},
+	{
+		// S3 website endpoints, e.g. bucket.s3-website-eu-west-1.amazonaws.com
+		// or bucket.s3-website.eu-central-1.amazonaws.com
+		pattern: regexp.MustCompile(`(?:^|\.)s3-website[.-]([a-z]{2}(?:-[a-z]+)+-\d)\.amazonaws\.com\.?$`),
+		zoneIDs: map[string]string{
+			"us-east-1":      "Z3AQBSTGFYJSTF",
+			"us-east-2":      "Z2O1EMRO9K5GLX",
+			"us-west-1":      "Z2F56UZL2M1ACD",
+			"us-west-2":      "Z3BJ6K6RIION7M",
+			"ca-central-1":   "Z1QDHH18159H29",
+			"eu-central-1":   "Z21DNDUVLTQW6Q",
+			"eu-west-1":      "Z1BKCTXD74EZPE",
+			"eu-west-2":      "Z3GKZC51ZF0DB4",
+			"eu-west-3":      "Z3R1K369G5AVDG",
+			"ap-south-1":     "Z11RGJOFQNVJUP",
+			"ap-northeast-1": "Z2M4EHUR26P7ZW",
+			"ap-northeast-2": "Z3W03O7B5YMIYP",
+			"ap-southeast-1": "Z3O0J2DXBE1FTB",
+			"ap-southeast-2": "Z1WCIGYICN2BYD",
+			"sa-east-1":      "Z7KQH4QJS55SO",
+		},
+	},
+	{
+		// regional API Gateway endpoints, e.g.
+		// d-1234.execute-api.eu-central-1.amazonaws.com
+		pattern: regexp.MustCompile(`\.execute-api\.([a-z]{2}(?:-[a-z]+)+-\d)\.amazonaws\.com\.?$`),
+		zoneIDs: map[string]string{
+			"us-east-1":      "Z1UJRXOUMOOFQ8",
+			"us-east-2":      "ZOJJZC49E0EPZ",
+			"us-west-1":      "Z2MUQ32089INYE",
+			"us-west-2":      "Z2OJLYMUO9EFXC",
+			"ca-central-1":   "Z19DQILCV0OWEC",
+			"eu-central-1":   "Z1U9ULNL0V5AJ3",
+			"eu-west-1":      "ZLY8HYME6SFDD",
+			"eu-west-2":      "ZJ5UAJN8Y3Z2Q",
+			"ap-south-1":     "Z3VO1THU9YC4UR",
+			"ap-northeast-1": "Z1YSHQZHG15GKL",
+			"ap-northeast-2": "Z20JF4UZKIW1U8",
+			"ap-southeast-1": "ZL327KTPIQFUL",
+			"ap-southeast-2": "Z2RPCDW04V8134",
+			"sa-east-1":      "ZCMLWB8V5SYIT",
+		},
+	},
+}
+
+// staticCanonicalZoneID returns the canonical hosted zone ID of the hostname
+// from the built-in table, empty if the hostname or its region is unknown
+func staticCanonicalZoneID(hostname string) string {
+	hostname = strings.ToLower(hostname)
+
+	if strings.HasSuffix(strings.TrimSuffix(hostname, "."), ".cloudfront.net") {
+		return cloudFrontZoneID
+	}
+
+	for _, zone := range canonicalHostedZones {
+		if match := zone.pattern.FindStringSubmatch(hostname); match != nil {
+			return zone.zoneIDs[match[1]]
+		}
+	}
+	return ""
+}
+
+// IsAliasTarget returns whether the hostname belongs to one of the AWS
+// services records can be aliased to, even if its region is unknown
+func IsAliasTarget(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+
+	if strings.HasSuffix(strings.TrimSuffix(hostname, "."), ".cloudfront.net") {
+		return true
+	}
+
+	for _, zone := range canonicalHostedZones {
+		if zone.pattern.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package aws
+
+import "testing"
+
+func TestStaticCanonicalZoneID(t *testing.T) {
+	for _, test := range []struct {
+		hostname string
+		zoneID   string
+	}{
+		{"my-elb-1234567890.eu-central-1.elb.amazonaws.com", "Z215JYRZR1TBD5"},
+		{"internal-my-alb-1234567890.us-east-1.elb.amazonaws.com.", "Z35SXDOTRQ7X7K"},
+		{"dualstack.my-elb-1234567890.eu-west-1.elb.amazonaws.com", "Z32O12XQLNTSW2"},
+		{"my-nlb-1234567890abcdef.elb.eu-central-1.amazonaws.com", "Z3F0SRJ5LGBH90"},
+		{"d111111abcdef8.cloudfront.net", "Z2FDTNDATAQYW2"},
+		{"D111111ABCDEF8.CloudFront.net.", "Z2FDTNDATAQYW2"},
+		{"bucket.s3-website-eu-west-1.amazonaws.com", "Z1BKCTXD74EZPE"},
+		{"bucket.s3-website.eu-central-1.amazonaws.com", "Z21DNDUVLTQW6Q"},
+		{"d-1234567890.execute-api.eu-central-1.amazonaws.com", "Z1U9ULNL0V5AJ3"},
+		{"my-elb-1234567890.us-gov-west-1.elb.amazonaws.com", ""},
+		// regions missing in the table are looked up with the describe APIs
+		{"my-elb-1234567890.xx-north-9.elb.amazonaws.com", ""},
+		{"lb.example.org", ""},
+		{"elb.amazonaws.com.example.org", ""},
+	} {
+		if zoneID := staticCanonicalZoneID(test.hostname); zoneID != test.zoneID {
+			t.Errorf("expected zone id %q for %s, got %q", test.zoneID, test.hostname, zoneID)
+		}
+	}
+}
+
+func TestIsAliasTarget(t *testing.T) {
+	for _, test := range []struct {
+		hostname string
+		alias    bool
+	}{
+		{"my-elb-1234567890.eu-central-1.elb.amazonaws.com", true},
+		{"my-elb-1234567890.xx-north-9.elb.amazonaws.com.", true},
+		{"my-nlb-1234567890abcdef.elb.us-gov-west-1.amazonaws.com", true},
+		{"d111111abcdef8.cloudfront.net", true},
+		{"bucket.s3-website-eu-west-1.amazonaws.com", true},
+		{"d-1234567890.execute-api.eu-central-1.amazonaws.com", true},
+		{"example.azureedge.net", false},
+		{"lb.example.org", false},
+	} {
+		if alias := IsAliasTarget(test.hostname); alias != test.alias {
+			t.Errorf("expected %v for %s, got %v", test.alias, test.hostname, alias)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/route53"
 )
 
@@ -28,10 +30,29 @@ func (l defaultLog) Infoln(args ...interface{}) {
 
 type Options struct {
 	Log Logger
+	// LoadBalancerCacheTTL is how long the canonical hosted zone ID of a
+	// load balancer is cached, 5 minutes by default
+	LoadBalancerCacheTTL time.Duration
 }
 
 type Client struct {
 	options Options
+
+	// the session and the service clients are created on first use and
+	// reused for all calls
+	mutex   sync.Mutex
+	route53 *route53.Route53
+	elb     *elb.ELB
+	elbv2   *elbv2.ELBV2
+
+	loadBalancers *loadBalancerCache
+}
+
+// HostedZone holds the properties of a Route53 hosted zone relevant to mate
+type HostedZone struct {
+	ID      string
+	Name    string
+	Private bool
 }
 
 var ErrInvalidAWSResponse = errors.New("invalid AWS response")
@@ -41,16 +62,47 @@ func New(o Options) *Client {
 	if o.Log == nil {
 		o.Log = defaultLog{}
 	}
+	if o.LoadBalancerCacheTTL <= 0 {
+		o.LoadBalancerCacheTTL = defaultLoadBalancerCacheTTL
+	}
 
-	return &Client{o}
+	c := &Client{options: o}
+	c.loadBalancers = newLoadBalancerCache(o.LoadBalancerCacheTTL, c.describeLoadBalancers)
+	return c
+}
+
+//initClients creates the session and the service clients unless done already, a failed attempt is retried on the
+//next call
+func (c *Client) initClients() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.route53 != nil {
+		return nil
+	}
+
+	session, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Logger: aws.LoggerFunc(c.options.Log.Infoln),
+			CredentialsChainVerboseErrors: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.elb = elb.New(session)
+	c.elbv2 = elbv2.New(session)
+	c.route53 = route53.New(session)
+	return nil
 }
 
 //ListRecordSets retrieve all records existing in the specified hosted zone
 func (c *Client) ListRecordSets(zoneID string) ([]*route53.ResourceRecordSet, error) {
 	records := make([]*route53.ResourceRecordSet, 0)
 
-	client, err := c.initRoute53Client()
-	if err != nil {
+	if err := c.initClients(); err != nil {
 		return nil, err
 	}
 
@@ -58,7 +110,7 @@ func (c *Client) ListRecordSets(zoneID string) ([]*route53.ResourceRecordSet, er
 		HostedZoneId: aws.String(zoneID),
 	}
 
-	err = client.ListResourceRecordSetsPages(params, func(resp *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+	err := c.route53.ListResourceRecordSetsPages(params, func(resp *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
 		log.Debugf("Getting a list of AWS RRS of length: %d", len(resp.ResourceRecordSets))
 		records = append(records, resp.ResourceRecordSets...)
 		return !lastPage
@@ -73,15 +125,15 @@ func (c *Client) ListRecordSets(zoneID string) ([]*route53.ResourceRecordSet, er
 
 //ChangeRecordSets creates and submits the record set change against the AWS API
 func (c *Client) ChangeRecordSets(upsert, del, create []*route53.ResourceRecordSet, zoneID string) error {
-	client, err := c.initRoute53Client()
-	if err != nil {
+	if err := c.initClients(); err != nil {
 		return err
 	}
 
+	//deletions come first, so that a record can be replaced by one of another type in the same batch
 	var changes []*route53.Change
+	changes = append(changes, createChangesList("DELETE", del)...)
 	changes = append(changes, createChangesList("CREATE", create)...)
 	changes = append(changes, createChangesList("UPSERT", upsert)...)
-	changes = append(changes, createChangesList("DELETE", del)...)
 	if len(changes) > 0 {
 		params := &route53.ChangeResourceRecordSetsInput{
 			ChangeBatch: &route53.ChangeBatch{
@@ -89,77 +141,94 @@ func (c *Client) ChangeRecordSets(upsert, del, create []*route53.ResourceRecordS
 			},
 			HostedZoneId: aws.String(zoneID),
 		}
-		_, err = client.ChangeResourceRecordSets(params)
+		_, err := c.route53.ChangeResourceRecordSets(params)
 		return err
 	}
 	return nil
 }
 
-// GetHostedZones returns the map hosted zone domain name -> zone id
-func (c *Client) GetHostedZones() (map[string]string, error) {
-	client, err := c.initRoute53Client()
-	if err != nil {
+// GetHostedZones returns all hosted zones of the account, following the pagination of the listing
+func (c *Client) GetHostedZones() ([]*HostedZone, error) {
+	if err := c.initClients(); err != nil {
 		return nil, err
 	}
 
-	output, err := client.ListHostedZones(nil)
+	hostedZones := make([]*HostedZone, 0)
+	err := c.route53.ListHostedZonesPages(&route53.ListHostedZonesInput{}, func(resp *route53.ListHostedZonesOutput, lastPage bool) bool {
+		for _, zone := range resp.HostedZones {
+			hostedZones = append(hostedZones, &HostedZone{
+				ID:      aws.StringValue(zone.Id),
+				Name:    aws.StringValue(zone.Name),
+				Private: zone.Config != nil && aws.BoolValue(zone.Config.PrivateZone),
+			})
+		}
+		return !lastPage
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	hostedZoneMap := map[string]string{}
-	for _, zone := range output.HostedZones {
-		hostedZoneMap[aws.StringValue(zone.Name)] = aws.StringValue(zone.Id)
-	}
-
-	return hostedZoneMap, nil
+	return hostedZones, nil
 }
 
-//GetCanonicalZoneIDs returns the map of LB (ALB + ELB classic) mapped to its CanonicalHostedZoneId
+//GetCanonicalZoneIDs returns the map of alias target hostnames to their canonical hosted zone ids. Hostnames of
+//ELBs, ALBs, NLBs, CloudFront, S3 websites and API Gateway are looked up in the built-in table, the other alias
+//targets are looked up with the describe APIs of ELB and ALB. Hostnames not found are missing from the map.
 func (c *Client) GetCanonicalZoneIDs(lbDNS []string) (map[string]string, error) {
-	var GetLoadBalancerFunc = []func(*session.Session) ([]*LoadBalancer, error){c.getALBs, c.getELBs}
+	zoneIDs := map[string]string{}
 
-	lbSession, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-		Config: aws.Config{
-			Logger: aws.LoggerFunc(c.options.Log.Infoln),
-			CredentialsChainVerboseErrors: aws.Bool(true),
-		},
-	})
-	if err != nil {
+	var unknown []string
+	for _, dns := range lbDNS {
+		if zoneID := staticCanonicalZoneID(dns); zoneID != "" {
+			zoneIDs[dns] = zoneID
+			continue
+		}
+		if IsAliasTarget(dns) {
+			unknown = append(unknown, dns)
+		}
+	}
+	if len(unknown) == 0 {
+		return zoneIDs, nil
+	}
+
+	if err := c.initClients(); err != nil {
 		return nil, err
 	}
+	for dns, zoneID := range c.loadBalancers.canonicalZoneIDs(unknown) {
+		zoneIDs[dns] = zoneID
+	}
+	return zoneIDs, nil
+}
+
+//describeLoadBalancers returns all ELBs and ALBs, the ones of a kind are skipped if describing them fails
+func (c *Client) describeLoadBalancers() ([]*LoadBalancer, error) {
+	var GetLoadBalancerFunc = []func() ([]*LoadBalancer, error){c.getALBs, c.getELBs}
 
 	loadBalancers := make([]*LoadBalancer, 0)
+	var errs []error
 
 	var addLBMutex sync.Mutex
 	var wg sync.WaitGroup
 
 	for _, getLBs := range GetLoadBalancerFunc {
 		wg.Add(1)
-		go func(getLBs func(*session.Session) ([]*LoadBalancer, error)) {
+		go func(getLBs func() ([]*LoadBalancer, error)) {
 			defer wg.Done()
-			lbs, err := getLBs(lbSession)
+			lbs, err := getLBs()
+			addLBMutex.Lock()
+			defer addLBMutex.Unlock()
 			if err != nil {
-				log.Errorf("Error getting LBs: %v. Skipping...", err)
+				errs = append(errs, err)
 				return
 			}
-			addLBMutex.Lock()
 			loadBalancers = append(loadBalancers, lbs...)
-			addLBMutex.Unlock()
 		}(getLBs)
 	}
 
 	wg.Wait()
 
-	loadBalancersMap := map[string]string{} //map LB Dns to its canonical hosted zone id
-
-	for _, dns := range lbDNS {
-		for _, loadBalancer := range loadBalancers {
-			if dns == loadBalancer.DNSName {
-				loadBalancersMap[dns] = loadBalancer.CanonicalZoneID
-			}
-		}
+	if len(errs) > 0 {
+		return loadBalancers, errs[0]
 	}
-	return loadBalancersMap, nil
+	return loadBalancers, nil
 }
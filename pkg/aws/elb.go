@@ -3,7 +3,6 @@ package aws
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/elbv2"
 )
@@ -14,14 +13,12 @@ type LoadBalancer struct {
 	CanonicalZoneID string
 }
 
-func (c *Client) getELBs(session *session.Session) ([]*LoadBalancer, error) {
+func (c *Client) getELBs() ([]*LoadBalancer, error) {
 	result := make([]*LoadBalancer, 0)
 
-	client := elb.New(session)
-
 	params := &elb.DescribeLoadBalancersInput{}
 
-	err := client.DescribeLoadBalancersPages(params, func(resp *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
+	err := c.elb.DescribeLoadBalancersPages(params, func(resp *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
 		loadBalancers := resp.LoadBalancerDescriptions
 		log.Debugf("Getting a page of ELBs of length: %d", len(resp.LoadBalancerDescriptions))
 		for _, loadbalancer := range loadBalancers {
@@ -40,14 +37,12 @@ func (c *Client) getELBs(session *session.Session) ([]*LoadBalancer, error) {
 	return result, nil
 }
 
-func (c *Client) getALBs(session *session.Session) ([]*LoadBalancer, error) {
+func (c *Client) getALBs() ([]*LoadBalancer, error) {
 	result := make([]*LoadBalancer, 0)
 
-	client := elbv2.New(session)
-
 	params := &elbv2.DescribeLoadBalancersInput{}
 
-	err := client.DescribeLoadBalancersPages(params, func(resp *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+	err := c.elbv2.DescribeLoadBalancersPages(params, func(resp *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
 		loadBalancers := resp.LoadBalancers
 		log.Debugf("Getting a page of ALBs of length: %d", len(resp.LoadBalancers))
 		for _, loadbalancer := range loadBalancers {
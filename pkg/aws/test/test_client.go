@@ -4,15 +4,24 @@ import (
 	"sync"
 
 	"github.com/aws/aws-sdk-go/service/route53"
+
+	awsclient "github.com/zalando-incubator/mate/pkg/aws"
 )
 
 type Client struct {
-	HostedZones    map[string]string
-	Current        map[string][]*route53.ResourceRecordSet
-	LastUpsert     map[string][]*route53.ResourceRecordSet
-	LastDelete     map[string][]*route53.ResourceRecordSet
-	LastCreate     map[string][]*route53.ResourceRecordSet
-	UpdateMapMutex sync.Mutex
+	HostedZones        map[string]string
+	PrivateHostedZones map[string]string
+	Current            map[string][]*route53.ResourceRecordSet
+	LastUpsert         map[string][]*route53.ResourceRecordSet
+	LastDelete         map[string][]*route53.ResourceRecordSet
+	LastCreate         map[string][]*route53.ResourceRecordSet
+	UpdateMapMutex     sync.Mutex
+
+	// CanonicalZoneIDs are the known alias targets, all hostnames are
+	// known if it is nil
+	CanonicalZoneIDs map[string]string
+	// LookedUp are the hostnames of all canonical hosted zone lookups
+	LookedUp []string
 }
 
 func NewClient(groupID string, initState map[string][]*route53.ResourceRecordSet, hostedZones map[string]string) *Client {
@@ -46,13 +55,25 @@ func (c *Client) ChangeRecordSets(upsert, del, create []*route53.ResourceRecordS
 
 func (c *Client) GetCanonicalZoneIDs(lbDNS []string) (map[string]string, error) {
 	loadBalancersMap := map[string]string{} //map LB Dns to its canonical hosted zone id
+	c.LookedUp = append(c.LookedUp, lbDNS...)
 
 	for _, dns := range lbDNS {
-		loadBalancersMap[dns] = "random-zone-id"
+		if c.CanonicalZoneIDs == nil {
+			loadBalancersMap[dns] = "random-zone-id"
+		} else if zoneID, exists := c.CanonicalZoneIDs[dns]; exists {
+			loadBalancersMap[dns] = zoneID
+		}
 	}
 	return loadBalancersMap, nil
 }
 
-func (c *Client) GetHostedZones() (map[string]string, error) {
-	return c.HostedZones, nil
+func (c *Client) GetHostedZones() ([]*awsclient.HostedZone, error) {
+	hostedZones := make([]*awsclient.HostedZone, 0, len(c.HostedZones)+len(c.PrivateHostedZones))
+	for name, id := range c.HostedZones {
+		hostedZones = append(hostedZones, &awsclient.HostedZone{ID: id, Name: name})
+	}
+	for name, id := range c.PrivateHostedZones {
+		hostedZones = append(hostedZones, &awsclient.HostedZone{ID: id, Name: name, Private: true})
+	}
+	return hostedZones, nil
 }
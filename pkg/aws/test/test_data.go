@@ -38,7 +38,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("test.foo.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("404.elb.com"),
+					DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
@@ -46,7 +46,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("update.foo.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("404.elb.com"),
+					DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
@@ -74,7 +74,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("test.example.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("404.elb.com"),
+					DNSName:      aws.String("404.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
@@ -91,7 +91,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("update.example.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("302.elb.com"),
+					DNSName:      aws.String("302.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
@@ -108,7 +108,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("another.example.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("200.elb.com"),
+					DNSName:      aws.String("200.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
@@ -143,7 +143,7 @@ func GetOriginalState(groupID string) map[string][]*route53.ResourceRecordSet {
 				Type: aws.String("A"),
 				Name: aws.String("withouttxt.example.com."),
 				AliasTarget: &route53.AliasTarget{
-					DNSName:      aws.String("random.elb.com"),
+					DNSName:      aws.String("random.eu-central-1.elb.amazonaws.com"),
 					HostedZoneId: aws.String("123"),
 				},
 			},
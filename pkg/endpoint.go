@@ -15,6 +15,19 @@ type Endpoint struct {
 	// record, in case the provider receives only a hostname for
 	// the service.
 	Hostname string
+
+	// Private restricts the record to private zones of the provider, e.g.
+	// for cluster internal IPs that must not leak into public DNS.
+	Private bool
+
+	// The TTL of the record in seconds. Consumers use their default TTL
+	// when it is not set.
+	TTL int64
+
+	// Proxied requests the provider to route the traffic for the record
+	// through its proxy, e.g. Cloudflare's CDN. Providers without such a
+	// feature ignore it.
+	Proxied bool
 }
 
 // SanitizeDNSName return the DNS with a trailing dot
@@ -0,0 +1,127 @@
+package google
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/dns/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ManagedZone is the part of a managed zone used by mate. Unlike the
+// vendored API it includes the visibility, which is empty for public zones
+// created before private zones existed.
+type ManagedZone struct {
+	Name       string `json:"name"`
+	DnsName    string `json:"dnsName"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// Client wraps the CloudDNS service with the calls used by mate, following
+// the pagination of all listings
+type Client struct {
+	service *dns.Service
+	client  *http.Client
+}
+
+// New returns a client for the CloudDNS API at the base path, using the
+// default one if it is empty
+func New(client *http.Client, basePath string) (*Client, error) {
+	service, err := dns.New(client)
+	if err != nil {
+		return nil, err
+	}
+	if basePath != "" {
+		service.BasePath = basePath
+	}
+	return &Client{service: service, client: client}, nil
+}
+
+// ListManagedZones returns all managed zones of the project. The request is
+// built like the vendored managedZones.list call, but decoded into
+// ManagedZone because the vendored response drops the visibility.
+func (c *Client) ListManagedZones(project string) ([]*ManagedZone, error) {
+	zones := make([]*ManagedZone, 0)
+	pageToken := ""
+	for {
+		var page struct {
+			ManagedZones  []*ManagedZone `json:"managedZones"`
+			NextPageToken string         `json:"nextPageToken"`
+		}
+		if err := c.listManagedZonesPage(project, pageToken, &page); err != nil {
+			return nil, err
+		}
+
+		zones = append(zones, page.ManagedZones...)
+		if page.NextPageToken == "" {
+			return zones, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (c *Client) listManagedZonesPage(project, pageToken string, v interface{}) error {
+	params := url.Values{"alt": {"json"}}
+	if pageToken != "" {
+		params.Set("pageToken", pageToken)
+	}
+	req, err := http.NewRequest("GET", googleapi.ResolveRelative(c.service.BasePath, "{project}/managedZones")+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	googleapi.Expand(req.URL, map[string]string{"project": project})
+	userAgent := googleapi.UserAgent
+	if c.service.UserAgent != "" {
+		userAgent += " " + c.service.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(resp)
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ListRecordSets returns all record sets of the managed zone
+func (c *Client) ListRecordSets(project, zone string) ([]*dns.ResourceRecordSet, error) {
+	records := make([]*dns.ResourceRecordSet, 0)
+	err := c.service.ResourceRecordSets.List(project, zone).Pages(context.Background(), func(resp *dns.ResourceRecordSetsListResponse) error {
+		records = append(records, resp.Rrsets...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ListRecordSetsByName returns the record sets of the name in the managed zone
+func (c *Client) ListRecordSetsByName(project, zone, name string) ([]*dns.ResourceRecordSet, error) {
+	records := make([]*dns.ResourceRecordSet, 0)
+	err := c.service.ResourceRecordSets.List(project, zone).Name(name).Pages(context.Background(), func(resp *dns.ResourceRecordSetsListResponse) error {
+		records = append(records, resp.Rrsets...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// CreateChange submits the change to the managed zone
+func (c *Client) CreateChange(project, zone string, change *dns.Change) (*dns.Change, error) {
+	return c.service.Changes.Create(project, zone, change).Do()
+}
+
+// GetChange returns the current state of the change
+func (c *Client) GetChange(project, zone, id string) (*dns.Change, error) {
+	return c.service.Changes.Get(project, zone, id).Do()
+}
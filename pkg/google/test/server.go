@@ -0,0 +1,374 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/dns/v1"
+)
+
+// Server is a fake of the CloudDNS API for dns.New with BasePath set to
+// BasePath(). It serves ManagedZones.List, ResourceRecordSets.List,
+// Changes.Create and Changes.Get, rejecting changes like CloudDNS does:
+// deletions must match the existing record set exactly, additions must not
+// exist yet and names must be inside the zone.
+type Server struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	projects map[string]map[string]*zone
+
+	// PageSize limits the number of items per page of a listing
+	PageSize int
+	// BeforeChange is called before a change is applied, e.g. to change the
+	// records concurrently
+	BeforeChange func(project, zone string, change *dns.Change)
+	// Changes holds the changes applied by their zone
+	Changes map[string][]*dns.Change
+	// PendingPolls is the number of times a new change is reported as
+	// pending before it is done, a negative number keeps it pending
+	PendingPolls int
+
+	changeID int
+	polls    map[string]int
+}
+
+type zone struct {
+	managedZone *managedZone
+	records     map[string]*dns.ResourceRecordSet
+}
+
+// managedZone adds the visibility missing in the vendored API
+type managedZone struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	DnsName    string `json:"dnsName"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// NewServer starts a fake without any zones
+func NewServer() *Server {
+	s := &Server{
+		projects: map[string]map[string]*zone{},
+		Changes:  map[string][]*dns.Change{},
+		polls:    map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// BasePath returns the base path to use for the service
+func (s *Server) BasePath() string {
+	return s.URL + "/projects/"
+}
+
+// AddZone creates the public managed zone with its SOA and NS records
+func (s *Server) AddZone(project, name, dnsName string) {
+	s.addZone(project, name, dnsName, "public")
+}
+
+// AddPrivateZone creates the private managed zone with its SOA and NS records
+func (s *Server) AddPrivateZone(project, name, dnsName string) {
+	s.addZone(project, name, dnsName, "private")
+}
+
+func (s *Server) addZone(project, name, dnsName, visibility string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.projects[project] == nil {
+		s.projects[project] = map[string]*zone{}
+	}
+	z := &zone{
+		managedZone: &managedZone{Kind: "dns#managedZone", Name: name, DnsName: dnsName, Visibility: visibility},
+		records:     map[string]*dns.ResourceRecordSet{},
+	}
+	z.add(&dns.ResourceRecordSet{Name: dnsName, Type: "SOA", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com. cloud-dns-hostmaster.google.com. 1 21600 3600 259200 300"}})
+	z.add(&dns.ResourceRecordSet{Name: dnsName, Type: "NS", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com."}})
+	s.projects[project][name] = z
+}
+
+// AddRecordSet puts the record set into the zone, replacing an existing one
+func (s *Server) AddRecordSet(project, zone string, record *dns.ResourceRecordSet) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.projects[project][zone].add(record)
+}
+
+// RecordSets returns the record sets of the zone except SOA and NS as
+// "name ttl type data..." sorted by name and type
+func (s *Server) RecordSets(project, zone string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := make([]string, 0)
+	for _, r := range s.projects[project][zone].sorted() {
+		if r.Type == "SOA" || r.Type == "NS" {
+			continue
+		}
+		records = append(records, strings.Join(append([]string{r.Name, strconv.FormatInt(r.Ttl, 10), r.Type}, r.Rrdatas...), " "))
+	}
+	return records
+}
+
+func (z *zone) add(record *dns.ResourceRecordSet) {
+	r := *record
+	r.Kind = "dns#resourceRecordSet"
+	r.Rrdatas = append([]string{}, record.Rrdatas...)
+	z.records[key(r.Name, r.Type)] = &r
+}
+
+func (z *zone) sorted() []*dns.ResourceRecordSet {
+	keys := make([]string, 0, len(z.records))
+	for k := range z.records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	records := make([]*dns.ResourceRecordSet, 0, len(keys))
+	for _, k := range keys {
+		records = append(records, z.records[k])
+	}
+	return records
+}
+
+func key(name, rrtype string) string {
+	return name + " " + rrtype
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// {project}/managedZones[/{zone}/(rrsets|changes)]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+
+	switch {
+	case len(parts) == 2 && parts[1] == "managedZones" && r.Method == "GET":
+		s.listZones(w, r, parts[0])
+	case len(parts) == 4 && parts[1] == "managedZones" && parts[3] == "rrsets" && r.Method == "GET":
+		s.listRecordSets(w, r, parts[0], parts[2])
+	case len(parts) == 4 && parts[1] == "managedZones" && parts[3] == "changes" && r.Method == "POST":
+		s.createChange(w, r, parts[0], parts[2])
+	case len(parts) == 5 && parts[1] == "managedZones" && parts[3] == "changes" && r.Method == "GET":
+		s.getChange(w, parts[0], parts[2], parts[4])
+	default:
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request, project string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	zones := s.projects[project]
+	if zones == nil {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The 'parameters.project' resource named '%s' does not exist.", project))
+		return
+	}
+
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	response := struct {
+		Kind          string         `json:"kind"`
+		ManagedZones  []*managedZone `json:"managedZones"`
+		NextPageToken string         `json:"nextPageToken,omitempty"`
+	}{Kind: "dns#managedZonesListResponse"}
+	start, end, next := s.page(r, len(names))
+	for _, name := range names[start:end] {
+		response.ManagedZones = append(response.ManagedZones, zones[name].managedZone)
+	}
+	response.NextPageToken = next
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) listRecordSets(w http.ResponseWriter, r *http.Request, project, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z := s.zone(w, project, name)
+	if z == nil {
+		return
+	}
+
+	// like CloudDNS the listing can be limited to a name and type
+	records := make([]*dns.ResourceRecordSet, 0)
+	name, rrtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+	for _, record := range z.sorted() {
+		if (name == "" || record.Name == name) && (rrtype == "" || record.Type == rrtype) {
+			records = append(records, record)
+		}
+	}
+
+	response := &dns.ResourceRecordSetsListResponse{Kind: "dns#resourceRecordSetsListResponse"}
+	start, end, next := s.page(r, len(records))
+	response.Rrsets = records[start:end]
+	response.NextPageToken = next
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) createChange(w http.ResponseWriter, r *http.Request, project, name string) {
+	change := &dns.Change{}
+	if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	if s.BeforeChange != nil {
+		s.BeforeChange(project, name, change)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z := s.zone(w, project, name)
+	if z == nil {
+		return
+	}
+
+	if len(change.Additions) == 0 && len(change.Deletions) == 0 {
+		writeError(w, http.StatusBadRequest, "required", "The 'entity.change' resource is missing additions or deletions.")
+		return
+	}
+
+	// the change is applied to a copy so that a rejected change leaves the
+	// zone untouched
+	records := make(map[string]*dns.ResourceRecordSet, len(z.records))
+	for k, r := range z.records {
+		records[k] = r
+	}
+
+	for i, del := range change.Deletions {
+		existing, exists := records[key(del.Name, del.Type)]
+		if !exists {
+			writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The 'entity.change.deletions[%d]' resource named '%s (%s)' does not exist.", i, del.Name, del.Type))
+			return
+		}
+		if existing.Ttl != del.Ttl || !sameData(existing.Rrdatas, del.Rrdatas) {
+			writeError(w, http.StatusPreconditionFailed, "conditionNotMet", fmt.Sprintf("Precondition not met for 'entity.change.deletions[%d]'", i))
+			return
+		}
+		delete(records, key(del.Name, del.Type))
+	}
+
+	for i, add := range change.Additions {
+		if add.Name != z.managedZone.DnsName && !strings.HasSuffix(add.Name, "."+z.managedZone.DnsName) {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for 'entity.change.additions[%d].name': '%s'", i, add.Name))
+			return
+		}
+		if len(add.Rrdatas) == 0 {
+			writeError(w, http.StatusBadRequest, "required", fmt.Sprintf("The 'entity.change.additions[%d].rrdata' is missing.", i))
+			return
+		}
+		if _, exists := records[key(add.Name, add.Type)]; exists {
+			writeError(w, http.StatusConflict, "alreadyExists", fmt.Sprintf("The resource 'entity.change.additions[%d]' named '%s (%s)' already exists", i, add.Name, add.Type))
+			return
+		}
+		for _, r := range records {
+			if r.Name == add.Name && (r.Type == "CNAME") != (add.Type == "CNAME") {
+				writeError(w, http.StatusBadRequest, "cnameResourceRecordSetConflict", fmt.Sprintf("The resource 'entity.change.additions[%d]' named '%s (%s)' conflicts with a CNAME", i, add.Name, add.Type))
+				return
+			}
+		}
+		records[key(add.Name, add.Type)] = add
+	}
+
+	z.records = map[string]*dns.ResourceRecordSet{}
+	for _, r := range records {
+		z.add(r)
+	}
+
+	s.changeID++
+	change.Kind = "dns#change"
+	change.Id = strconv.Itoa(s.changeID)
+	change.Status = s.status(change.Id)
+	s.Changes[name] = append(s.Changes[name], change)
+
+	json.NewEncoder(w).Encode(change)
+}
+
+func (s *Server) getChange(w http.ResponseWriter, project, name, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.zone(w, project, name) == nil {
+		return
+	}
+
+	for _, change := range s.Changes[name] {
+		if change.Id == id {
+			s.polls[id]++
+			c := *change
+			c.Status = s.status(id)
+			json.NewEncoder(w).Encode(&c)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The 'parameters.changeId' resource named '%s' does not exist.", id))
+}
+
+// status reports a change as pending until it was polled PendingPolls times
+func (s *Server) status(id string) string {
+	if s.PendingPolls < 0 || s.polls[id] < s.PendingPolls {
+		return "pending"
+	}
+	return "done"
+}
+
+func (s *Server) zone(w http.ResponseWriter, project, name string) *zone {
+	z := s.projects[project][name]
+	if z == nil {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The 'parameters.managedZone' resource named '%s' does not exist.", name))
+	}
+	return z
+}
+
+// page returns the range of items for the page token of the request and the
+// token of the next page
+func (s *Server) page(r *http.Request, total int) (int, int, string) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	if start > total {
+		start = total
+	}
+	if s.PageSize <= 0 || start+s.PageSize >= total {
+		return start, total, ""
+	}
+	return start, start + s.PageSize, strconv.Itoa(start + s.PageSize)
+}
+
+func sameData(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	a := append([]string{}, x...)
+	b := append([]string{}, y...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"errors":  []map[string]string{{"domain": "global", "reason": reason, "message": message}},
+			"code":    status,
+			"message": message,
+		},
+	})
+}
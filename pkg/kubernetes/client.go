@@ -4,23 +4,19 @@ import (
 	"net/url"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/pkg/api/unversioned"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/runtime/serializer"
 	"k8s.io/client-go/rest"
 )
 
 // NewClient configures a new Kubernetes client. If apiServerURL is nil the
 // client with be configured for in-cluster-use.
 func NewClient(apiServerURL *url.URL) (*kubernetes.Clientset, error) {
-	var config *rest.Config
-	if apiServerURL == nil {
-		var err error
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		config = &rest.Config{
-			Host: apiServerURL.String(),
-		}
+	config, err := newConfig(apiServerURL)
+	if err != nil {
+		return nil, err
 	}
 
 	client, err := kubernetes.NewForConfig(config)
@@ -30,3 +26,36 @@ func NewClient(apiServerURL *url.URL) (*kubernetes.Clientset, error) {
 
 	return client, nil
 }
+
+// NewRESTClient configures a new REST client for the API group and version,
+// e.g. for accessing third party resources. Requests and responses are JSON
+// encoded. If apiServerURL is nil the client with be configured for
+// in-cluster-use.
+func NewRESTClient(apiServerURL *url.URL, group, version string) (*rest.RESTClient, error) {
+	config, err := newConfig(apiServerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GroupVersion = &unversioned.GroupVersion{Group: group, Version: version}
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
+
+	client, err := rest.RESTClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func newConfig(apiServerURL *url.URL) (*rest.Config, error) {
+	if apiServerURL == nil {
+		return rest.InClusterConfig()
+	}
+
+	return &rest.Config{
+		Host: apiServerURL.String(),
+	}, nil
+}
@@ -0,0 +1,196 @@
+// Package plugin holds the gRPC protocol of consumer plugins described in
+// plugin.proto. The messages and stubs are kept by hand in the shape
+// protoc-gen-go would generate, so the vendored protobuf package encodes
+// them and plugins can be written in any language from plugin.proto.
+package plugin
+
+import (
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Endpoint is a DNS name pointing either to an IP or to a hostname
+type Endpoint struct {
+	DnsName  string `protobuf:"bytes,1,opt,name=dns_name,json=dnsName" json:"dns_name,omitempty"`
+	Ip       string `protobuf:"bytes,2,opt,name=ip" json:"ip,omitempty"`
+	Hostname string `protobuf:"bytes,3,opt,name=hostname" json:"hostname,omitempty"`
+	Ttl      int64  `protobuf:"varint,4,opt,name=ttl" json:"ttl,omitempty"`
+	Private  bool   `protobuf:"varint,5,opt,name=private" json:"private,omitempty"`
+	Proxied  bool   `protobuf:"varint,6,opt,name=proxied" json:"proxied,omitempty"`
+}
+
+func (m *Endpoint) Reset()         { *m = Endpoint{} }
+func (m *Endpoint) String() string { return proto.CompactTextString(m) }
+func (*Endpoint) ProtoMessage()    {}
+
+// Failure reports a record which could not be changed
+type Failure struct {
+	DnsName string `protobuf:"bytes,1,opt,name=dns_name,json=dnsName" json:"dns_name,omitempty"`
+	Error   string `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *Failure) Reset()         { *m = Failure{} }
+func (m *Failure) String() string { return proto.CompactTextString(m) }
+func (*Failure) ProtoMessage()    {}
+
+type ListRequest struct {
+	GroupId string `protobuf:"bytes,1,opt,name=group_id,json=groupId" json:"group_id,omitempty"`
+}
+
+func (m *ListRequest) Reset()         { *m = ListRequest{} }
+func (m *ListRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()    {}
+
+type ListResponse struct {
+	Endpoints []*Endpoint `protobuf:"bytes,1,rep,name=endpoints" json:"endpoints,omitempty"`
+}
+
+func (m *ListResponse) Reset()         { *m = ListResponse{} }
+func (m *ListResponse) String() string { return proto.CompactTextString(m) }
+func (*ListResponse) ProtoMessage()    {}
+
+type ApplyRequest struct {
+	GroupId string      `protobuf:"bytes,1,opt,name=group_id,json=groupId" json:"group_id,omitempty"`
+	Create  []*Endpoint `protobuf:"bytes,2,rep,name=create" json:"create,omitempty"`
+	Delete  []*Endpoint `protobuf:"bytes,3,rep,name=delete" json:"delete,omitempty"`
+}
+
+func (m *ApplyRequest) Reset()         { *m = ApplyRequest{} }
+func (m *ApplyRequest) String() string { return proto.CompactTextString(m) }
+func (*ApplyRequest) ProtoMessage()    {}
+
+type ApplyResponse struct {
+	Failures []*Failure `protobuf:"bytes,1,rep,name=failures" json:"failures,omitempty"`
+}
+
+func (m *ApplyResponse) Reset()         { *m = ApplyResponse{} }
+func (m *ApplyResponse) String() string { return proto.CompactTextString(m) }
+func (*ApplyResponse) ProtoMessage()    {}
+
+type ProcessRequest struct {
+	GroupId  string    `protobuf:"bytes,1,opt,name=group_id,json=groupId" json:"group_id,omitempty"`
+	Endpoint *Endpoint `protobuf:"bytes,2,opt,name=endpoint" json:"endpoint,omitempty"`
+}
+
+func (m *ProcessRequest) Reset()         { *m = ProcessRequest{} }
+func (m *ProcessRequest) String() string { return proto.CompactTextString(m) }
+func (*ProcessRequest) ProtoMessage()    {}
+
+type ProcessResponse struct {
+	Failures []*Failure `protobuf:"bytes,1,rep,name=failures" json:"failures,omitempty"`
+}
+
+func (m *ProcessResponse) Reset()         { *m = ProcessResponse{} }
+func (m *ProcessResponse) String() string { return proto.CompactTextString(m) }
+func (*ProcessResponse) ProtoMessage()    {}
+
+// ConsumerClient is the client API of the Consumer service
+type ConsumerClient interface {
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error)
+	Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error)
+}
+
+type consumerClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewConsumerClient returns a client of the Consumer service on the connection
+func NewConsumerClient(cc *grpc.ClientConn) ConsumerClient {
+	return &consumerClient{cc}
+}
+
+func (c *consumerClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	if err := grpc.Invoke(ctx, "/mate.plugin.Consumer/List", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consumerClient) Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error) {
+	out := new(ApplyResponse)
+	if err := grpc.Invoke(ctx, "/mate.plugin.Consumer/Apply", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consumerClient) Process(ctx context.Context, in *ProcessRequest, opts ...grpc.CallOption) (*ProcessResponse, error) {
+	out := new(ProcessResponse)
+	if err := grpc.Invoke(ctx, "/mate.plugin.Consumer/Process", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConsumerServer is the server API of the Consumer service implemented by
+// plugins
+type ConsumerServer interface {
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	Apply(context.Context, *ApplyRequest) (*ApplyResponse, error)
+	Process(context.Context, *ProcessRequest) (*ProcessResponse, error)
+}
+
+// RegisterConsumerServer registers the plugin with the gRPC server
+func RegisterConsumerServer(s *grpc.Server, srv ConsumerServer) {
+	s.RegisterService(&consumerServiceDesc, srv)
+}
+
+func listHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/mate.plugin.Consumer/List"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func applyHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerServer).Apply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/mate.plugin.Consumer/Apply"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerServer).Apply(ctx, req.(*ApplyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func processHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConsumerServer).Process(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/mate.plugin.Consumer/Process"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConsumerServer).Process(ctx, req.(*ProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var consumerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mate.plugin.Consumer",
+	HandlerType: (*ConsumerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "List", Handler: listHandler},
+		{MethodName: "Apply", Handler: applyHandler},
+		{MethodName: "Process", Handler: processHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin.proto",
+}
@@ -0,0 +1,138 @@
+package producers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	// FailOpen continues with the last known endpoints of a failing producer,
+	// it fails the whole list only for the first failures of a producer
+	// that never succeeded
+	FailOpen = "fail-open"
+	// FailClosed fails the whole list of endpoints if any producer fails
+	FailClosed = "fail-closed"
+)
+
+const defaultCompositeStartupFailures = 3
+
+type compositeProducer struct {
+	names         []string
+	producers     map[string]Producer
+	failurePolicy string
+
+	// lastKnown holds the last successfully retrieved endpoints per producer,
+	// startupFailures counts the failures of producers without any
+	lastKnown          map[string][]*pkg.Endpoint
+	startupFailures    map[string]int
+	maxStartupFailures int
+	sync.Mutex
+}
+
+type CompositeProducerOptions struct {
+	FailurePolicy      string
+	MaxStartupFailures int
+}
+
+// NewCompositeProducer creates a producer which merges the endpoints of
+// several producers. With the default fail-open policy a failing producer
+// doesn't block the endpoints of the others, its last known endpoints are used
+// instead. Without any, the whole list fails for the first max startup
+// failures so that the records of the producer aren't removed right away,
+// afterwards the others are used without it. With the fail-closed policy any
+// failure fails the whole list.
+func NewCompositeProducer(producers map[string]Producer, cfg *CompositeProducerOptions) (*compositeProducer, error) {
+	if len(producers) == 0 {
+		return nil, errors.New("[Composite] Please provide at least one producer")
+	}
+
+	if cfg.FailurePolicy == "" {
+		cfg.FailurePolicy = FailOpen
+	}
+	if cfg.FailurePolicy != FailOpen && cfg.FailurePolicy != FailClosed {
+		return nil, fmt.Errorf("[Composite] Unknown failure policy '%s'", cfg.FailurePolicy)
+	}
+
+	if cfg.MaxStartupFailures < 0 {
+		return nil, fmt.Errorf("[Composite] Invalid max startup failures %d, must not be negative", cfg.MaxStartupFailures)
+	}
+	if cfg.MaxStartupFailures == 0 {
+		cfg.MaxStartupFailures = defaultCompositeStartupFailures
+	}
+
+	names := make([]string, 0, len(producers))
+	for name := range producers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &compositeProducer{
+		names:              names,
+		producers:          producers,
+		failurePolicy:      cfg.FailurePolicy,
+		lastKnown:          make(map[string][]*pkg.Endpoint),
+		startupFailures:    make(map[string]int),
+		maxStartupFailures: cfg.MaxStartupFailures,
+	}, nil
+}
+
+func (a *compositeProducer) Endpoints() ([]*pkg.Endpoint, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	endpoints := make([]*pkg.Endpoint, 0)
+	seen := make(map[pkg.Endpoint]bool)
+
+	for _, name := range a.names {
+		eps, err := a.producers[name].Endpoints()
+		if err != nil {
+			if a.failurePolicy == FailClosed {
+				return nil, fmt.Errorf("[Composite] Error getting endpoints from producer %s: %v", name, err)
+			}
+
+			known, exists := a.lastKnown[name]
+			if !exists {
+				a.startupFailures[name]++
+				if a.startupFailures[name] <= a.maxStartupFailures {
+					return nil, fmt.Errorf("[Composite] Error getting endpoints from producer %s without last known endpoints (failure %d of %d): %v", name, a.startupFailures[name], a.maxStartupFailures, err)
+				}
+
+				log.Errorf("[Composite] Producer %s never returned endpoints, continuing without it: %v", name, err)
+			} else {
+				log.Errorf("[Composite] Error getting endpoints from producer %s, using its last known endpoints: %v", name, err)
+			}
+			eps = known
+		} else {
+			a.lastKnown[name] = eps
+		}
+
+		for _, ep := range eps {
+			if seen[*ep] {
+				continue
+			}
+			seen[*ep] = true
+
+			endpoints = append(endpoints, ep)
+		}
+	}
+
+	return endpoints, nil
+}
+
+func (a *compositeProducer) Monitor(results chan *pkg.Endpoint, errChan chan error, done chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	for _, name := range a.names {
+		go a.producers[name].Monitor(results, errChan, done, wg)
+	}
+
+	<-done
+	log.Info("[Composite] Exited monitoring loop.")
+}
@@ -0,0 +1,207 @@
+package producers
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+// stubProducer returns a fixed list of endpoints or error and emits its
+// endpoints when monitored.
+type stubProducer struct {
+	endpoints []*pkg.Endpoint
+	err       error
+}
+
+func (a *stubProducer) Endpoints() ([]*pkg.Endpoint, error) {
+	return a.endpoints, a.err
+}
+
+func (a *stubProducer) Monitor(results chan *pkg.Endpoint, errChan chan error, done chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	for _, ep := range a.endpoints {
+		select {
+		case results <- ep:
+		case <-done:
+			return
+		}
+	}
+
+	<-done
+}
+
+func TestCompositeDeduplicatesEndpoints(t *testing.T) {
+	producer, err := NewCompositeProducer(map[string]Producer{
+		"a": &stubProducer{endpoints: []*pkg.Endpoint{
+			{DNSName: "a.example.com.", IP: "10.0.0.1"},
+			{DNSName: "shared.example.com.", IP: "10.0.0.2"},
+		}},
+		"b": &stubProducer{endpoints: []*pkg.Endpoint{
+			{DNSName: "shared.example.com.", IP: "10.0.0.2"},
+			{DNSName: "b.example.com.", Hostname: "example.org"},
+		}},
+	}, &CompositeProducerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := producer.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pkg.Endpoint{
+		{DNSName: "a.example.com.", IP: "10.0.0.1"},
+		{DNSName: "shared.example.com.", IP: "10.0.0.2"},
+		{DNSName: "b.example.com.", Hostname: "example.org"},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Endpoints() => %v, want %v", endpoints, expected)
+	}
+}
+
+func TestCompositeFailurePolicy(t *testing.T) {
+	healthy := &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "healthy.example.com.", IP: "10.0.0.1"}}}
+	flaky := &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "flaky.example.com.", IP: "10.0.0.2"}}}
+
+	failClosed, err := NewCompositeProducer(map[string]Producer{"healthy": healthy, "flaky": flaky}, &CompositeProducerOptions{FailurePolicy: FailClosed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failOpen, err := NewCompositeProducer(map[string]Producer{"healthy": healthy, "flaky": flaky}, &CompositeProducerOptions{FailurePolicy: FailOpen})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// remember the endpoints of the flaky producer before it starts failing
+	if _, err := failOpen.Endpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky.err = errors.New("failure")
+
+	if _, err := failClosed.Endpoints(); err == nil {
+		t.Error("expected fail-closed producer to fail")
+	}
+
+	endpoints, err := failOpen.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pkg.Endpoint{
+		{DNSName: "flaky.example.com.", IP: "10.0.0.2"},
+		{DNSName: "healthy.example.com.", IP: "10.0.0.1"},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Endpoints() => %v, want %v", endpoints, expected)
+	}
+}
+
+func TestCompositeFirstCallFails(t *testing.T) {
+	healthy := &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "healthy.example.com.", IP: "10.0.0.1"}}}
+	flaky := &stubProducer{err: errors.New("failure")}
+
+	producer, err := NewCompositeProducer(map[string]Producer{"healthy": healthy, "flaky": flaky}, &CompositeProducerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without last known endpoints the records of the flaky producer would be removed
+	if _, err := producer.Endpoints(); err == nil {
+		t.Error("expected failure without last known endpoints")
+	}
+
+	// an empty list is a known state as well
+	flaky.err = nil
+	if _, err := producer.Endpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	flaky.err = errors.New("failure")
+	endpoints, err := producer.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pkg.Endpoint{{DNSName: "healthy.example.com.", IP: "10.0.0.1"}}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Endpoints() => %v, want %v", endpoints, expected)
+	}
+}
+
+func TestCompositeStartupFailures(t *testing.T) {
+	healthy := &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "healthy.example.com.", IP: "10.0.0.1"}}}
+	broken := &stubProducer{err: errors.New("the resource type isn't registered")}
+
+	producer, err := NewCompositeProducer(map[string]Producer{"healthy": healthy, "broken": broken}, &CompositeProducerOptions{MaxStartupFailures: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := producer.Endpoints(); err == nil {
+			t.Errorf("expected failure %d without last known endpoints", i+1)
+		}
+	}
+
+	// afterwards the broken producer doesn't block the others anymore
+	endpoints, err := producer.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pkg.Endpoint{{DNSName: "healthy.example.com.", IP: "10.0.0.1"}}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Endpoints() => %v, want %v", endpoints, expected)
+	}
+}
+
+func TestCompositeInvalidOptions(t *testing.T) {
+	if _, err := NewCompositeProducer(map[string]Producer{}, &CompositeProducerOptions{}); err == nil {
+		t.Error("expected error for missing producers")
+	}
+
+	if _, err := NewCompositeProducer(map[string]Producer{"a": &stubProducer{}}, &CompositeProducerOptions{FailurePolicy: "foo"}); err == nil {
+		t.Error("expected error for unknown failure policy")
+	}
+
+	if _, err := NewCompositeProducer(map[string]Producer{"a": &stubProducer{}}, &CompositeProducerOptions{MaxStartupFailures: -1}); err == nil {
+		t.Error("expected error for negative max startup failures")
+	}
+}
+
+func TestCompositeMonitorMergesStreams(t *testing.T) {
+	producer, err := NewCompositeProducer(map[string]Producer{
+		"a": &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "a.example.com.", IP: "10.0.0.1"}}},
+		"b": &stubProducer{endpoints: []*pkg.Endpoint{{DNSName: "b.example.com.", IP: "10.0.0.2"}}},
+	}, &CompositeProducerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan *pkg.Endpoint)
+	errChan := make(chan error)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go producer.Monitor(results, errChan, done, wg)
+
+	received := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		received[(<-results).DNSName] = true
+	}
+
+	if !received["a.example.com."] || !received["b.example.com."] {
+		t.Errorf("expected endpoints of both producers, got %v", received)
+	}
+
+	close(done)
+	wg.Wait()
+}
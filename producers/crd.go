@@ -0,0 +1,334 @@
+package producers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	api "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"github.com/zalando-incubator/mate/pkg"
+	"github.com/zalando-incubator/mate/pkg/kubernetes"
+)
+
+const (
+	dnsEndpointGroup    = "mate.zalando.org"
+	dnsEndpointVersion  = "v1"
+	dnsEndpointKind     = "DNSEndpoint"
+	dnsEndpointResource = "dnsendpoints"
+)
+
+// dnsEndpoint is a custom resource declaring a list of DNS records, e.g.
+//
+//	apiVersion: mate.zalando.org/v1
+//	kind: DNSEndpoint
+//	metadata:
+//	  name: saas
+//	spec:
+//	  endpoints:
+//	  - dnsName: saas.example.com
+//	    recordType: CNAME
+//	    targets: [example.saas-provider.com]
+//	    recordTTL: 60
+type dnsEndpoint struct {
+	Kind       string            `json:"kind,omitempty"`
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Metadata   api.ObjectMeta    `json:"metadata"`
+	Spec       dnsEndpointSpec   `json:"spec"`
+	Status     dnsEndpointStatus `json:"status"`
+}
+
+type dnsEndpointSpec struct {
+	Endpoints []dnsEndpointRecord `json:"endpoints"`
+}
+
+type dnsEndpointRecord struct {
+	DNSName    string   `json:"dnsName"`
+	Targets    []string `json:"targets"`
+	RecordType string   `json:"recordType"`
+	RecordTTL  int64    `json:"recordTTL,omitempty"`
+}
+
+// dnsEndpointStatus is written back to the resource to report which of the
+// declared records were accepted.
+type dnsEndpointStatus struct {
+	Accepted int      `json:"accepted"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type dnsEndpointList struct {
+	Items []dnsEndpoint `json:"items"`
+}
+
+type dnsEndpointEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object dnsEndpoint     `json:"object"`
+}
+
+type crdProducer struct {
+	client rest.Interface
+	filter map[string]string
+}
+
+// NewCRDProducer creates a producer that reads the records declared in
+// DNSEndpoint resources of all namespaces.
+func NewCRDProducer(cfg *KubernetesOptions) (*crdProducer, error) {
+	client, err := kubernetes.NewRESTClient(cfg.APIServer, dnsEndpointGroup, dnsEndpointVersion)
+	if err != nil {
+		return nil, fmt.Errorf("[CRD] Unable to setup Kubernetes API client: %v", err)
+	}
+
+	return &crdProducer{
+		client: client,
+		filter: cfg.Filter,
+	}, nil
+}
+
+func (a *crdProducer) Endpoints() ([]*pkg.Endpoint, error) {
+	body, err := a.client.Get().Resource(dnsEndpointResource).DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("[CRD] Unable to retrieve list of dns endpoints: %v", err)
+	}
+
+	var list dnsEndpointList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("[CRD] Unable to decode list of dns endpoints: %v", err)
+	}
+
+	endpoints := make([]*pkg.Endpoint, 0)
+
+	for _, obj := range list.Items {
+		if err := validateDNSEndpoint(obj, a.filter); err != nil {
+			log.Warnln(err)
+			continue
+		}
+
+		converted, _ := convertDNSEndpoint(obj)
+		endpoints = append(endpoints, converted...)
+	}
+
+	return endpoints, nil
+}
+
+func (a *crdProducer) Monitor(results chan *pkg.Endpoint, errChan chan error, done chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+loop:
+	for {
+		stream, events, err := a.watch(done)
+		if err != nil {
+			errChan <- fmt.Errorf("[CRD] Unable to watch list of dns endpoints: %v", err)
+
+			select {
+			case <-done:
+				log.Info("[CRD] Exited monitoring loop.")
+				return
+			case <-time.After(5 * time.Second):
+				goto loop
+			}
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					stream.Close()
+					goto loop
+				}
+
+				if event.Type == watch.Error {
+					errChan <- fmt.Errorf("[CRD] Event listener received an error: %v", event)
+					continue
+				}
+
+				if event.Type != watch.Added && event.Type != watch.Modified {
+					continue
+				}
+
+				obj := event.Object
+
+				log.Printf("%s: %s/%s", event.Type, obj.Metadata.Namespace, obj.Metadata.Name)
+
+				if err := validateDNSEndpoint(obj, a.filter); err != nil {
+					log.Warnln(err)
+					continue
+				}
+
+				converted, status := convertDNSEndpoint(obj)
+
+				if err := a.updateStatus(obj, status); err != nil {
+					log.Warnf("[CRD] Unable to update status of DNSEndpoint '%s/%s': %v", obj.Metadata.Namespace, obj.Metadata.Name, err)
+				}
+
+				for _, ep := range converted {
+					results <- ep
+				}
+			case <-done:
+				stream.Close()
+				log.Info("[CRD] Exited monitoring loop.")
+				return
+			}
+		}
+	}
+}
+
+// watch opens a watch on all dns endpoints and decodes the streamed events
+// until the stream ends or done is closed.
+func (a *crdProducer) watch(done chan struct{}) (io.ReadCloser, <-chan dnsEndpointEvent, error) {
+	stream, err := a.client.Get().Resource(dnsEndpointResource).Param("watch", "true").Stream()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan dnsEndpointEvent)
+
+	go func() {
+		defer close(events)
+
+		decoder := json.NewDecoder(stream)
+		for {
+			var event dnsEndpointEvent
+			if err := decoder.Decode(&event); err != nil {
+				if err != io.EOF {
+					log.Debugf("[CRD] Watch stream ended: %v", err)
+				}
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return stream, events, nil
+}
+
+func validateDNSEndpoint(obj dnsEndpoint, filter map[string]string) error {
+	for key := range filter {
+		if obj.Metadata.Annotations[key] != filter[key] {
+			return fmt.Errorf(
+				"[CRD] DNSEndpoint '%s/%s' doesn't match filter for annotation %s: %s != %s",
+				obj.Metadata.Namespace, obj.Metadata.Name, key, filter[key], obj.Metadata.Annotations[key],
+			)
+		}
+	}
+
+	if len(obj.Spec.Endpoints) == 0 {
+		return fmt.Errorf(
+			"[CRD] DNSEndpoint '%s/%s' doesn't declare any endpoints",
+			obj.Metadata.Namespace, obj.Metadata.Name,
+		)
+	}
+
+	return nil
+}
+
+// validateDNSEndpointRecord checks that a single declared record can be
+// represented as A or CNAME records.
+func validateDNSEndpointRecord(record dnsEndpointRecord) error {
+	if record.DNSName == "" {
+		return errors.New("record without dnsName")
+	}
+
+	if len(record.Targets) == 0 {
+		return fmt.Errorf("record %s has no targets", record.DNSName)
+	}
+
+	if record.RecordTTL < 0 {
+		return fmt.Errorf("record %s has a negative TTL: %d", record.DNSName, record.RecordTTL)
+	}
+
+	switch record.RecordType {
+	case "A":
+		for _, target := range record.Targets {
+			if ip := net.ParseIP(target); ip == nil || ip.To4() == nil {
+				return fmt.Errorf("record %s has an invalid IPv4 target: %s", record.DNSName, target)
+			}
+		}
+	case "CNAME":
+		if len(record.Targets) > 1 {
+			return fmt.Errorf("record %s of type CNAME has more than one target", record.DNSName)
+		}
+	default:
+		return fmt.Errorf("record %s has an unsupported type: %q", record.DNSName, record.RecordType)
+	}
+
+	return nil
+}
+
+// convertDNSEndpoint returns an endpoint for each target of the valid
+// records and the status reporting the invalid ones. The status is only
+// written back by Monitor so that periodic syncs don't update every resource.
+func convertDNSEndpoint(obj dnsEndpoint) ([]*pkg.Endpoint, dnsEndpointStatus) {
+	endpoints := make([]*pkg.Endpoint, 0, len(obj.Spec.Endpoints))
+
+	status := dnsEndpointStatus{}
+
+	for _, record := range obj.Spec.Endpoints {
+		if err := validateDNSEndpointRecord(record); err != nil {
+			log.Warnf("[CRD] DNSEndpoint '%s/%s': %v", obj.Metadata.Namespace, obj.Metadata.Name, err)
+			status.Errors = append(status.Errors, err.Error())
+			continue
+		}
+
+		status.Accepted++
+
+		for _, target := range record.Targets {
+			ep := &pkg.Endpoint{
+				DNSName: pkg.SanitizeDNSName(record.DNSName),
+				TTL:     record.RecordTTL,
+				Proxied: proxied(obj.Metadata.Annotations),
+			}
+
+			switch record.RecordType {
+			case "A":
+				ep.IP = target
+			case "CNAME":
+				ep.Hostname = target
+			}
+
+			endpoints = append(endpoints, ep)
+		}
+	}
+
+	return endpoints, status
+}
+
+// updateStatus writes the status back to the resource unless it is already
+// up to date, which also prevents an endless loop of modified events.
+func (a *crdProducer) updateStatus(obj dnsEndpoint, status dnsEndpointStatus) error {
+	if reflect.DeepEqual(obj.Status, status) {
+		return nil
+	}
+
+	obj.Kind = dnsEndpointKind
+	obj.APIVersion = dnsEndpointGroup + "/" + dnsEndpointVersion
+	obj.Status = status
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.Put().
+		Namespace(obj.Metadata.Namespace).
+		Resource(dnsEndpointResource).
+		Name(obj.Metadata.Name).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		DoRaw()
+
+	return err
+}
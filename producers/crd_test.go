@@ -0,0 +1,222 @@
+package producers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	api "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+func TestValidateDNSEndpointRecord(t *testing.T) {
+	for _, test := range []struct {
+		record dnsEndpointRecord
+		isErr  bool
+	}{
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"8.8.8.8", "8.8.4.4"}}, false},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "CNAME", Targets: []string{"example.org"}, RecordTTL: 60}, false},
+		{dnsEndpointRecord{RecordType: "A", Targets: []string{"8.8.8.8"}}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "A"}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"example.org"}}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"::1"}}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "CNAME", Targets: []string{"a.org", "b.org"}}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "MX", Targets: []string{"example.org"}}, true},
+		{dnsEndpointRecord{DNSName: "foo.example.com", RecordType: "A", Targets: []string{"8.8.8.8"}, RecordTTL: -1}, true},
+	} {
+		err := validateDNSEndpointRecord(test.record)
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("validateDNSEndpointRecord(%v) => %q, want %t", test.record, err, test.isErr)
+		}
+	}
+}
+
+func TestValidateDNSEndpoint(t *testing.T) {
+	records := dnsEndpointSpec{Endpoints: []dnsEndpointRecord{{DNSName: "foo.example.com"}}}
+
+	for _, test := range []struct {
+		obj    dnsEndpoint
+		filter map[string]string
+		isErr  bool
+	}{
+		{dnsEndpoint{Spec: records}, map[string]string{}, false},
+		{dnsEndpoint{}, map[string]string{}, true},
+		{dnsEndpoint{Spec: records}, map[string]string{"foo": "bar"}, true},
+		{dnsEndpoint{Metadata: api.ObjectMeta{Annotations: map[string]string{"foo": "bar"}}, Spec: records}, map[string]string{"foo": "bar"}, false},
+	} {
+		err := validateDNSEndpoint(test.obj, test.filter)
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("validateDNSEndpoint(%v, %q) => %q, want %t", test.obj, test.filter, err, test.isErr)
+		}
+	}
+}
+
+// fakeDNSEndpointAPI serves the dns endpoints resources of a Kubernetes API
+// server and records the status updates it receives.
+type fakeDNSEndpointAPI struct {
+	sync.Mutex
+	items   []dnsEndpoint
+	updates map[string]dnsEndpointStatus
+}
+
+func (f *fakeDNSEndpointAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/apis/mate.zalando.org/v1/dnsendpoints" && r.URL.Query().Get("watch") == "true":
+		encoder := json.NewEncoder(w)
+		for _, item := range f.items {
+			encoder.Encode(dnsEndpointEvent{Type: "ADDED", Object: item})
+		}
+	case r.Method == "GET" && r.URL.Path == "/apis/mate.zalando.org/v1/dnsendpoints":
+		json.NewEncoder(w).Encode(dnsEndpointList{Items: f.items})
+	case r.Method == "PUT":
+		var obj dnsEndpoint
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.updates[r.URL.Path] = obj.Status
+		json.NewEncoder(w).Encode(obj)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeCRDProducer(t *testing.T, items []dnsEndpoint) (*crdProducer, *fakeDNSEndpointAPI, func()) {
+	fake := &fakeDNSEndpointAPI{items: items, updates: map[string]dnsEndpointStatus{}}
+	server := httptest.NewServer(fake)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	producer, err := NewCRDProducer(&KubernetesOptions{APIServer: serverURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return producer, fake, server.Close
+}
+
+func TestCRDEndpoints(t *testing.T) {
+	items := []dnsEndpoint{
+		{
+			Metadata: api.ObjectMeta{Namespace: "default", Name: "saas"},
+			Spec: dnsEndpointSpec{Endpoints: []dnsEndpointRecord{
+				{DNSName: "saas.example.com", RecordType: "CNAME", Targets: []string{"example.saas.org"}, RecordTTL: 60},
+				{DNSName: "vip.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2"}},
+				{DNSName: "broken.example.com", RecordType: "A", Targets: []string{"example.org"}},
+			}},
+		},
+		{
+			Metadata: api.ObjectMeta{Namespace: "default", Name: "uptodate"},
+			Spec: dnsEndpointSpec{Endpoints: []dnsEndpointRecord{
+				{DNSName: "other.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+			}},
+			Status: dnsEndpointStatus{Accepted: 1},
+		},
+		{
+			Metadata: api.ObjectMeta{Namespace: "default", Name: "empty"},
+		},
+	}
+
+	producer, fake, stop := newFakeCRDProducer(t, items)
+	defer stop()
+
+	endpoints, err := producer.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pkg.Endpoint{
+		{DNSName: "saas.example.com.", Hostname: "example.saas.org", TTL: 60},
+		{DNSName: "vip.example.com.", IP: "10.0.0.1"},
+		{DNSName: "vip.example.com.", IP: "10.0.0.2"},
+		{DNSName: "other.example.com.", IP: "10.0.0.3"},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Endpoints() => %v, want %v", endpoints, expected)
+	}
+
+	if len(fake.updates) != 0 {
+		t.Errorf("expected no status updates, got %v", fake.updates)
+	}
+}
+
+func TestCRDMonitor(t *testing.T) {
+	items := []dnsEndpoint{
+		{
+			Metadata: api.ObjectMeta{Namespace: "default", Name: "vip"},
+			Spec: dnsEndpointSpec{Endpoints: []dnsEndpointRecord{
+				{DNSName: "vip.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+				{DNSName: "broken.example.com", RecordType: "A", Targets: []string{"example.org"}},
+			}},
+		},
+		{
+			Metadata: api.ObjectMeta{Namespace: "default", Name: "uptodate"},
+			Spec: dnsEndpointSpec{Endpoints: []dnsEndpointRecord{
+				{DNSName: "other.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+			}},
+			Status: dnsEndpointStatus{Accepted: 1},
+		},
+	}
+
+	producer, fake, stop := newFakeCRDProducer(t, items)
+	defer stop()
+
+	results := make(chan *pkg.Endpoint)
+	errChan := make(chan error)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go producer.Monitor(results, errChan, done, wg)
+
+	select {
+	case ep := <-results:
+		expected := &pkg.Endpoint{DNSName: "vip.example.com.", IP: "10.0.0.1"}
+		if !reflect.DeepEqual(ep, expected) {
+			t.Errorf("Monitor() => %v, want %v", ep, expected)
+		}
+	case err := <-errChan:
+		t.Fatal(err)
+	}
+
+	select {
+	case ep := <-results:
+		expected := &pkg.Endpoint{DNSName: "other.example.com.", IP: "10.0.0.3"}
+		if !reflect.DeepEqual(ep, expected) {
+			t.Errorf("Monitor() => %v, want %v", ep, expected)
+		}
+	case err := <-errChan:
+		t.Fatal(err)
+	}
+
+	fake.Lock()
+	if len(fake.updates) != 1 {
+		t.Errorf("expected a single status update, got %v", fake.updates)
+	}
+
+	status := fake.updates["/apis/mate.zalando.org/v1/namespaces/default/dnsendpoints/vip"]
+	if status.Accepted != 1 || len(status.Errors) != 1 {
+		t.Errorf("unexpected status: %v", status)
+	}
+	fake.Unlock()
+
+	close(done)
+
+	// drain any endpoint emitted before the producer noticed done
+	go func() {
+		for range results {
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,173 @@
+package producers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+const (
+	defaultFilePollInterval = 5 * time.Second
+)
+
+// fileEndpoints is the content of the endpoints file, e.g.
+//
+//	endpoints:
+//	- dnsName: static.example.com
+//	  ip: 10.0.0.1
+//	- dnsName: cdn.example.com
+//	  hostname: example.cdn-provider.com
+//	  ttl: 60
+//
+// Being YAML the file can be written in JSON as well.
+type fileEndpoints struct {
+	Endpoints []fileEndpoint `json:"endpoints"`
+}
+
+type fileEndpoint struct {
+	DNSName  string `json:"dnsName"`
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	TTL      int64  `json:"ttl,omitempty"`
+}
+
+type fileProducer struct {
+	path         string
+	pollInterval time.Duration
+}
+
+type FileProducerOptions struct {
+	Path         string
+	PollInterval time.Duration
+}
+
+func NewFileProducer(cfg *FileProducerOptions) (*fileProducer, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("Please provide --file-path")
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = defaultFilePollInterval
+	}
+
+	return &fileProducer{
+		path:         cfg.Path,
+		pollInterval: cfg.PollInterval,
+	}, nil
+}
+
+func (a *fileProducer) Endpoints() ([]*pkg.Endpoint, error) {
+	return a.readEndpoints()
+}
+
+func (a *fileProducer) Monitor(results chan *pkg.Endpoint, errChan chan error, done chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	// the current endpoints are taken care of by the synchronization, only
+	// report the ones added or changed from now on
+	known, err := a.readEndpoints()
+	if err != nil {
+		errChan <- err
+	}
+
+	for {
+		select {
+		case <-time.After(a.pollInterval):
+		case <-done:
+			log.Info("[File] Exited monitoring loop.")
+			return
+		}
+
+		endpoints, err := a.readEndpoints()
+		if err != nil {
+			// keep the last known endpoints, a broken file must not
+			// lead to any records being touched
+			errChan <- err
+			continue
+		}
+
+		for _, ep := range changedEndpoints(known, endpoints) {
+			results <- ep
+		}
+
+		known = endpoints
+	}
+}
+
+func (a *fileProducer) readEndpoints() ([]*pkg.Endpoint, error) {
+	data, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("[File] Unable to read endpoints file: %v", err)
+	}
+
+	return parseEndpoints(data)
+}
+
+// parseEndpoints parses the YAML or JSON encoded endpoints. Any invalid entry
+// renders the whole content invalid to avoid partial updates.
+func parseEndpoints(data []byte) ([]*pkg.Endpoint, error) {
+	var content fileEndpoints
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("[File] Unable to parse endpoints file: %v", err)
+	}
+
+	endpoints := make([]*pkg.Endpoint, 0, len(content.Endpoints))
+
+	for i, e := range content.Endpoints {
+		if err := validateFileEndpoint(e); err != nil {
+			return nil, fmt.Errorf("[File] Invalid endpoint #%d in endpoints file: %v", i+1, err)
+		}
+
+		endpoints = append(endpoints, &pkg.Endpoint{
+			DNSName:  pkg.SanitizeDNSName(e.DNSName),
+			IP:       e.IP,
+			Hostname: e.Hostname,
+			TTL:      e.TTL,
+		})
+	}
+
+	return endpoints, nil
+}
+
+func validateFileEndpoint(e fileEndpoint) error {
+	switch {
+	case e.DNSName == "":
+		return errors.New("missing dnsName")
+	case e.IP == "" && e.Hostname == "":
+		return fmt.Errorf("%s has neither ip nor hostname", e.DNSName)
+	case e.IP != "" && e.Hostname != "":
+		return fmt.Errorf("%s has both ip and hostname", e.DNSName)
+	case e.IP != "" && net.ParseIP(e.IP) == nil:
+		return fmt.Errorf("%s has an invalid ip: %s", e.DNSName, e.IP)
+	case e.TTL < 0:
+		return fmt.Errorf("%s has a negative ttl: %d", e.DNSName, e.TTL)
+	}
+
+	return nil
+}
+
+// changedEndpoints returns the endpoints which were added or changed
+// compared to the known ones.
+func changedEndpoints(known, endpoints []*pkg.Endpoint) []*pkg.Endpoint {
+	knownEndpoints := make(map[pkg.Endpoint]bool, len(known))
+	for _, ep := range known {
+		knownEndpoints[*ep] = true
+	}
+
+	changed := make([]*pkg.Endpoint, 0)
+	for _, ep := range endpoints {
+		if !knownEndpoints[*ep] {
+			changed = append(changed, ep)
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,150 @@
+package producers
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/mate/pkg"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	expected := []*pkg.Endpoint{
+		{DNSName: "static.example.com.", IP: "10.0.0.1"},
+		{DNSName: "cdn.example.com.", Hostname: "example.cdn.org", TTL: 60},
+	}
+
+	for _, test := range []struct {
+		data     string
+		expected []*pkg.Endpoint
+		isErr    bool
+	}{
+		{`
+endpoints:
+- dnsName: static.example.com
+  ip: 10.0.0.1
+- dnsName: cdn.example.com.
+  hostname: example.cdn.org
+  ttl: 60
+`, expected, false},
+		{`{"endpoints": [
+  {"dnsName": "static.example.com", "ip": "10.0.0.1"},
+  {"dnsName": "cdn.example.com.", "hostname": "example.cdn.org", "ttl": 60}
+]}`, expected, false},
+		{``, []*pkg.Endpoint{}, false},
+		{`endpoints: [`, nil, true},
+		{`endpoints: [{ip: 10.0.0.1}]`, nil, true},
+		{`endpoints: [{dnsName: foo.example.com}]`, nil, true},
+		{`endpoints: [{dnsName: foo.example.com, ip: 10.0.0.1, hostname: example.org}]`, nil, true},
+		{`endpoints: [{dnsName: foo.example.com, ip: example.org}]`, nil, true},
+		{`endpoints: [{dnsName: foo.example.com, ip: 10.0.0.1, ttl: -1}]`, nil, true},
+	} {
+		endpoints, err := parseEndpoints([]byte(test.data))
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("parseEndpoints(%q) => %q, want %t", test.data, err, test.isErr)
+		}
+		if !reflect.DeepEqual(endpoints, test.expected) {
+			t.Errorf("parseEndpoints(%q) => %v, want %v", test.data, endpoints, test.expected)
+		}
+	}
+}
+
+func TestChangedEndpoints(t *testing.T) {
+	known := []*pkg.Endpoint{
+		{DNSName: "same.example.com.", IP: "10.0.0.1"},
+		{DNSName: "changed.example.com.", IP: "10.0.0.2"},
+		{DNSName: "removed.example.com.", IP: "10.0.0.3"},
+	}
+
+	endpoints := []*pkg.Endpoint{
+		{DNSName: "same.example.com.", IP: "10.0.0.1"},
+		{DNSName: "changed.example.com.", IP: "10.0.0.4"},
+		{DNSName: "added.example.com.", Hostname: "example.org"},
+	}
+
+	expected := []*pkg.Endpoint{
+		{DNSName: "changed.example.com.", IP: "10.0.0.4"},
+		{DNSName: "added.example.com.", Hostname: "example.org"},
+	}
+
+	if changed := changedEndpoints(known, endpoints); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("changedEndpoints() => %v, want %v", changed, expected)
+	}
+}
+
+func TestFileMonitor(t *testing.T) {
+	file, err := ioutil.TempFile("", "mate-endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	// replace the file atomically so that no partially written content is read
+	write := func(data string) {
+		if err := ioutil.WriteFile(file.Name()+".tmp", []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(file.Name()+".tmp", file.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`endpoints: [{dnsName: static.example.com, ip: 10.0.0.1}]`)
+
+	producer, err := NewFileProducer(&FileProducerOptions{
+		Path:         file.Name(),
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := producer.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].IP != "10.0.0.1" {
+		t.Errorf("unexpected endpoints: %v", endpoints)
+	}
+
+	results := make(chan *pkg.Endpoint)
+	errChan := make(chan error)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	go producer.Monitor(results, errChan, done, wg)
+
+	// give the producer a chance to read the initial endpoints
+	time.Sleep(50 * time.Millisecond)
+
+	write(`endpoints: [`)
+
+	select {
+	case <-errChan:
+	case ep := <-results:
+		t.Fatalf("unexpected endpoint: %v", ep)
+	}
+
+	write(`endpoints: [{dnsName: static.example.com, ip: 10.0.0.1}, {dnsName: new.example.com, ip: 10.0.0.2}]`)
+
+	for {
+		select {
+		case err := <-errChan:
+			// the broken content may be read a couple of times
+			t.Log(err)
+			continue
+		case ep := <-results:
+			expected := &pkg.Endpoint{DNSName: "new.example.com.", IP: "10.0.0.2"}
+			if !reflect.DeepEqual(ep, expected) {
+				t.Errorf("Monitor() => %v, want %v", ep, expected)
+			}
+		}
+		break
+	}
+
+	close(done)
+	wg.Wait()
+}
@@ -157,7 +157,9 @@ func (a *kubernetesIngressProducer) convertIngressToEndpoint(ing extensions.Ingr
 	endpoints := make([]*pkg.Endpoint, 0, len(ing.Spec.Rules))
 
 	for _, rule := range ing.Spec.Rules {
-		ep := &pkg.Endpoint{}
+		ep := &pkg.Endpoint{
+			Proxied: proxied(ing.Annotations),
+		}
 
 		for _, i := range ing.Status.LoadBalancer.Ingress {
 			ep.IP = i.IP
@@ -12,20 +12,27 @@ import (
 )
 
 const (
-	annotationKey = "zalando.org/dnsname"
+	annotationKey          = "zalando.org/dnsname"
+	clusterIPAnnotationKey = "zalando.org/publish-cluster-ip"
+	proxiedAnnotationKey   = "zalando.org/cloudflare-proxied"
 )
 
 type kubernetesProducer struct {
-	ingress   Producer
-	service   Producer
-	nodePorts Producer
+	ingress      Producer
+	service      Producer
+	nodePorts    Producer
+	dnsEndpoints Producer
 }
 
 type KubernetesOptions struct {
-	APIServer      *url.URL
-	Format         string
-	TrackNodePorts bool
-	Filter         map[string]string
+	APIServer         *url.URL
+	Format            string
+	TrackNodePorts    bool
+	TrackExternalName bool
+	TrackExternalIPs  bool
+	TrackClusterIP    bool
+	TrackDNSEndpoints bool
+	Filter            map[string]string
 }
 
 func NewKubernetesProducer(cfg *KubernetesOptions) (*kubernetesProducer, error) {
@@ -60,6 +67,15 @@ func NewKubernetesProducer(cfg *KubernetesOptions) (*kubernetesProducer, error)
 		return nil, fmt.Errorf("[Kubernetes] Error creating producer: %v", err)
 	}
 
+	if cfg.TrackDNSEndpoints {
+		producer.dnsEndpoints, err = NewCRDProducer(cfg)
+	} else {
+		producer.dnsEndpoints, err = NewNullProducer()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[Kubernetes] Error creating producer: %v", err)
+	}
+
 	return producer, nil
 }
 
@@ -79,8 +95,14 @@ func (a *kubernetesProducer) Endpoints() ([]*pkg.Endpoint, error) {
 		return nil, fmt.Errorf("[Kubernetes] Error getting endpoints from producer: %v", err)
 	}
 
+	dnsEndpointsEndpoints, err := a.dnsEndpoints.Endpoints()
+	if err != nil {
+		return nil, fmt.Errorf("[Kubernetes] Error getting endpoints from producer: %v", err)
+	}
+
 	ingressEndpoints = append(ingressEndpoints, serviceEndpoints...)
-	return append(ingressEndpoints, nodePortsEndpoints...), nil
+	ingressEndpoints = append(ingressEndpoints, nodePortsEndpoints...)
+	return append(ingressEndpoints, dnsEndpointsEndpoints...), nil
 }
 
 func (a *kubernetesProducer) Monitor(results chan *pkg.Endpoint, errChan chan error, done chan struct{}, wg *sync.WaitGroup) {
@@ -90,7 +112,14 @@ func (a *kubernetesProducer) Monitor(results chan *pkg.Endpoint, errChan chan er
 	go a.ingress.Monitor(results, errChan, done, wg)
 	go a.service.Monitor(results, errChan, done, wg)
 	go a.nodePorts.Monitor(results, errChan, done, wg)
+	go a.dnsEndpoints.Monitor(results, errChan, done, wg)
 
 	<-done
 	log.Info("[Kubernetes] Exited monitoring loop.")
 }
+
+// proxied returns whether the annotations request the records to be proxied
+// by the DNS provider.
+func proxied(annotations map[string]string) bool {
+	return annotations[proxiedAnnotationKey] == "true"
+}
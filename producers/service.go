@@ -18,9 +18,12 @@ import (
 )
 
 type kubernetesServiceProducer struct {
-	client *k8s.Clientset
-	tmpl   *template.Template
-	filter map[string]string
+	client            *k8s.Clientset
+	tmpl              *template.Template
+	filter            map[string]string
+	trackExternalName bool
+	trackExternalIPs  bool
+	trackClusterIP    bool
 }
 
 func NewKubernetesService(cfg *KubernetesOptions) (*kubernetesServiceProducer, error) {
@@ -37,9 +40,12 @@ func NewKubernetesService(cfg *KubernetesOptions) (*kubernetesServiceProducer, e
 	}
 
 	return &kubernetesServiceProducer{
-		client: client,
-		tmpl:   tmpl,
-		filter: cfg.Filter,
+		client:            client,
+		tmpl:              tmpl,
+		filter:            cfg.Filter,
+		trackExternalName: cfg.TrackExternalName,
+		trackExternalIPs:  cfg.TrackExternalIPs,
+		trackClusterIP:    cfg.TrackClusterIP,
 	}, nil
 }
 
@@ -52,18 +58,18 @@ func (a *kubernetesServiceProducer) Endpoints() ([]*pkg.Endpoint, error) {
 	endpoints := make([]*pkg.Endpoint, 0)
 
 	for _, svc := range allServices.Items {
-		if err := validateService(svc, a.filter); err != nil {
+		if err := a.validate(svc); err != nil {
 			log.Warnln(err)
 			continue
 		}
 
-		ep, err := a.convertServiceToEndpoint(svc)
+		eps, err := a.convertServiceToEndpoints(svc)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 
-		endpoints = append(endpoints, ep)
+		endpoints = append(endpoints, eps...)
 	}
 
 	return endpoints, nil
@@ -114,18 +120,20 @@ loop:
 
 				log.Printf("%s: %s/%s", event.Type, svc.Namespace, svc.Name)
 
-				if err := validateService(*svc, a.filter); err != nil {
+				if err := a.validate(*svc); err != nil {
 					log.Warnln(err)
 					continue
 				}
 
-				ep, err := a.convertServiceToEndpoint(*svc)
+				eps, err := a.convertServiceToEndpoints(*svc)
 				if err != nil {
 					log.Warnln(err)
 					continue
 				}
 
-				results <- ep
+				for _, ep := range eps {
+					results <- ep
+				}
 			case <-done:
 				log.Info("[Service] Exited monitoring loop.")
 				return
@@ -134,7 +142,22 @@ loop:
 	}
 }
 
-func validateService(svc api.Service, filter map[string]string) error {
+// validate checks the service against the validation rules of the kind of
+// service it is, i.e. ExternalName, externalIPs, ClusterIP or LoadBalancer.
+func (a *kubernetesServiceProducer) validate(svc api.Service) error {
+	switch {
+	case a.trackExternalName && svc.Spec.Type == api.ServiceTypeExternalName:
+		return validateExternalNameService(svc, a.filter)
+	case a.trackExternalIPs && len(svc.Spec.ExternalIPs) > 0:
+		return validateExternalIPsService(svc, a.filter)
+	case a.trackClusterIP && svc.Annotations[clusterIPAnnotationKey] == "true":
+		return validateClusterIPService(svc, a.filter)
+	}
+
+	return validateService(svc, a.filter)
+}
+
+func validateServiceFilter(svc api.Service, filter map[string]string) error {
 	for key := range filter {
 		if svc.Annotations[key] != filter[key] {
 			return fmt.Errorf(
@@ -144,6 +167,14 @@ func validateService(svc api.Service, filter map[string]string) error {
 		}
 	}
 
+	return nil
+}
+
+func validateService(svc api.Service, filter map[string]string) error {
+	if err := validateServiceFilter(svc, filter); err != nil {
+		return err
+	}
+
 	switch {
 	case len(svc.Status.LoadBalancer.Ingress) == 0:
 		return fmt.Errorf(
@@ -160,18 +191,97 @@ func validateService(svc api.Service, filter map[string]string) error {
 	return nil
 }
 
-func (a *kubernetesServiceProducer) convertServiceToEndpoint(svc api.Service) (*pkg.Endpoint, error) {
-	ep := &pkg.Endpoint{
-		DNSName: svc.ObjectMeta.Annotations[annotationKey],
+func validateExternalNameService(svc api.Service, filter map[string]string) error {
+	if err := validateServiceFilter(svc, filter); err != nil {
+		return err
+	}
+
+	if svc.Spec.Type != api.ServiceTypeExternalName {
+		return fmt.Errorf("[Service] Service '%s/%s' is not of type ExternalName (%s)",
+			svc.Namespace, svc.Name, svc.Spec.Type)
+	}
+
+	if svc.Spec.ExternalName == "" {
+		return fmt.Errorf(
+			"[Service] The external name field of service '%s/%s' is empty",
+			svc.Namespace, svc.Name,
+		)
 	}
 
-	if ep.DNSName == "" {
-		var buf bytes.Buffer
-		if err := a.tmpl.Execute(&buf, svc); err != nil {
-			return nil, fmt.Errorf("[Service] Error applying template: %s", err)
+	return nil
+}
+
+func validateExternalIPsService(svc api.Service, filter map[string]string) error {
+	if err := validateServiceFilter(svc, filter); err != nil {
+		return err
+	}
+
+	if len(svc.Spec.ExternalIPs) == 0 {
+		return fmt.Errorf(
+			"[Service] The external IPs field of service '%s/%s' is empty",
+			svc.Namespace, svc.Name,
+		)
+	}
+
+	return nil
+}
+
+func validateClusterIPService(svc api.Service, filter map[string]string) error {
+	if err := validateServiceFilter(svc, filter); err != nil {
+		return err
+	}
+
+	if svc.Spec.Type != api.ServiceTypeClusterIP {
+		return fmt.Errorf("[Service] Service '%s/%s' is not of type ClusterIP (%s)",
+			svc.Namespace, svc.Name, svc.Spec.Type)
+	}
+
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == api.ClusterIPNone {
+		return fmt.Errorf(
+			"[Service] Service '%s/%s' has no cluster IP",
+			svc.Namespace, svc.Name,
+		)
+	}
+
+	return nil
+}
+
+func (a *kubernetesServiceProducer) convertServiceToEndpoints(svc api.Service) ([]*pkg.Endpoint, error) {
+	dnsName, err := a.dnsName(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.trackExternalName && svc.Spec.Type == api.ServiceTypeExternalName:
+		return []*pkg.Endpoint{{
+			DNSName:  dnsName,
+			Hostname: svc.Spec.ExternalName,
+			Proxied:  proxied(svc.Annotations),
+		}}, nil
+	case a.trackExternalIPs && len(svc.Spec.ExternalIPs) > 0:
+		endpoints := make([]*pkg.Endpoint, 0, len(svc.Spec.ExternalIPs))
+
+		for _, ip := range svc.Spec.ExternalIPs {
+			endpoints = append(endpoints, &pkg.Endpoint{
+				DNSName: dnsName,
+				IP:      ip,
+				Proxied: proxied(svc.Annotations),
+			})
 		}
 
-		ep.DNSName = pkg.SanitizeDNSName(buf.String())
+		return endpoints, nil
+	case a.trackClusterIP && svc.Annotations[clusterIPAnnotationKey] == "true":
+		return []*pkg.Endpoint{{
+			DNSName: dnsName,
+			IP:      svc.Spec.ClusterIP,
+			Private: true,
+		}}, nil
+	}
+
+	ep := &pkg.Endpoint{
+		DNSName: dnsName,
+		Proxied: proxied(svc.Annotations),
 	}
 
 	for _, i := range svc.Status.LoadBalancer.Ingress {
@@ -183,5 +293,20 @@ func (a *kubernetesServiceProducer) convertServiceToEndpoint(svc api.Service) (*
 		break
 	}
 
-	return ep, nil
+	return []*pkg.Endpoint{ep}, nil
+}
+
+// dnsName returns the DNS name of the service taken from its annotation or,
+// if missing, by applying the configured template.
+func (a *kubernetesServiceProducer) dnsName(svc api.Service) (string, error) {
+	if dnsName := svc.ObjectMeta.Annotations[annotationKey]; dnsName != "" {
+		return dnsName, nil
+	}
+
+	var buf bytes.Buffer
+	if err := a.tmpl.Execute(&buf, svc); err != nil {
+		return "", fmt.Errorf("[Service] Error applying template: %s", err)
+	}
+
+	return pkg.SanitizeDNSName(buf.String()), nil
 }
@@ -1,9 +1,13 @@
 package producers
 
 import (
+	"html/template"
+	"reflect"
 	"testing"
 
 	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/mate/pkg"
 )
 
 func TestValidateService(t *testing.T) {
@@ -39,3 +43,172 @@ func TestValidateService(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateExternalNameService(t *testing.T) {
+	externalNameService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "example.org"},
+	}
+
+	emptyExternalNameService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName},
+	}
+
+	clusterIPService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ExternalName: "example.org"},
+	}
+
+	for _, test := range []struct {
+		service v1.Service
+		filter  map[string]string
+		isErr   bool
+	}{
+		{externalNameService, map[string]string{}, false},
+		{externalNameService, map[string]string{"foo": "bar"}, true},
+		{emptyExternalNameService, map[string]string{}, true},
+		{clusterIPService, map[string]string{}, true},
+	} {
+		err := validateExternalNameService(test.service, test.filter)
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("validateExternalNameService(%q, %q) => %q, want %t", test.service.Name, test.filter, err, test.isErr)
+		}
+	}
+}
+
+func TestValidateExternalIPsService(t *testing.T) {
+	externalIPsService := v1.Service{
+		Spec: v1.ServiceSpec{ExternalIPs: []string{"8.8.8.8"}},
+	}
+
+	for _, test := range []struct {
+		service v1.Service
+		filter  map[string]string
+		isErr   bool
+	}{
+		{externalIPsService, map[string]string{}, false},
+		{externalIPsService, map[string]string{"foo": "bar"}, true},
+		{v1.Service{}, map[string]string{}, true},
+	} {
+		err := validateExternalIPsService(test.service, test.filter)
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("validateExternalIPsService(%q, %q) => %q, want %t", test.service.Name, test.filter, err, test.isErr)
+		}
+	}
+}
+
+func TestValidateClusterIPService(t *testing.T) {
+	clusterIPService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "10.3.0.1"},
+	}
+
+	headlessService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: v1.ClusterIPNone},
+	}
+
+	nodePortService := v1.Service{
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeNodePort, ClusterIP: "10.3.0.1"},
+	}
+
+	for _, test := range []struct {
+		service v1.Service
+		filter  map[string]string
+		isErr   bool
+	}{
+		{clusterIPService, map[string]string{}, false},
+		{clusterIPService, map[string]string{"foo": "bar"}, true},
+		{headlessService, map[string]string{}, true},
+		{nodePortService, map[string]string{}, true},
+	} {
+		err := validateClusterIPService(test.service, test.filter)
+		if isErr := err != nil; isErr != test.isErr {
+			t.Errorf("validateClusterIPService(%q, %q) => %q, want %t", test.service.Name, test.filter, err, test.isErr)
+		}
+	}
+}
+
+func TestConvertServiceToEndpoints(t *testing.T) {
+	tmpl := template.Must(template.New("endpoint").Parse("{{.Name}}.example.com"))
+
+	loadBalancer := v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{v1.LoadBalancerIngress{Hostname: "lb.example.org"}},
+	}
+
+	for _, test := range []struct {
+		producer *kubernetesServiceProducer
+		service  v1.Service
+		expected []*pkg.Endpoint
+	}{
+		{
+			&kubernetesServiceProducer{tmpl: tmpl},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{Name: "lb"},
+				Status:     v1.ServiceStatus{LoadBalancer: loadBalancer},
+			},
+			[]*pkg.Endpoint{{DNSName: "lb.example.com.", Hostname: "lb.example.org"}},
+		},
+		{
+			&kubernetesServiceProducer{tmpl: tmpl, trackExternalName: true},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{Name: "ext"},
+				Spec:       v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "foo.example.org"},
+			},
+			[]*pkg.Endpoint{{DNSName: "ext.example.com.", Hostname: "foo.example.org"}},
+		},
+		{
+			&kubernetesServiceProducer{tmpl: tmpl, trackExternalIPs: true},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{Name: "ips"},
+				Spec:       v1.ServiceSpec{ExternalIPs: []string{"8.8.8.8", "8.8.4.4"}},
+			},
+			[]*pkg.Endpoint{
+				{DNSName: "ips.example.com.", IP: "8.8.8.8"},
+				{DNSName: "ips.example.com.", IP: "8.8.4.4"},
+			},
+		},
+		{
+			&kubernetesServiceProducer{tmpl: tmpl, trackExternalIPs: true},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "annotated",
+					Annotations: map[string]string{annotationKey: "custom.example.com."},
+				},
+				Spec: v1.ServiceSpec{ExternalIPs: []string{"8.8.8.8"}},
+			},
+			[]*pkg.Endpoint{{DNSName: "custom.example.com.", IP: "8.8.8.8"}},
+		},
+		{
+			&kubernetesServiceProducer{tmpl: tmpl, trackClusterIP: true},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "internal",
+					Annotations: map[string]string{clusterIPAnnotationKey: "true"},
+				},
+				Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "10.3.0.1"},
+			},
+			[]*pkg.Endpoint{{DNSName: "internal.example.com.", IP: "10.3.0.1", Private: true}},
+		},
+		{
+			&kubernetesServiceProducer{tmpl: tmpl},
+			v1.Service{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "proxied",
+					Annotations: map[string]string{proxiedAnnotationKey: "true"},
+				},
+				Status: v1.ServiceStatus{LoadBalancer: loadBalancer},
+			},
+			[]*pkg.Endpoint{{DNSName: "proxied.example.com.", Hostname: "lb.example.org", Proxied: true}},
+		},
+	} {
+		if err := test.producer.validate(test.service); err != nil {
+			t.Errorf("validate(%q) => %q, want no error", test.service.Name, err)
+		}
+
+		endpoints, err := test.producer.convertServiceToEndpoints(test.service)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(endpoints, test.expected) {
+			t.Errorf("convertServiceToEndpoints(%q) => %v, want %v", test.service.Name, endpoints, test.expected)
+		}
+	}
+}